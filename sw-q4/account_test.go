@@ -0,0 +1,188 @@
+package main
+
+import (
+	"myapp/mailer"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var linkPattern = regexp.MustCompile(`http://frontend\.test/\S+`)
+
+// Extract the token from the link in the most recent email
+func tokenFromLastEmail(t *testing.T, m *mailer.MemoryMailer) string {
+	t.Helper()
+	messages := m.Messages()
+	if len(messages) == 0 {
+		t.Fatal("Expected an email to be sent")
+	}
+	link, err := url.Parse(linkPattern.FindString(messages[len(messages)-1].Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+// Test sending and confirming an email verification token
+func TestEmailVerification(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	mail := mailer.NewMemoryMailer()
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Mailer = mail
+	router := newRouter(db, cfg)
+
+	tokens := loginTestUser(t, router)
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/verify-email", nil, tokens.AccessToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Other user's email: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr := doJSONWithToken(t, router, "POST", "/users/2/verify-email", nil, tokens.AccessToken)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	if to := mail.Messages()[0].To; to != "bob@example.com" {
+		t.Errorf("Expected email to bob@example.com, got %s", to)
+	}
+	token := tokenFromLastEmail(t, mail)
+
+	// Another user's token is rejected without being used up
+	rr = doJSON(t, router, "POST", "/users/1/verify-email/confirm", map[string]string{"token": token})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Token of another user: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = doJSON(t, router, "POST", "/users/2/verify-email/confirm", map[string]string{"token": token})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	var user models.User
+	decodeBody(t, doJSON(t, router, "GET", "/users/2", nil).Body, &user)
+	if user.EmailVerifiedAt == nil || !user.EmailVerifiedAt.Equal(clock.Now()) {
+		t.Errorf("Expected email_verified_at to be set, got %v", user.EmailVerifiedAt)
+	}
+
+	// Tokens are single-use
+	rr = doJSON(t, router, "POST", "/users/2/verify-email/confirm", map[string]string{"token": token})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Reused token: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Test that verification tokens expire
+func TestEmailVerificationExpiry(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	mail := mailer.NewMemoryMailer()
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Mailer = mail
+	router := newRouter(db, cfg)
+
+	tokens := loginTestUser(t, router)
+	doJSONWithToken(t, router, "POST", "/users/2/verify-email", nil, tokens.AccessToken)
+	token := tokenFromLastEmail(t, mail)
+
+	clock.Advance(49 * time.Hour)
+	rr := doJSON(t, router, "POST", "/users/2/verify-email/confirm", map[string]string{"token": token})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expired token: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Test that changing the email address invalidates verification links sent to the old one
+func TestEmailVerificationAfterEmailChange(t *testing.T) {
+	for _, store := range []string{"table", "events"} {
+		t.Run("store="+store, func(t *testing.T) {
+			setupTestDatabase(t)
+			clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+			mail := mailer.NewMemoryMailer()
+			cfg := testConfig()
+			cfg.Clock = clock
+			cfg.Mailer = mail
+			cfg.UserStore = store
+			router := newRouter(db, cfg)
+
+			tokens := loginTestUser(t, router)
+			doJSONWithToken(t, router, "POST", "/users/2/verify-email", nil, tokens.AccessToken)
+			token := tokenFromLastEmail(t, mail)
+
+			// Renaming alone keeps the link valid; changing the address does not
+			update := models.User{Name: "Robert", Email: "bob@example.com"}
+			if rr := doJSONWithToken(t, router, "PUT", "/users/2", update, tokens.AccessToken); rr.Code != http.StatusOK {
+				t.Fatalf("Rename: got %v want %v", rr.Code, http.StatusOK)
+			}
+			update.Email = "robert@example.com"
+			if rr := doJSONWithToken(t, router, "PUT", "/users/2", update, tokens.AccessToken); rr.Code != http.StatusOK {
+				t.Fatalf("Change email: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if rr := doJSON(t, router, "POST", "/users/2/verify-email/confirm", map[string]string{"token": token}); rr.Code != http.StatusBadRequest {
+				t.Errorf("Link for the old address: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			var user models.User
+			decodeBody(t, doJSON(t, router, "GET", "/users/2", nil).Body, &user)
+			if user.EmailVerifiedAt != nil {
+				t.Errorf("Expected the new address to be unverified, got %v", user.EmailVerifiedAt)
+			}
+
+			// A link sent to the new address still works
+			doJSONWithToken(t, router, "POST", "/users/2/verify-email", nil, tokens.AccessToken)
+			if to := mail.Messages()[len(mail.Messages())-1].To; to != "robert@example.com" {
+				t.Errorf("Expected email to robert@example.com, got %s", to)
+			}
+			rr := doJSON(t, router, "POST", "/users/2/verify-email/confirm", map[string]string{"token": tokenFromLastEmail(t, mail)})
+			if rr.Code != http.StatusNoContent {
+				t.Errorf("Link for the new address: got %v want %v", rr.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+// Test the password reset request and confirm flow
+func TestPasswordReset(t *testing.T) {
+	setupTestDatabase(t)
+	mail := mailer.NewMemoryMailer()
+	cfg := testConfig()
+	cfg.Mailer = mail
+	router := newRouter(db, cfg)
+
+	tokens := loginTestUser(t, router)
+
+	// Unknown addresses get the same response but no email
+	rr := doJSON(t, router, "POST", "/auth/password-reset", map[string]string{"email": "nobody@example.com"})
+	if rr.Code != http.StatusAccepted || len(mail.Messages()) != 0 {
+		t.Fatalf("Unknown email: got %v with %d emails", rr.Code, len(mail.Messages()))
+	}
+
+	rr = doJSON(t, router, "POST", "/auth/password-reset", map[string]string{"email": "bob@example.com"})
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	token := tokenFromLastEmail(t, mail)
+
+	reset := map[string]string{"token": token, "password": "battery staple"}
+	if rr := doJSON(t, router, "POST", "/auth/password-reset/confirm", reset); rr.Code != http.StatusNoContent {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/password-reset/confirm", reset); rr.Code != http.StatusBadRequest {
+		t.Errorf("Reused token: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "correct horse"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Old password: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "battery staple"}); rr.Code != http.StatusOK {
+		t.Errorf("New password: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Existing refresh tokens are revoked by the reset
+	rr = doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Old refresh token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"myapp/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test defining the attribute schema and validating users against it
+func TestUserAttributes(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	schema := map[string]models.AttributeDefinition{
+		"department": {Type: "string", Required: true, Enum: []string{"eng", "sales"}},
+		"phone":      {Type: "string", Pattern: `\+[0-9]{6,15}`},
+		"floor":      {Type: "number"},
+	}
+	for name, def := range schema {
+		if rr := doJSONWithToken(t, router, "PUT", "/user-attributes/"+name, def, adminToken); rr.Code != http.StatusOK {
+			t.Fatalf("Define %s: got %v want %v", name, rr.Code, http.StatusOK)
+		}
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/user-attributes/Bad-Name", models.AttributeDefinition{Type: "string"}, adminToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid name: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/user-attributes/level", models.AttributeDefinition{Type: "date"}, adminToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid type: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSON(t, router, "PUT", "/user-attributes/level", models.AttributeDefinition{Type: "string"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous definition: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	var defs []models.AttributeDefinition
+	decodeBody(t, doJSON(t, router, "GET", "/user-attributes", nil).Body, &defs)
+	if len(defs) != 3 || defs[0].Name != "department" || len(defs[0].Enum) != 2 {
+		t.Errorf("Unexpected schema: %+v", defs)
+	}
+
+	invalid := []map[string]any{
+		{},                                       // missing required attribute
+		{"department": "legal"},                  // not in enum
+		{"department": "eng", "phone": "12345"},  // pattern mismatch
+		{"department": "eng", "floor": "third"},  // wrong type
+		{"department": "eng", "shoe_size": 42.0}, // not in schema
+	}
+	for _, attrs := range invalid {
+		user := models.User{Name: "Bob", Email: "bob@example.com", Attributes: attrs}
+		if rr := doJSON(t, router, "POST", "/users", user); rr.Code != http.StatusBadRequest {
+			t.Errorf("Attributes %v: got %v want %v", attrs, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	bob := models.User{Name: "Bob", Email: "bob@example.com", Attributes: map[string]any{"department": "eng", "phone": "+3531234567", "floor": 3}}
+	if rr := doJSON(t, router, "POST", "/users", bob); rr.Code != http.StatusCreated {
+		t.Fatalf("Create with attributes: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	carol := models.User{Name: "Carol", Email: "carol@example.com", Attributes: map[string]any{"department": "sales"}}
+	if rr := doJSON(t, router, "POST", "/users", carol); rr.Code != http.StatusCreated {
+		t.Fatalf("Create with attributes: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	var users []models.User
+	decodeBody(t, doJSON(t, router, "GET", "/users?attr.department=eng", nil).Body, &users)
+	if len(users) != 1 || users[0].Name != "Bob" || users[0].Attributes["phone"] != "+3531234567" {
+		t.Errorf("Expected only Bob in eng, got %+v", users)
+	}
+	decodeBody(t, doJSON(t, router, "GET", "/users?attr.floor=3", nil).Body, &users)
+	if len(users) != 1 || users[0].Name != "Bob" {
+		t.Errorf("Expected only Bob on floor 3, got %+v", users)
+	}
+	if rr := doJSON(t, router, "GET", "/users?attr.unknown=1", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Unknown filter attribute: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Omitting attributes on update keeps the stored values
+	bobToken := accessToken(t, cfg, 3, false)
+	if rr := doJSONWithToken(t, router, "PUT", "/users/3", models.User{Name: "Robert", Email: "bob@example.com"}, bobToken); rr.Code != http.StatusOK {
+		t.Fatalf("Update without attributes: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var user models.User
+	decodeBody(t, doJSON(t, router, "GET", "/users/3", nil).Body, &user)
+	if user.Name != "Robert" || user.Attributes["department"] != "eng" {
+		t.Errorf("Expected attributes to be kept, got %+v", user)
+	}
+	update := models.User{Name: "Robert", Email: "bob@example.com", Attributes: map[string]any{"department": "legal"}}
+	if rr := doJSONWithToken(t, router, "PUT", "/users/3", update, bobToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Update with invalid attributes: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
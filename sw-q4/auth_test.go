@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"myapp/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Create a user with a password and log in, returning the issued tokens
+func loginTestUser(t *testing.T, router http.Handler) models.TokenPair {
+	t.Helper()
+	rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com", Password: "correct horse"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	rr = doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "correct horse"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var tokens models.TokenPair
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// Test POST /auth/login with valid and invalid credentials
+func TestLogin(t *testing.T) {
+	router := setupRouter(t)
+	tokens := loginTestUser(t, router)
+
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" {
+		t.Errorf("Expected a bearer token pair, got %+v", tokens)
+	}
+
+	rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "wrong password"})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test that password hashes never appear in user JSON
+func TestPasswordHashNotExposed(t *testing.T) {
+	router := setupRouter(t)
+	loginTestUser(t, router)
+
+	rr := doJSON(t, router, "GET", "/users", nil)
+	body := rr.Body.String()
+	if strings.Contains(body, "password") || strings.Contains(body, "$2a$") {
+		t.Errorf("Expected no password data in response, got %s", body)
+	}
+}
+
+// Test POST /auth/refresh rotation and reuse detection
+func TestRefreshRotation(t *testing.T) {
+	router := setupRouter(t)
+	tokens := loginTestUser(t, router)
+
+	rr := doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rotated models.TokenPair
+	if err := json.NewDecoder(rr.Body).Decode(&rotated); err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Error("Expected a new refresh token after rotation")
+	}
+
+	// Reusing the old token is rejected and revokes the rotated one too
+	rr = doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Reused token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	rr = doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": rotated.RefreshToken})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Token from revoked family: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test POST /auth/logout revokes the refresh token
+func TestLogout(t *testing.T) {
+	router := setupRouter(t)
+	tokens := loginTestUser(t, router)
+
+	rr := doJSON(t, router, "POST", "/auth/logout", map[string]string{"refresh_token": tokens.RefreshToken})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	rr = doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test that changing a password checks the current one and ends other logins
+func TestChangePassword(t *testing.T) {
+	router := setupRouter(t)
+	tokens := loginTestUser(t, router)
+	// A second login on another device, with a cookie session
+	rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "correct horse"})
+	var other models.TokenPair
+	if err := json.NewDecoder(rr.Body).Decode(&other); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+	if rr := doWithCookies(router, "GET", "/auth/session", nil, cookies, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Session: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	change := map[string]string{"current_password": "wrong password", "new_password": "battery staple"}
+	if rr := doJSON(t, router, "POST", "/users/2/password", change); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/password", change, tokens.AccessToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Another user: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/2/password", change, tokens.AccessToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Wrong current password: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	change["current_password"] = "correct horse"
+	change["new_password"] = "short"
+	if rr := doJSONWithToken(t, router, "POST", "/users/2/password", change, tokens.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid new password: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	change["new_password"] = "battery staple"
+	if rr := doJSONWithToken(t, router, "POST", "/users/2/password", change, tokens.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Change password: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "correct horse"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Old password: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "battery staple"}); rr.Code != http.StatusOK {
+		t.Errorf("New password: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Refresh tokens and sessions from every earlier login are revoked
+	for _, old := range []models.TokenPair{tokens, other} {
+		rr := doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": old.RefreshToken})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Old refresh token: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if rr := doWithCookies(router, "GET", "/auth/session", nil, cookies, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Old session: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client: Typed Go client for the users API
+// Talks to the /v2 endpoints; idempotent calls are retried with exponential backoff
+
+// Defaults used by New
+const (
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+type Client struct {
+	BaseURL    string        // Server root, e.g. "https://users.internal"
+	HTTPClient *http.Client  // Client used for requests, http.DefaultClient if nil
+	Token      string        // Bearer access token; requests are anonymous when empty
+	OrgID      int           // Sent as X-Org-ID when set, for platform administrators
+	MaxRetries int           // Retries after the first attempt of an idempotent call
+	Backoff    time.Duration // Delay before the first retry, doubled on each further retry
+}
+
+// Create a client for the server at baseURL with the default retry policy
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+	}
+}
+
+// Send a request and decode the JSON response into out, if given
+// GET, PUT and DELETE are retried on network errors, 429 and 5xx responses; POST never is
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if method != http.MethodPost {
+		attempts += c.MaxRetries
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+		if err == nil && !retryable(resp.StatusCode) {
+			defer resp.Body.Close()
+			return decodeResponse(resp, out)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var wait time.Duration
+		if resp != nil {
+			wait = retryAfter(resp)
+			if attempt == attempts {
+				defer resp.Body.Close()
+				return decodeResponse(resp, out)
+			}
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else if attempt == attempts {
+			return err
+		}
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.OrgID != 0 {
+		req.Header.Set("X-Org-ID", strconv.Itoa(c.OrgID))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// Delay before the given retry: exponential with full jitter, capped at maxBackoff
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.Backoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Server-requested delay from a Retry-After header in seconds, capped at maxBackoff
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxBackoff)
+}
+
+// Decode a successful response into out, or turn a failed one into an *Error
+func decodeResponse(resp *http.Response, out any) error {
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var failure struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		b, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(b, &failure) == nil && failure.Error.Message != "" {
+			apiErr.Code, apiErr.Message = failure.Error.Code, failure.Error.Message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(b))
+		}
+		return apiErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Client Errors: Typed errors for failed API calls
+// Every non-2xx response becomes an *Error, which matches the sentinel errors below with errors.Is
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	ErrEmailTaken     = errors.New("email already in use") // Also matches ErrConflict
+)
+
+// Error is a failed response as reported by the server
+type Error struct {
+	StatusCode int    // HTTP status code
+	Code       string // Machine-readable code, e.g. "email_taken"
+	Message    string // Human-readable message from the server
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("users api: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Server error codes and the sentinel each one matches
+var codeErrors = map[string]error{
+	"invalid_request": ErrInvalidRequest,
+	"unauthorized":    ErrUnauthorized,
+	"forbidden":       ErrForbidden,
+	"not_found":       ErrNotFound,
+	"conflict":        ErrConflict,
+	"email_taken":     ErrEmailTaken,
+}
+
+// Status codes and the sentinel each one matches, for responses without a known code
+var statusErrors = map[int]error{
+	http.StatusBadRequest:   ErrInvalidRequest,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrForbidden,
+	http.StatusNotFound:     ErrNotFound,
+	http.StatusConflict:     ErrConflict,
+}
+
+func (e *Error) Is(target error) bool {
+	if sentinel, ok := codeErrors[e.Code]; ok && sentinel == target {
+		return true
+	}
+	return statusErrors[e.StatusCode] == target
+}
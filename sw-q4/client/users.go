@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client Users: User types and calls for the /v2/users endpoints
+// The types mirror the server's v2 representation
+
+type User struct {
+	ID            int            `json:"id"`
+	Name          string         `json:"name"`
+	Email         string         `json:"email"`
+	EmailVerified bool           `json:"email_verified"`
+	Role          string         `json:"role"`
+	Status        UserStatus     `json:"status"`
+	Tags          []string       `json:"tags"`
+	Attributes    map[string]any `json:"attributes"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// Account state together with why and when it last changed
+type UserStatus struct {
+	State     string     `json:"state"` // pending, active, suspended or deactivated
+	Reason    string     `json:"reason,omitempty"`
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+}
+
+type CreateUserRequest struct {
+	Name       string         `json:"name"`
+	Email      string         `json:"email"`
+	Password   string         `json:"password,omitempty"`
+	Role       string         `json:"role,omitempty"` // Only administrators can assign roles
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Omitted role and attributes keep their current values
+type UpdateUserRequest struct {
+	Name       string         `json:"name"`
+	Email      string         `json:"email"`
+	Role       string         `json:"role,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Criteria and paging for ListUsers; zero values mean no restriction
+type ListUsersOptions struct {
+	Status string // Only users in this account state
+	Filter string // Filter expression, e.g. `name co "ann"`
+	Limit  int    // Page size, at most 100; all users in one page when zero
+	Cursor string // NextCursor of the previous page
+}
+
+// One page of users
+type UserPage struct {
+	Users      []User `json:"data"`
+	NextCursor string `json:"next_cursor"` // Empty on the last page
+}
+
+type envelope[T any] struct {
+	Data T `json:"data"`
+}
+
+// Fetch one page of users
+func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) (*UserPage, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	if opts.Filter != "" {
+		query.Set("filter", opts.Filter)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	path := "/v2/users"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page UserPage
+	if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var resp envelope[User]
+	if err := c.do(ctx, http.MethodGet, userPath(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// Create a user; not retried, since a repeated request could create a duplicate
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var resp envelope[User]
+	if err := c.do(ctx, http.MethodPost, "/v2/users", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, id int, req UpdateUserRequest) (*User, error) {
+	var resp envelope[User]
+	if err := c.do(ctx, http.MethodPut, userPath(id), req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// Delete a user; a retry after a lost response reports ErrNotFound
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, userPath(id), nil, nil)
+}
+
+func userPath(id int) string {
+	return "/v2/users/" + strconv.Itoa(id)
+}
+
+// Iterate over every user matching opts, fetching pages of opts.Limit users as needed
+//
+//	it := c.Users(ctx, client.ListUsersOptions{Limit: 50})
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func (c *Client) Users(ctx context.Context, opts ListUsersOptions) *UserIterator {
+	if opts.Limit == 0 {
+		opts.Limit = 100
+	}
+	return &UserIterator{client: c, ctx: ctx, opts: opts, index: -1}
+}
+
+// UserIterator walks the pages of a user listing
+type UserIterator struct {
+	client *Client
+	ctx    context.Context
+	opts   ListUsersOptions
+	page   []User
+	index  int
+	done   bool // No page follows the current one
+	err    error
+}
+
+// Advance to the next user, fetching the next page when the current one is used up
+// Returns false at the end of the listing or on error
+func (it *UserIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.index+1 >= len(it.page) {
+		if it.done {
+			return false
+		}
+		page, err := it.client.ListUsers(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index = page.Users, -1
+		it.opts.Cursor = page.NextCursor
+		it.done = page.NextCursor == ""
+	}
+	it.index++
+	return true
+}
+
+// The current user; valid after Next returns true
+func (it *UserIterator) User() User {
+	return it.page[it.index]
+}
+
+// The error that stopped the iteration, if any
+func (it *UserIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"myapp/client"
+	"myapp/handlers/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test the client against the real router over HTTP
+func TestClient(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+	c.Token = adminToken
+
+	created, err := c.CreateUser(ctx, client.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "correct horse", Role: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Bob" || created.Role != "admin" || created.Status.State != "active" {
+		t.Errorf("Create: got %+v", created)
+	}
+
+	got, err := c.GetUser(ctx, created.ID)
+	if err != nil || got.Email != "bob@example.com" {
+		t.Errorf("Get: got %+v, %v", got, err)
+	}
+
+	updated, err := c.UpdateUser(ctx, created.ID, client.UpdateUserRequest{Name: "Robert", Email: "bob@example.com"})
+	if err != nil || updated.Name != "Robert" || updated.Role != "admin" {
+		t.Errorf("Update: got %+v, %v", updated, err)
+	}
+
+	// Typed errors
+	_, err = c.GetUser(ctx, 99)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "user not found" {
+		t.Errorf("Missing user: got %v", err)
+	}
+	_, err = c.CreateUser(ctx, client.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "correct horse"})
+	if !errors.Is(err, client.ErrEmailTaken) || !errors.Is(err, client.ErrConflict) {
+		t.Errorf("Duplicate email: got %v", err)
+	}
+	_, err = c.ListUsers(ctx, client.ListUsersOptions{Filter: "nickname eq 1"})
+	if !errors.Is(err, client.ErrInvalidRequest) {
+		t.Errorf("Bad filter: got %v", err)
+	}
+	anonymous := client.New(server.URL)
+	_, err = anonymous.CreateUser(ctx, client.CreateUserRequest{Name: "Eve", Email: "eve@example.com", Password: "correct horse", Role: "admin"})
+	if !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Role assignment: got %v", err)
+	}
+	_, err = anonymous.UpdateUser(ctx, created.ID, client.UpdateUserRequest{Name: "Eve", Email: "bob@example.com"})
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Anonymous update: got %v", err)
+	}
+
+	if err := c.DeleteUser(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUser(ctx, created.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Deleted user: got %v", err)
+	}
+}
+
+// Test that the iterator walks every page in order
+func TestClientPagination(t *testing.T) {
+	setupTestDatabase(t)
+	server := httptest.NewServer(newRouter(db, testConfig()))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+	for _, name := range []string{"Bob", "Carol", "Dave", "Erin", "Frank"} {
+		if _, err := c.CreateUser(ctx, client.CreateUserRequest{Name: name, Email: name + "@example.com", Password: "correct horse"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := c.ListUsers(ctx, client.ListUsersOptions{Limit: 2})
+	if err != nil || len(page.Users) != 2 || page.NextCursor == "" {
+		t.Fatalf("First page: got %+v, %v", page, err)
+	}
+
+	var names []string
+	it := c.Users(ctx, client.ListUsersOptions{Limit: 2})
+	for it.Next() {
+		names = append(names, it.User().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Iterated %v, want %v", names, want)
+	}
+
+	it = c.Users(ctx, client.ListUsersOptions{Filter: `name sw "x"`})
+	if it.Next() || it.Err() != nil {
+		t.Errorf("Empty listing: got %v", it.Err())
+	}
+	it = c.Users(ctx, client.ListUsersOptions{Limit: 500})
+	if it.Next() || !errors.Is(it.Err(), client.ErrInvalidRequest) {
+		t.Errorf("Oversized page: got %v", it.Err())
+	}
+}
+
+// Test that idempotent calls are retried on server errors and POST is not
+func TestClientRetries(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	var requests, failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+	c.Backoff = time.Millisecond
+
+	failures.Store(2)
+	if user, err := c.GetUser(ctx, 1); err != nil || user.Name != "Alice" {
+		t.Errorf("Get after failures: got %+v, %v", user, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Get: %d requests, want 3", n)
+	}
+
+	requests.Store(0)
+	failures.Store(10)
+	_, err := c.GetUser(ctx, 1)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "unavailable" {
+		t.Errorf("Exhausted retries: got %v", err)
+	}
+	if n := requests.Load(); n != 1+client.DefaultMaxRetries {
+		t.Errorf("Exhausted retries: %d requests, want %d", n, 1+client.DefaultMaxRetries)
+	}
+
+	requests.Store(0)
+	failures.Store(1)
+	if _, err := c.CreateUser(ctx, client.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "correct horse"}); err == nil {
+		t.Error("Create should not be retried")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Create: %d requests, want 1", n)
+	}
+
+	// Cancellation stops the backoff
+	failures.Store(10)
+	c.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetUser(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Cancelled: got %v", err)
+	}
+}
+
+// Test that the client types decode every field of the server's v2 representation
+func TestClientTypesMatchServer(t *testing.T) {
+	pairs := [][2]reflect.Type{
+		{reflect.TypeOf(client.User{}), reflect.TypeOf(v2.User{})},
+		{reflect.TypeOf(client.UserStatus{}), reflect.TypeOf(v2.UserStatus{})},
+		{reflect.TypeOf(client.CreateUserRequest{}), reflect.TypeOf(v2.CreateUserRequest{})},
+		{reflect.TypeOf(client.UpdateUserRequest{}), reflect.TypeOf(v2.UpdateUserRequest{})},
+	}
+	for _, pair := range pairs {
+		if got, want := jsonTags(pair[0]), jsonTags(pair[1]); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got fields %v, server has %v", pair[0], got, want)
+		}
+	}
+}
+
+func jsonTags(typ reflect.Type) []string {
+	var tags []string
+	for i := 0; i < typ.NumField(); i++ {
+		tags = append(tags, typ.Field(i).Tag.Get("json"))
+	}
+	return tags
+}
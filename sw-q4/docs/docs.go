@@ -0,0 +1,16 @@
+package docs
+
+import _ "embed"
+
+// Docs: API reference served by the application
+// openapi.json is maintained by hand; openapi_test.go checks it against the registered routes
+
+// OpenAPI 3.1 description of every route
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// Redoc page rendering the OpenAPI document
+//
+//go:embed redoc.html
+var ReferencePage []byte
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	ID   string
+	Name string
+	Data string
+}
+
+// Open the change feed, resuming after lastID when it is not empty
+func openEventStream(t *testing.T, server *httptest.Server, token, lastID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/v1/users/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Open stream: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type: got %q", got)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// Read the next event, skipping comments
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Name = value
+		case "data":
+			event.Data = value
+		case "":
+			if event.Name != "" {
+				return event
+			}
+		}
+	}
+}
+
+func decodeUserEvent(t *testing.T, event sseEvent) models.UserEvent {
+	t.Helper()
+	var payload models.UserEvent
+	if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if strconv.FormatInt(payload.ID, 10) != event.ID || payload.Type != event.Name {
+		t.Errorf("Event %+v does not match its payload %+v", event, payload)
+	}
+	return payload
+}
+
+// Test that user changes are streamed and that clients resume with Last-Event-ID
+func TestUserEventStream(t *testing.T) {
+	setupTestDatabase(t)
+	app := newServers(db, testConfig())
+	startOutbox(t, app)
+	router := app.router
+	server := httptest.NewServer(router)
+	// Registered first so it runs after the streams are cancelled
+	t.Cleanup(server.Close)
+	tokens := loginTestUser(t, router)
+
+	stream := openEventStream(t, server, tokens.AccessToken, "")
+	if rr := doJSONWithToken(t, router, "PUT", "/users/2", models.User{Name: "Robert", Email: "bob@example.com"}, tokens.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("Update: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, testConfig(), 1, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	updated := decodeUserEvent(t, readEvent(t, stream))
+	if updated.Type != models.UserUpdated || updated.UserID != 2 || updated.User == nil || updated.User.Name != "Robert" {
+		t.Errorf("Update event: got %+v", updated)
+	}
+	deleted := decodeUserEvent(t, readEvent(t, stream))
+	if deleted.Type != models.UserDeleted || deleted.UserID != 1 || deleted.User != nil || deleted.ID != updated.ID+1 {
+		t.Errorf("Delete event: got %+v", deleted)
+	}
+
+	// Resuming replays only the events after the given ID
+	resumed := openEventStream(t, server, tokens.AccessToken, strconv.FormatInt(updated.ID, 10))
+	if event := decodeUserEvent(t, readEvent(t, resumed)); event.ID != deleted.ID {
+		t.Errorf("Resume: got %+v want event %d", event, deleted.ID)
+	}
+
+	// Resuming from an unknown point tells the client to reload
+	expired := openEventStream(t, server, tokens.AccessToken, "1")
+	if event := readEvent(t, expired); event.Name != "reset" {
+		t.Errorf("Expired resume: got %+v want reset", event)
+	}
+
+	rr := doJSONWithToken(t, router, "GET", "/users/events?last_event_id=abc", nil, tokens.AccessToken)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid ID: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSON(t, router, "GET", "/users/events", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test the bounded replay buffer, organization filtering and dropping of slow subscribers
+func TestUserEventBus(t *testing.T) {
+	bus := services.NewUserEventBus(3, &fakeClock{now: time.Unix(1700000000, 0).UTC()})
+	_, _, slow := bus.Subscribe(1, 0)
+	_, _, other := bus.Subscribe(2, 0)
+	defer other.Close()
+
+	for i := 0; i < 2000; i++ {
+		bus.Publish(models.UserEvent{Type: models.UserUpdated, OrgID: 1, UserID: i})
+	}
+
+	// The publisher never waited; the slow subscriber got what fit and was then disconnected
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received == 0 || received >= 2000 {
+		t.Errorf("Slow subscriber: received %d events", received)
+	}
+	select {
+	case event := <-other.C:
+		t.Errorf("Other organization received %+v", event)
+	default:
+	}
+
+	// Only the last three events are kept
+	first := int64(1700000000 * 1e6)
+	replay, complete, sub := bus.Subscribe(1, first+1997)
+	sub.Close()
+	if !complete || len(replay) != 3 || replay[0].UserID != 1997 {
+		t.Errorf("Resume in buffer: complete %v, replay %+v", complete, replay)
+	}
+	if _, complete, sub := bus.Subscribe(1, first+10); complete {
+		t.Error("Resume before buffer: want incomplete")
+	} else {
+		sub.Close()
+	}
+}
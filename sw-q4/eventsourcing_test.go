@@ -0,0 +1,200 @@
+package main
+
+import (
+	"myapp/models"
+	"myapp/repositories"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Types of the events in a user's stream, oldest first
+func historyTypes(t *testing.T, id int) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT type FROM user_events WHERE user_id = ? ORDER BY version", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var types []string
+	for rows.Next() {
+		var eventType string
+		if err := rows.Scan(&eventType); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, eventType)
+	}
+	return types
+}
+
+// Test that the API works unchanged on event-sourced users and that the projection can be rebuilt
+func TestEventSourcedUsers(t *testing.T) {
+	setupTestDatabase(t)
+	store := repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval)
+	if n, err := store.ImportUsers(); err != nil || n != 1 {
+		t.Fatalf("Import: imported %d, %v", n, err)
+	}
+	cfg := testConfig()
+	cfg.UserStore = "events"
+	router := newRouter(db, cfg)
+
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bobby", Email: "bob@example.com"}); rr.Code != http.StatusConflict {
+		t.Errorf("Duplicate email: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/users/2", models.User{Name: "Robert", Email: "robert@example.com"}, accessToken(t, cfg, 2, false)); rr.Code != http.StatusOK {
+		t.Fatalf("Update: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, cfg, 1, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	want := []string{models.EventUserCreated, models.EventNameChanged, models.EventEmailChanged}
+	if got := historyTypes(t, 2); !slices.Equal(got, want) {
+		t.Errorf("Stream of user 2: got %v want %v", got, want)
+	}
+	if got := historyTypes(t, 1); !slices.Equal(got, []string{models.EventUserCreated, models.EventUserDeleted}) {
+		t.Errorf("Stream of user 1: got %v", got)
+	}
+	if _, err := db.Exec("UPDATE user_events SET type = ?", models.EventUserDeleted); err == nil {
+		t.Error("Expected user_events to reject updates")
+	}
+
+	// A damaged projection is restored from the events
+	if _, err := db.Exec("UPDATE users SET name = 'Mallory', role = 'admin' WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	projected, removed, err := store.RebuildProjections(time.Now())
+	if err != nil || projected != 1 || removed != 1 {
+		t.Fatalf("Rebuild: projected %d, removed %d, %v", projected, removed, err)
+	}
+	var user models.User
+	rr := doJSON(t, router, "GET", "/users/2", nil)
+	decodeBody(t, rr.Body, &user)
+	if rr.Code != http.StatusOK || user.Name != "Robert" || user.Email != "robert@example.com" || user.Role != models.RoleUser {
+		t.Errorf("After rebuild: got %v %+v", rr.Code, user)
+	}
+	if rr := doJSON(t, router, "GET", "/users/1", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Deleted user: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// Test that writes load users from snapshots and that a rebuild replays full streams
+func TestUserSnapshots(t *testing.T) {
+	setupTestDatabase(t)
+	store := repositories.NewUserEventStore(db, 2)
+	repo := repositories.NewEventSourcedUserRepository(db, store)
+	if _, err := store.ImportUsers(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0).UTC()
+
+	for _, name := range []string{"Alicia", "Ali", "Alice"} {
+		user := &models.User{ID: 1, OrgID: 1, Name: name, Email: "alice@example.com", Role: models.RoleUser, UpdatedAt: now}
+		if err := repo.UpdateUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var version int
+	if err := db.QueryRow("SELECT version FROM user_snapshots WHERE user_id = 1").Scan(&version); err != nil || version != 4 {
+		t.Fatalf("Snapshot: version %d, %v", version, err)
+	}
+
+	// Only events after the snapshot are replayed, so a damaged snapshot shows up in the next write
+	if _, err := db.Exec("UPDATE user_snapshots SET state = replace(state, '\"Alice\"', '\"Damaged\"')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetEmailVerified(1, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := repo.GetUserByID(1, 1); user.Name != "Damaged" || user.EmailVerifiedAt == nil {
+		t.Fatalf("Write from snapshot: got %+v", user)
+	}
+
+	// A rebuild ignores snapshots and rewrites them
+	if _, _, err := store.RebuildProjections(now); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := repo.GetUserByID(1, 1); user.Name != "Alice" || user.EmailVerifiedAt == nil {
+		t.Errorf("After rebuild: got %+v", user)
+	}
+	if err := db.QueryRow("SELECT version FROM user_snapshots WHERE user_id = 1").Scan(&version); err != nil || version != 5 {
+		t.Errorf("Rewritten snapshot: version %d, %v", version, err)
+	}
+}
+
+// Rows of a table whose column mentions a password hash
+func rowsWithPasswordHash(t *testing.T, table, column string) int {
+	t.Helper()
+	var n int
+	query := "SELECT COUNT(*) FROM " + table + " WHERE " + column + " LIKE '%password_hash%' OR " + column + " LIKE '%$2a$%'"
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// Test that password hashes stay out of events and snapshots, survive a rebuild, and are scrubbed from old streams
+func TestEventSourcedPasswords(t *testing.T) {
+	setupTestDatabase(t)
+	store := repositories.NewUserEventStore(db, 1)
+	if _, err := store.ImportUsers(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	cfg.UserStore = "events"
+	router := newRouter(db, cfg)
+
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com", Password: "correct horse"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	change := map[string]string{"current_password": "correct horse", "new_password": "battery staple"}
+	if rr := doJSONWithToken(t, router, "POST", "/users/2/password", change, accessToken(t, cfg, 2, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Change password: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	// A write through a store that snapshots every event
+	repo := repositories.NewEventSourcedUserRepository(db, store)
+	if err := repo.UpdateUser(&models.User{ID: 2, OrgID: 1, Name: "Robert", Email: "bob@example.com", Role: models.RoleUser, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{models.EventUserCreated, models.EventPasswordChanged, models.EventNameChanged}
+	if got := historyTypes(t, 2); !slices.Equal(got, want) {
+		t.Errorf("Stream of user 2: got %v want %v", got, want)
+	}
+	if n := rowsWithPasswordHash(t, "user_events", "data"); n != 0 {
+		t.Errorf("Events holding a password hash: %d", n)
+	}
+	if n := rowsWithPasswordHash(t, "user_snapshots", "state"); n != 0 {
+		t.Errorf("Snapshots holding a password hash: %d", n)
+	}
+
+	// The hash is kept in the projection across a rebuild
+	if _, _, err := store.RebuildProjections(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "battery staple"}); rr.Code != http.StatusOK {
+		t.Errorf("Login after rebuild: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Hashes written by earlier versions are removed by migrating
+	_, err := db.Exec(`INSERT INTO user_events (user_id, org_id, version, type, data, occurred_at)
+		VALUES (2, 1, 4, 'PasswordChanged', '{"password_hash":"$2a$04$legacy"}', CURRENT_TIMESTAMP);
+		UPDATE user_snapshots SET state = json_set(state, '$.password_hash', '$2a$04$legacy');
+		DELETE FROM schema_migrations WHERE version = 18;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repositories.Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if n := rowsWithPasswordHash(t, "user_events", "data") + rowsWithPasswordHash(t, "user_snapshots", "state"); n != 0 {
+		t.Errorf("Rows holding a password hash after migrating: %d", n)
+	}
+	if _, err := db.Exec("UPDATE user_events SET type = ?", models.EventUserDeleted); err == nil {
+		t.Error("Expected user_events to still reject updates")
+	}
+}
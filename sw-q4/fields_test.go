@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"myapp/models"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Decode a response into generic JSON objects and return their sorted keys
+func responseKeys(t *testing.T, body []byte) [][]string {
+	t.Helper()
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &objects); err != nil {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(body, &object); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, object)
+	}
+	keys := [][]string{}
+	for _, object := range objects {
+		var names []string
+		for name := range object {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		keys = append(keys, names)
+	}
+	return keys
+}
+
+// Test ?fields= projection on the list and get endpoints
+func TestSparseFieldsets(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com"})
+
+	rr := doJSON(t, router, "GET", "/users?fields=id,name", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("List: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if keys := responseKeys(t, rr.Body.Bytes()); len(keys) != 2 || !slices.Equal(keys[0], []string{"id", "name"}) || !slices.Equal(keys[1], []string{"id", "name"}) {
+		t.Errorf("List fields: got %v", keys)
+	}
+
+	rr = doJSON(t, router, "GET", "/users/2?fields=email,tags,%20attributes,email", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Get: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"attributes":{},"email":"bob@example.com","tags":[]}` {
+		t.Errorf("Get fields: got %s", body)
+	}
+
+	for _, path := range []string{"/users?fields=id,nickname", "/users/1?fields=password", "/users/1?fields=password_hash"} {
+		if rr := doJSON(t, router, "GET", path, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %v want %v", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+	if rr := doJSON(t, router, "GET", "/users/99?fields=id", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown user: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Selecting every field gives the same response as selecting none, so new
+	// fields on models.User must also be selectable
+	var full, projected map[string]any
+	decodeBody(t, doJSON(t, router, "GET", "/users/2", nil).Body, &full)
+	decodeBody(t, doJSON(t, router, "GET", "/users/2?fields="+strings.Join(models.UserFields, ","), nil).Body, &projected)
+	if !reflect.DeepEqual(full, projected) {
+		t.Errorf("All fields: got %v want %v", projected, full)
+	}
+}
@@ -0,0 +1,324 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter: Parser for the filter expression language used to query collections
+// Comparisons between a field and a literal are combined with and, or, not and parentheses:
+//
+//	name co "ann" and (email ew "@acme.com" or created_at gt "2025-01-01")
+//
+// Operators: eq, ne, co (contains), sw (starts with), ew (ends with), gt, ge, lt, le, and pr (present).
+// Literals are double-quoted strings, numbers, true, false and null. Keywords are case-insensitive.
+// Parsing only checks syntax; callers validate fields and values against their own schema.
+
+// Nesting limit, so deeply parenthesized input cannot exhaust the stack
+const maxDepth = 32
+
+// Comparison operators
+const (
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpContain = "co"
+	OpStarts  = "sw"
+	OpEnds    = "ew"
+	OpGt      = "gt"
+	OpGe      = "ge"
+	OpLt      = "lt"
+	OpLe      = "le"
+	OpPresent = "pr"
+)
+
+var operators = map[string]bool{
+	OpEq: true, OpNe: true, OpContain: true, OpStarts: true, OpEnds: true,
+	OpGt: true, OpGe: true, OpLt: true, OpLe: true, OpPresent: true,
+}
+
+// Error describes invalid filter input and the token it was found at
+type Error struct {
+	Pos   int    // Byte offset of the offending token
+	Token string // Offending token as written, empty at the end of input
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid filter: %s at end of input", e.Msg)
+	}
+	return fmt.Sprintf("invalid filter: %s at position %d (%q)", e.Msg, e.Pos+1, e.Token)
+}
+
+// Expr is a node of a parsed filter: *Comparison, *Logical or *Not
+type Expr interface {
+	expr()
+}
+
+// Comparison tests one field, e.g. name co "ann"
+type Comparison struct {
+	Field    string
+	Op       string // One of the Op constants
+	Value    any    // string, float64, bool or nil; unused for pr
+	FieldPos int
+	OpPos    int
+	ValuePos int
+	Raw      string // Value as written, for error messages
+}
+
+// Logical combines two expressions with "and" or "or"
+type Logical struct {
+	Op          string // "and" or "or"
+	Left, Right Expr
+}
+
+// Not negates an expression
+type Not struct {
+	Expr Expr
+}
+
+func (*Comparison) expr() {}
+func (*Logical) expr()    {}
+func (*Not) expr()        {}
+
+// Errors pointing at a comparison's field, operator or value
+func (c *Comparison) FieldError(msg string) *Error {
+	return &Error{Pos: c.FieldPos, Token: c.Field, Msg: msg}
+}
+
+func (c *Comparison) OpError(msg string) *Error {
+	return &Error{Pos: c.OpPos, Token: c.Op, Msg: msg}
+}
+
+func (c *Comparison) ValueError(msg string) *Error {
+	return &Error{Pos: c.ValuePos, Token: c.Raw, Msg: msg}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string // As written
+	pos  int
+}
+
+// Parse a filter expression into its syntax tree
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &Error{Pos: tok.pos, Token: tok.text, Msg: "unexpected token"}
+	}
+	return expr, nil
+}
+
+// Split input into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, &Error{Pos: i, Token: input[i:], Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokString, input[i : end+1], i})
+			i = end + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(input) && strings.IndexByte("0123456789.eE+-", input[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, token{tokNumber, input[i:end], i})
+			i = end
+		case isIdentByte(c):
+			end := i
+			for end < len(input) && isIdentByte(input[end]) {
+				end++
+			}
+			tokens = append(tokens, token{tokIdent, input[i:end], i})
+			i = end
+		default:
+			end := i + 1
+			for end < len(input) && input[end] >= 0x80 {
+				end++
+			}
+			return nil, &Error{Pos: i, Token: input[i:end], Msg: "unexpected character"}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(input)}), nil
+}
+
+// Identifiers allow dotted and URN-style paths such as emails.value
+func isIdentByte(c byte) bool {
+	return c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || c == '_' || c == '.' || c == ':' || c == '$')
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+// Report whether the next token is the given keyword, consuming it if so
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokIdent && strings.EqualFold(tok.text, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func unexpected(tok token, msg string) *Error {
+	return &Error{Pos: tok.pos, Token: tok.text, Msg: msg}
+}
+
+// or := and ("or" and)*
+func (p *parser) parseOr(depth int) (Expr, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// and := unary ("and" unary)*
+func (p *parser) parseAnd(depth int) (Expr, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// unary := "not" unary | "(" or ")" | comparison
+func (p *parser) parseUnary(depth int) (Expr, error) {
+	if depth > maxDepth {
+		return nil, unexpected(p.peek(), "expression nested too deeply")
+	}
+	if p.keyword("not") {
+		inner, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: inner}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.advance()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.advance(); tok.kind != tokRParen {
+			return nil, unexpected(tok, "expected )")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// comparison := field op literal | field "pr"
+func (p *parser) parseComparison() (Expr, error) {
+	field := p.advance()
+	if field.kind != tokIdent {
+		return nil, unexpected(field, "expected field name")
+	}
+	op := p.advance()
+	if op.kind != tokIdent || !operators[strings.ToLower(op.text)] {
+		return nil, unexpected(op, "expected operator (eq, ne, co, sw, ew, gt, ge, lt, le, pr)")
+	}
+	c := &Comparison{Field: field.text, Op: strings.ToLower(op.text), FieldPos: field.pos, OpPos: op.pos}
+	if c.Op == OpPresent {
+		return c, nil
+	}
+
+	value := p.advance()
+	c.ValuePos, c.Raw = value.pos, value.text
+	switch value.kind {
+	case tokString:
+		s, err := strconv.Unquote(value.text)
+		if err != nil {
+			return nil, unexpected(value, "invalid string")
+		}
+		c.Value = s
+	case tokNumber:
+		n, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, unexpected(value, "invalid number")
+		}
+		c.Value = n
+	case tokIdent:
+		switch strings.ToLower(value.text) {
+		case "true":
+			c.Value = true
+		case "false":
+			c.Value = false
+		case "null":
+			c.Value = nil
+		default:
+			return nil, unexpected(value, "expected a value; strings must be double-quoted")
+		}
+	default:
+		return nil, unexpected(value, "expected a value")
+	}
+	return c, nil
+}
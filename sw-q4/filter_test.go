@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"myapp/filter"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the filter grammar and the positions reported for syntax errors
+func TestParseFilter(t *testing.T) {
+	expr, err := filter.Parse(`name co "ann" AND (email ew "@acme.com" or not created_at gt "2025-01-01")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := expr.(*filter.Logical)
+	if !ok || and.Op != "and" {
+		t.Fatalf("Expected and at the root, got %#v", expr)
+	}
+	if c, ok := and.Left.(*filter.Comparison); !ok || c.Field != "name" || c.Op != filter.OpContain || c.Value != "ann" {
+		t.Errorf("Unexpected left operand %#v", and.Left)
+	}
+	if or, ok := and.Right.(*filter.Logical); !ok || or.Op != "or" {
+		t.Errorf("Expected or on the right, got %#v", and.Right)
+	} else if _, ok := or.Right.(*filter.Not); !ok {
+		t.Errorf("Expected not, got %#v", or.Right)
+	}
+
+	invalid := map[string]struct {
+		pos   int
+		token string
+	}{
+		`name co ann`:              {9, "ann"},
+		`name like "ann"`:          {6, "like"},
+		`name co "ann`:             {9, `"ann`},
+		`(name pr`:                 {9, ""},
+		`name pr)`:                 {8, ")"},
+		`name eq "a" and`:          {16, ""},
+		`name eq "a" ; drop users`: {13, ";"},
+	}
+	for input, want := range invalid {
+		_, err := filter.Parse(input)
+		var filterErr *filter.Error
+		if !errors.As(err, &filterErr) || filterErr.Pos+1 != want.pos || filterErr.Token != want.token {
+			t.Errorf("Parse(%q): got %v, want error at %d (%q)", input, err, want.pos, want.token)
+		}
+	}
+}
+
+// Test filtering users through GET /users?filter=
+func TestFilterUsers(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+
+	people := []models.User{
+		{Name: "Ann Lee", Email: "ann@acme.com"},
+		{Name: "Joanna Smith", Email: "joanna@example.com"},
+		{Name: "Bob 100%", Email: "bob_1@acme.com"},
+	}
+	for _, user := range people {
+		if rr := doJSON(t, router, "POST", "/users", user); rr.Code != http.StatusCreated {
+			t.Fatalf("create %s: got %v want %v", user.Name, rr.Code, http.StatusCreated)
+		}
+		clock.Advance(24 * time.Hour)
+	}
+
+	cases := map[string][]int{
+		`name co "ann"`: {2, 3},
+		`name co "ann" and (email ew "@acme.com" or created_at gt "2025-01-02")`: {2, 3},
+		`name co "ann" and (email ew "@acme.com" or created_at gt "2025-01-03")`: {2},
+		`created_at ge "2025-01-02T12:00:00Z" and created_at lt "2025-01-03"`:    {3},
+		`not email ew "@acme.com"`:            {1, 3},
+		`id gt 2 and status eq "active"`:      {3, 4},
+		`name co "%"`:                         {4},
+		`email sw "bob_"`:                     {4},
+		`email sw "bob%"`:                     {},
+		`created_at eq null`:                  {1},
+		`created_at pr`:                       {2, 3, 4},
+		`name eq "x\" or 1=1 or name eq \"y"`: {},
+	}
+	for expr, expected := range cases {
+		if ids := userIDs(t, router, "/users?filter="+url.QueryEscape(expr)); !sameIDs(ids, expected) {
+			t.Errorf("%s: got %v want %v", expr, ids, expected)
+		}
+	}
+
+	invalid := map[string]string{
+		`nickname eq "ann"`:         `position 1 ("nickname")`,
+		`id eq "2"`:                 `position 7 ("\"2\"")`,
+		`created_at gt "yesterday"`: `position 15`,
+		`created_at co "2025"`:      `position 12 ("co")`,
+		`name gt null`:              `position 9 ("null")`,
+		`name eq`:                   `end of input`,
+	}
+	for expr, position := range invalid {
+		rr := doJSON(t, router, "GET", "/users?filter="+url.QueryEscape(expr), nil)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), position) {
+			t.Errorf("%s: got %v %q, want 400 mentioning %s", expr, rr.Code, rr.Body.String(), position)
+		}
+	}
+}
@@ -6,5 +6,19 @@ require github.com/gorilla/mux v1.8.1
 
 require github.com/mattn/go-sqlite3 v1.14.24
 
-require github.com/rs/cors v1.11.1 
+require github.com/rs/cors v1.11.1
 
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/graphql-go/graphql v0.8.1
+	golang.org/x/crypto v0.31.0
+	google.golang.org/grpc v1.67.3
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
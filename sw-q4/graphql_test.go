@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"myapp/handlers/gql"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// Run a GraphQL request and decode its data into v, if given
+func doGraphQL(t *testing.T, router http.Handler, token, query string, variables map[string]any, v any) graphQLResponse {
+	t.Helper()
+	rr := doJSONWithToken(t, router, "POST", "/graphql", gql.Request{Query: query, Variables: variables}, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("graphql: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp graphQLResponse
+	decodeBody(t, rr.Body, &resp)
+	if v != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func errorCode(resp graphQLResponse) string {
+	if len(resp.Errors) == 0 {
+		return ""
+	}
+	code, _ := resp.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// Test queries and mutations through /graphql
+func TestGraphQLUsers(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	var got struct {
+		User map[string]any `json:"user"`
+	}
+	resp := doGraphQL(t, router, "", `{ user(id: 1) { name status { state } tags } }`, nil, &got)
+	want := map[string]any{"name": "Alice", "status": map[string]any{"state": "active"}, "tags": []any{}}
+	if len(resp.Errors) > 0 || !reflect.DeepEqual(got.User, want) {
+		t.Errorf("user: got %v %v", got.User, resp.Errors)
+	}
+	if doGraphQL(t, router, "", `{ user(id: 99) { name } }`, nil, &got); got.User != nil {
+		t.Errorf("Missing user: got %v", got.User)
+	}
+
+	create := `mutation($input: CreateUserInput!) { createUser(input: $input) { id name role createdAt attributes } }`
+	var created struct {
+		CreateUser struct {
+			ID         string         `json:"id"`
+			Role       string         `json:"role"`
+			CreatedAt  time.Time      `json:"createdAt"`
+			Attributes map[string]any `json:"attributes"`
+		} `json:"createUser"`
+	}
+	resp = doGraphQL(t, router, adminToken, create, map[string]any{
+		"input": map[string]any{"name": "Bob", "email": "bob@example.com", "password": "correct horse", "role": "admin"},
+	}, &created)
+	if len(resp.Errors) > 0 || created.CreateUser.Role != "admin" || !created.CreateUser.CreatedAt.Equal(clock.now) {
+		t.Fatalf("createUser: got %+v %v", created.CreateUser, resp.Errors)
+	}
+	bobID := created.CreateUser.ID
+
+	resp = doGraphQL(t, router, "", create, map[string]any{"input": map[string]any{"name": "Eve", "email": "eve@example.com", "role": "admin"}}, nil)
+	if errorCode(resp) != "FORBIDDEN" {
+		t.Errorf("Role assignment: got %v", resp.Errors)
+	}
+	resp = doGraphQL(t, router, "", create, map[string]any{"input": map[string]any{"name": "Bob", "email": "bob@example.com"}}, nil)
+	if errorCode(resp) != "EMAIL_TAKEN" {
+		t.Errorf("Duplicate email: got %v", resp.Errors)
+	}
+
+	var updated struct {
+		UpdateUser struct {
+			Name string `json:"name"`
+			Role string `json:"role"`
+		} `json:"updateUser"`
+	}
+	rename := `mutation { updateUser(id: "` + bobID + `", input: {name: "Robert", email: "bob@example.com"}) { name role } }`
+	if resp = doGraphQL(t, router, "", rename, nil, nil); errorCode(resp) != "UNAUTHENTICATED" {
+		t.Errorf("Anonymous updateUser: got %v", resp.Errors)
+	}
+	if resp = doGraphQL(t, router, accessToken(t, cfg, 1, false), rename, nil, nil); errorCode(resp) != "FORBIDDEN" {
+		t.Errorf("updateUser of another user: got %v", resp.Errors)
+	}
+	resp = doGraphQL(t, router, adminToken, `mutation { updateUser(id: "`+bobID+`", input: {name: "Robert", email: "bob@example.com", password: "new password"}) { name } }`, nil, nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "password") {
+		t.Errorf("updateUser with password: got %v", resp.Errors)
+	}
+	resp = doGraphQL(t, router, adminToken, rename, nil, &updated)
+	if len(resp.Errors) > 0 || updated.UpdateUser.Name != "Robert" || updated.UpdateUser.Role != "admin" {
+		t.Errorf("updateUser: got %+v %v", updated.UpdateUser, resp.Errors)
+	}
+
+	resp = doGraphQL(t, router, adminToken, `mutation { deleteUser(id: "`+bobID+`") }`, nil, nil)
+	if len(resp.Errors) > 0 {
+		t.Errorf("deleteUser: got %v", resp.Errors)
+	}
+	resp = doGraphQL(t, router, adminToken, `mutation { deleteUser(id: "`+bobID+`") }`, nil, nil)
+	if errorCode(resp) != "NOT_FOUND" {
+		t.Errorf("Deleting again: got %v", resp.Errors)
+	}
+
+	resp = doGraphQL(t, router, "", `{ users(filter: "nickname eq 1") { edges { cursor } } }`, nil, nil)
+	if errorCode(resp) != "BAD_USER_INPUT" {
+		t.Errorf("Invalid filter: got %v", resp.Errors)
+	}
+	resp = doGraphQL(t, router, "", `{ user(id: 1) { password } }`, nil, nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "password") {
+		t.Errorf("Unknown field: got %v", resp.Errors)
+	}
+}
+
+// Test Relay-style pagination of the users connection
+func TestGraphQLPagination(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	for _, name := range []string{"Bob", "Carol", "Dave", "Erin"} {
+		if rr := doJSON(t, router, "POST", "/v1/users", map[string]string{"name": name, "email": name + "@example.com"}); rr.Code != http.StatusCreated {
+			t.Fatalf("create %s: got %v", name, rr.Code)
+		}
+	}
+
+	query := `query($after: String) {
+		users(first: 2, after: $after) {
+			edges { cursor node { name } }
+			pageInfo { hasNextPage hasPreviousPage endCursor }
+		}
+	}`
+	type page struct {
+		Users struct {
+			Edges []struct {
+				Cursor string
+				Node   struct{ Name string }
+			}
+			PageInfo struct {
+				HasNextPage     bool
+				HasPreviousPage bool
+				EndCursor       string
+			}
+		}
+	}
+
+	var names []string
+	var after any
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Pagination did not end")
+		}
+		var p page
+		resp := doGraphQL(t, router, "", query, map[string]any{"after": after}, &p)
+		if len(resp.Errors) > 0 {
+			t.Fatal(resp.Errors)
+		}
+		for _, edge := range p.Users.Edges {
+			names = append(names, edge.Node.Name)
+		}
+		if p.Users.PageInfo.HasPreviousPage != (after != nil) {
+			t.Errorf("Page %d: hasPreviousPage %v", pages, p.Users.PageInfo.HasPreviousPage)
+		}
+		if p.Users.Edges[len(p.Users.Edges)-1].Cursor != p.Users.PageInfo.EndCursor {
+			t.Errorf("Page %d: endCursor does not match the last edge", pages)
+		}
+		if !p.Users.PageInfo.HasNextPage {
+			break
+		}
+		after = p.Users.PageInfo.EndCursor
+	}
+	if want := []string{"Alice", "Bob", "Carol", "Dave", "Erin"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Paged through %v, want %v", names, want)
+	}
+
+	for _, q := range []string{`{ users(first: 0) { edges { cursor } } }`, `{ users(after: "bogus") { edges { cursor } } }`} {
+		if resp := doGraphQL(t, router, "", q, nil, nil); errorCode(resp) != "BAD_USER_INPUT" {
+			t.Errorf("%s: got %v", q, resp.Errors)
+		}
+	}
+}
+
+// Test that deep and expensive queries are rejected before they run
+func TestGraphQLLimits(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+
+	// Within limits: 1 + 100 * (edges + node + 3 fields) = 501
+	resp := doGraphQL(t, router, "", `{ users(first: 100) { edges { node { id name email } } } }`, nil, nil)
+	if len(resp.Errors) > 0 {
+		t.Errorf("Allowed query: got %v", resp.Errors)
+	}
+
+	expensive := `query($n: Int) {
+		a: users(first: $n) { edges { node { id name email tags } } }
+		b: users(first: $n) { edges { node { id name email tags } } }
+	}`
+	resp = doGraphQL(t, router, "", expensive, map[string]any{"n": 100}, nil)
+	if errorCode(resp) != "QUERY_TOO_COMPLEX" || !strings.Contains(resp.Errors[0].Message, "complexity 1202") {
+		t.Errorf("Expensive query: got %v", resp.Errors)
+	}
+	if resp := doGraphQL(t, router, "", expensive, map[string]any{"n": 10}, nil); len(resp.Errors) > 0 {
+		t.Errorf("Same query with small pages: got %v", resp.Errors)
+	}
+
+	// Depth counts through fragments
+	deep := `{ user(id: 1) { ...a } } fragment a on User { status { x { y { z { w { v { u { t } } } } } } } }`
+	resp = doGraphQL(t, router, "", deep, nil, nil)
+	if errorCode(resp) != "QUERY_TOO_COMPLEX" || !strings.Contains(resp.Errors[0].Message, "depth 9") {
+		t.Errorf("Deep query: got %v", resp.Errors)
+	}
+
+	// Introspection is exempt
+	resp = doGraphQL(t, router, "", `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name ofType { name } } } } } } } } }`, nil, nil)
+	if len(resp.Errors) > 0 {
+		t.Errorf("Introspection: got %v", resp.Errors)
+	}
+}
+
+// Test that GraphiQL is only served in development mode
+func TestGraphiQL(t *testing.T) {
+	setupTestDatabase(t)
+	if rr := doJSON(t, newRouter(db, testConfig()), "GET", "/graphql", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Production: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	cfg := testConfig()
+	cfg.DevMode = true
+	rr := doJSON(t, newRouter(db, cfg), "GET", "/graphql", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "graphiql") {
+		t.Errorf("Development: got %v", rr.Code)
+	}
+}
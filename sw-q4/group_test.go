@@ -0,0 +1,72 @@
+package main
+
+import (
+	"myapp/models"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Test creating groups, managing members and listing a user's groups
+func TestGroupMembership(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	rr := doJSONWithToken(t, router, "POST", "/groups", models.Group{Name: "Platform", Description: "Infra team"}, adminToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create group: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var group models.Group
+	decodeBody(t, rr.Body, &group)
+
+	if rr := doJSONWithToken(t, router, "POST", "/groups", models.Group{Name: "Platform"}, adminToken); rr.Code != http.StatusConflict {
+		t.Errorf("Duplicate name: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := doJSON(t, router, "POST", "/groups", models.Group{Name: "Anonymous"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous create: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	members := "/groups/" + strconv.Itoa(group.ID) + "/members"
+	if rr := doJSONWithToken(t, router, "POST", members, map[string]any{"user_id": 1, "role": "owner"}, adminToken); rr.Code != http.StatusOK {
+		t.Fatalf("Add member: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = doJSONWithToken(t, router, "POST", members, map[string]any{"user_id": 2}, adminToken)
+	decodeBody(t, rr.Body, &group)
+	if len(group.Members) != 2 || group.Members[0].Role != models.GroupRoleOwner || group.Members[1].Role != models.GroupRoleMember {
+		t.Errorf("Unexpected members: %+v", group.Members)
+	}
+	if rr := doJSONWithToken(t, router, "POST", members, map[string]any{"user_id": 1, "role": "boss"}, adminToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid role: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSONWithToken(t, router, "POST", members, map[string]any{"user_id": 99}, adminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown user: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	var userGroups []models.UserGroup
+	decodeBody(t, doJSON(t, router, "GET", "/users/1/groups", nil).Body, &userGroups)
+	if len(userGroups) != 1 || userGroups[0].Name != "Platform" || userGroups[0].Role != models.GroupRoleOwner {
+		t.Errorf("Unexpected user groups: %+v", userGroups)
+	}
+
+	// Deleting a user removes their memberships
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, cfg, 1, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete user: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	decodeBody(t, doJSON(t, router, "GET", "/groups/"+strconv.Itoa(group.ID), nil).Body, &group)
+	if len(group.Members) != 1 || group.Members[0].UserID != 2 {
+		t.Errorf("Expected only the admin to remain, got %+v", group.Members)
+	}
+
+	if rr := doJSONWithToken(t, router, "DELETE", "/groups/"+strconv.Itoa(group.ID), nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete group: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	decodeBody(t, doJSON(t, router, "GET", "/users/2/groups", nil).Body, &userGroups)
+	if len(userGroups) != 0 {
+		t.Errorf("Expected no groups after deletion, got %+v", userGroups)
+	}
+}
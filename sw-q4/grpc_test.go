@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"myapp/rpc/userpb"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Serve the gRPC API over an in-memory connection and return a client for it
+func setupGRPC(t *testing.T, cfg config) (userpb.UserServiceClient, http.Handler) {
+	t.Helper()
+	app := newServers(db, cfg)
+	router, server := app.router, app.grpc
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return userpb.NewUserServiceClient(conn), router
+}
+
+// Test CRUD calls and error mapping over gRPC
+func TestGRPCUsers(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	client, router := setupGRPC(t, cfg)
+	adminToken := setupAdmin(t, router, clock)
+	ctx := context.Background()
+	adminCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+adminToken)
+
+	alice, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: 1})
+	if err != nil || alice.Name != "Alice" || alice.Status.GetState() != "active" {
+		t.Fatalf("Get: got %v, %v", alice, err)
+	}
+
+	attributes, _ := structpb.NewStruct(map[string]any{})
+	created, err := client.CreateUser(adminCtx, &userpb.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "correct horse", Role: "admin", Attributes: attributes})
+	if err != nil || created.Role != "admin" || created.Id == 0 || created.CreatedAt.AsTime() != clock.now {
+		t.Fatalf("Create: got %v, %v", created, err)
+	}
+
+	updated, err := client.UpdateUser(adminCtx, &userpb.UpdateUserRequest{Id: created.Id, Name: "Robert", Email: "bob@example.com"})
+	if err != nil || updated.Name != "Robert" || updated.Role != "admin" {
+		t.Errorf("Update: got %v, %v", updated, err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"Missing user", func() error { _, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: 99}); return err }(), codes.NotFound},
+		{"Duplicate email", func() error {
+			_, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Bob", Email: "bob@example.com", Password: "correct horse"})
+			return err
+		}(), codes.AlreadyExists},
+		{"Invalid role", func() error {
+			_, err := client.CreateUser(adminCtx, &userpb.CreateUserRequest{Name: "Carol", Email: "carol@example.com", Role: "root"})
+			return err
+		}(), codes.InvalidArgument},
+		{"Role assignment", func() error {
+			_, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Eve", Email: "eve@example.com", Role: "admin"})
+			return err
+		}(), codes.PermissionDenied},
+		{"Anonymous update", func() error {
+			_, err := client.UpdateUser(ctx, &userpb.UpdateUserRequest{Id: created.Id, Name: "Eve", Email: "bob@example.com"})
+			return err
+		}(), codes.Unauthenticated},
+		{"Password on update", func() error {
+			_, err := client.UpdateUser(adminCtx, &userpb.UpdateUserRequest{Id: created.Id, Name: "Robert", Email: "bob@example.com", Password: "new password"})
+			return err
+		}(), codes.InvalidArgument},
+		{"Anonymous delete", func() error {
+			_, err := client.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: created.Id})
+			return err
+		}(), codes.Unauthenticated},
+		{"Invalid token", func() error {
+			_, err := client.GetUser(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope"), &userpb.GetUserRequest{Id: 1})
+			return err
+		}(), codes.Unauthenticated},
+		{"Foreign organization", func() error {
+			_, err := client.GetUser(metadata.AppendToOutgoingContext(ctx, "x-org-id", "2"), &userpb.GetUserRequest{Id: 1})
+			return err
+		}(), codes.PermissionDenied},
+	} {
+		if got := status.Code(tc.err); got != tc.want {
+			t.Errorf("%s: got %v (%v) want %v", tc.name, got, tc.err, tc.want)
+		}
+	}
+
+	if _, err := client.DeleteUser(adminCtx, &userpb.DeleteUserRequest{Id: created.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Deleted user: got %v", err)
+	}
+}
+
+// Test that ListUsers streams every matching user across batches
+func TestGRPCListUsers(t *testing.T) {
+	setupTestDatabase(t)
+	client, _ := setupGRPC(t, testConfig())
+	ctx := context.Background()
+
+	// More users than one batch
+	for i := 0; i < 120; i++ {
+		name := "User " + strconv.Itoa(i)
+		if _, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: name, Email: "user" + strconv.Itoa(i) + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect := func(req *userpb.ListUsersRequest) ([]int64, error) {
+		stream, err := client.ListUsers(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		var ids []int64
+		for {
+			user, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return ids, nil
+			}
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, user.Id)
+		}
+	}
+
+	ids, err := collect(&userpb.ListUsersRequest{})
+	if err != nil || len(ids) != 121 {
+		t.Fatalf("List: got %d users, %v", len(ids), err)
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("List out of order at %d: got %d", i, id)
+		}
+	}
+
+	ids, err = collect(&userpb.ListUsersRequest{Filter: `email sw "user11"`})
+	if err != nil || len(ids) != 11 {
+		t.Errorf("Filtered: got %v, %v", ids, err)
+	}
+
+	if _, err := collect(&userpb.ListUsersRequest{Filter: "name eq"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Invalid filter: got %v", err)
+	}
+	if _, err := collect(&userpb.ListUsersRequest{Status: "gone"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Invalid status: got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Account Handlers: Manages HTTP request/response for email verification and password resets
+
+type AccountHandler struct {
+	accountService *services.AccountService
+}
+
+func NewAccountHandler(accountService *services.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+type tokenRequest struct {
+	Token string `json:"token"`
+}
+
+type passwordResetRequest struct {
+	OrgID int    `json:"org_id,omitempty"` // Defaults to the organization of the request
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Send a verification email (the user themselves or an admin)
+func (h *AccountHandler) SendVerification(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	if principal.UserID != id && !principal.IsAdmin() {
+		http.Error(w, "cannot verify another user's email", http.StatusForbidden)
+		return
+	}
+
+	if err := h.accountService.SendVerification(OrgFromContext(r.Context()), id); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Confirm an email address with the token from the verification email
+func (h *AccountHandler) ConfirmVerification(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.accountService.ConfirmVerification(id, req.Token); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Request a password reset email; always accepted to avoid revealing which emails exist
+func (h *AccountHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orgID := req.OrgID
+	if orgID == 0 {
+		orgID = OrgFromContext(r.Context())
+	}
+
+	if err := h.accountService.RequestPasswordReset(orgID, req.Email); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Set a new password with the token from the reset email
+func (h *AccountHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.accountService.ResetPassword(req.Token, req.Password); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map account service errors onto HTTP status codes
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrInvalidPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrEmailAlreadyVerified):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"myapp/models"
+	"myapp/services"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Auth Handlers: Manages HTTP request/response for authentication
+// Implements login, token refresh, logout, password change and cookie session endpoints
+
+type AuthHandler struct {
+	authService    *services.AuthService
+	sessionService *services.SessionService
+	userService    *services.UserService
+	mfaService     *services.MFAService
+	lockoutService *services.LockoutService
+	secureCookies  bool
+}
+
+func NewAuthHandler(authService *services.AuthService, sessionService *services.SessionService, userService *services.UserService, mfaService *services.MFAService, lockoutService *services.LockoutService, secureCookies bool) *AuthHandler {
+	return &AuthHandler{
+		authService:    authService,
+		sessionService: sessionService,
+		userService:    userService,
+		mfaService:     mfaService,
+		lockoutService: lockoutService,
+		secureCookies:  secureCookies,
+	}
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP code or recovery code
+}
+
+type sessionResponse struct {
+	User          *models.User `json:"user"`
+	CSRFToken     string       `json:"csrf_token"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	IdleExpiresAt time.Time    `json:"idle_expires_at"`
+}
+
+// Log in with email and password to the organization given by org_id
+// Returns a token pair and also starts a cookie session for browser clients
+// Users with MFA enabled instead receive a challenge token for POST /auth/login/mfa
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orgID := creds.OrgID
+	if orgID == 0 {
+		orgID = OrgFromContext(r.Context())
+	}
+
+	ip := clientIP(r)
+	if err := h.lockoutService.Check(orgID, creds.Email, ip); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	user, err := h.authService.VerifyCredentials(orgID, creds.Email, creds.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			h.lockoutService.RecordFailure(orgID, creds.Email, ip)
+		}
+		writeAuthError(w, err)
+		return
+	}
+
+	if h.mfaService.IsEnabled(user.ID) {
+		token, err := h.authService.IssueMFAChallenge(user.ID, orgID)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, mfaChallengeResponse{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	h.lockoutService.RecordSuccess(orgID, user.Email)
+	h.completeLogin(w, user.ID, orgID, false)
+}
+
+// Complete a login with the challenge token and a second factor
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.authService.ValidateMFAChallenge(req.MFAToken)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	user, err := h.userService.GetUserByID(claims.Org, claims.Subject)
+	if err != nil {
+		writeAuthError(w, services.ErrInvalidToken)
+		return
+	}
+
+	ip := clientIP(r)
+	if err := h.lockoutService.Check(user.OrgID, user.Email, ip); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	if err := h.mfaService.Verify(user.ID, req.Code); err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			h.lockoutService.RecordFailure(user.OrgID, user.Email, ip)
+		}
+		writeAuthError(w, err)
+		return
+	}
+
+	h.lockoutService.RecordSuccess(user.OrgID, user.Email)
+	h.completeLogin(w, user.ID, user.OrgID, true)
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Revoke the given refresh token and end the current cookie session, if any
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	hasSession := principal != nil && principal.Session != nil
+	if req.RefreshToken == "" && !hasSession {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.authService.Logout(req.RefreshToken); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+	}
+	if hasSession {
+		if err := h.sessionService.Destroy(principal.Session); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.clearSessionCookies(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Describe the current cookie session
+func (h *AuthHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	principal := PrincipalFromContext(r.Context())
+	if principal == nil || principal.Session == nil {
+		http.Error(w, "no active session", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userService.GetUserByID(principal.OrgID, principal.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Re-issue the CSRF cookie in case the client lost it
+	session := principal.Session
+	h.setCSRFCookie(w, session)
+
+	writeJSON(w, http.StatusOK, sessionResponse{
+		User:          user,
+		CSRFToken:     session.CSRFToken,
+		CreatedAt:     session.CreatedAt,
+		ExpiresAt:     session.ExpiresAt,
+		IdleExpiresAt: h.sessionService.IdleDeadline(session),
+	})
+}
+
+// Issue tokens and a cookie session for an authenticated user
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, userID, orgID int, mfa bool) {
+	tokens, err := h.authService.IssueTokens(userID, orgID, mfa)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	value, session, err := h.sessionService.Create(userID, mfa)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	h.setCSRFCookie(w, session)
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// The CSRF cookie is readable by scripts so it can be echoed in the X-CSRF-Token header
+func (h *AuthHandler) setCSRFCookie(w http.ResponseWriter, session *models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    session.CSRFToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *AuthHandler) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{sessionCookieName, csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == sessionCookieName,
+			Secure:   h.secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// Change the caller's own password, given the current one
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if PrincipalFromContext(r.Context()).UserID != id {
+		http.Error(w, "cannot change another user's password", http.StatusForbidden)
+		return
+	}
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ChangePassword(OrgFromContext(r.Context()), id, req.CurrentPassword, req.NewPassword); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	// Cookie sessions end as well
+	if err := h.sessionService.DestroyAllForUser(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Address of the client making the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Map auth service errors onto HTTP status codes
+func writeAuthError(w http.ResponseWriter, err error) {
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		retryAfter := int(locked.RetryAfter.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrAccountInactive):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidToken),
+		errors.Is(err, services.ErrInvalidMFACode), errors.Is(err, services.ErrMFANotEnrolled):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, services.ErrInvalidPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrWrongPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"myapp/docs"
+	"net/http"
+)
+
+// Docs Handlers: Serves the OpenAPI document and the API reference page
+
+// Serve the OpenAPI document
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(docs.OpenAPI)
+}
+
+// Serve the Redoc reference page, which loads /openapi.json
+func APIReference(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docs.ReferencePage)
+}
@@ -0,0 +1,91 @@
+package gql
+
+import (
+	_ "embed"
+	"encoding/json"
+	"myapp/services"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// GraphQL Handler: Serves POST /graphql and, in development, the GraphiQL IDE
+// Responses follow GraphQL over HTTP: 200 with "data" and "errors", 400 for unreadable requests
+
+//go:embed graphiql.html
+var graphiQLPage []byte
+
+type Handler struct {
+	schema  graphql.Schema
+	devMode bool
+}
+
+// Create the handler; the schema is static, so failing to build it is a programming error
+func NewHandler(userService *services.UserService, devMode bool) *Handler {
+	schema, err := NewSchema(userService)
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+	return &Handler{schema: schema, devMode: devMode}
+}
+
+// Body of a GraphQL request
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Parse, check limits, validate and execute a query
+func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	writeResult(w, h.execute(r, req))
+}
+
+func (h *Handler) execute(r *http.Request, req Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if err := checkLimits(doc, req.Variables); err != nil {
+		limitErr := &gqlError{msg: err.Error(), code: "QUERY_TOO_COMPLEX"}
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: limitErr.msg, Extensions: limitErr.Extensions()}}}
+	}
+	if result := graphql.ValidateDocument(&h.schema, doc, nil); !result.IsValid {
+		return &graphql.Result{Errors: result.Errors}
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       r.Context(),
+	})
+}
+
+// Serve the GraphiQL IDE in development mode; other deployments answer 404
+func (h *Handler) GraphiQL(w http.ResponseWriter, r *http.Request) {
+	if !h.devMode {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(graphiQLPage)
+}
+
+func writeResult(w http.ResponseWriter, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,105 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Query Limits: Rejects queries too deep or too expensive to run, before they are validated
+// Every field costs 1, and the fields below a paginated field count once per requested item.
+// Introspection fields are exempt so tools like GraphiQL can load the schema.
+
+const (
+	MaxDepth      = 8
+	MaxComplexity = 1000
+)
+
+type limitChecker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	active    map[string]bool // Fragments being expanded, to stop on cycles
+}
+
+// Check every operation in doc against MaxDepth and MaxComplexity
+func checkLimits(doc *ast.Document, variables map[string]any) error {
+	c := &limitChecker{fragments: map[string]*ast.FragmentDefinition{}, variables: variables, active: map[string]bool{}}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			c.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, cost := c.measure(op.SelectionSet, 1)
+		if depth > MaxDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, MaxDepth)
+		}
+		if cost > MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit of %d", cost, MaxComplexity)
+		}
+	}
+	return nil
+}
+
+// Depth and cost of a selection set whose fields are at the given depth
+func (c *limitChecker) measure(set *ast.SelectionSet, depth int) (int, int) {
+	if set == nil {
+		return depth - 1, 0
+	}
+	maxDepth, cost := depth-1, 0
+	for _, selection := range set.Selections {
+		var d, n int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			d, n = c.measure(s.SelectionSet, depth+1)
+			n = 1 + n*c.multiplier(s)
+		case *ast.InlineFragment:
+			d, n = c.measure(s.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || c.active[name] {
+				continue // Reported by validation
+			}
+			c.active[name] = true
+			d, n = c.measure(fragment.SelectionSet, depth)
+			c.active[name] = false
+		}
+		maxDepth, cost = max(maxDepth, d), cost+n
+	}
+	return maxDepth, cost
+}
+
+// Paginated fields, whose "first" argument sets how many items they return
+var paginatedFields = map[string]bool{"users": true}
+
+// Number of items a field returns, capped at the page size limit the resolver enforces
+func (c *limitChecker) multiplier(field *ast.Field) int {
+	if !paginatedFields[field.Name.Value] {
+		return 1
+	}
+	n := defaultPageSize
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			n, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			if f, ok := c.variables[v.Name.Value].(float64); ok {
+				n = int(min(f, maxPageSize))
+			}
+		}
+	}
+	return max(1, min(n, maxPageSize))
+}
@@ -0,0 +1,477 @@
+package gql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"myapp/filter"
+	"myapp/handlers"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// GraphQL Schema: Types and resolvers for the /graphql endpoint
+// Resolvers delegate to the user service and apply the same role rules as the REST handlers
+
+// Page sizes for the users connection
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Error returned to clients, with a machine-readable code in its extensions
+type gqlError struct {
+	msg  string
+	code string
+}
+
+func (e *gqlError) Error() string {
+	return e.msg
+}
+
+func (e *gqlError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+func badInput(msg string) error {
+	return &gqlError{msg: msg, code: "BAD_USER_INPUT"}
+}
+
+// HTTP statuses used by the REST API and the matching error codes
+var statusCodes = map[int]string{
+	http.StatusBadRequest:   "BAD_USER_INPUT",
+	http.StatusUnauthorized: "UNAUTHENTICATED",
+	http.StatusForbidden:    "FORBIDDEN",
+	http.StatusNotFound:     "NOT_FOUND",
+	http.StatusConflict:     "CONFLICT",
+}
+
+// Map user service errors onto coded GraphQL errors
+func userError(err error) error {
+	code, ok := statusCodes[handlers.UserErrorStatus(err)]
+	if !ok {
+		code = "INTERNAL_SERVER_ERROR"
+	}
+	if errors.Is(err, repositories.ErrEmailTaken) {
+		code = "EMAIL_TAKEN"
+	}
+	return &gqlError{msg: err.Error(), code: code}
+}
+
+var (
+	errRoleAssignment  = &gqlError{msg: "only administrators can assign roles", code: "FORBIDDEN"}
+	errUnauthenticated = &gqlError{msg: "authentication required", code: "UNAUTHENTICATED"}
+	errOtherUser       = &gqlError{msg: "cannot modify another user", code: "FORBIDDEN"}
+)
+
+// Check that the caller is the user or an administrator before changing a user
+func authorizeUserWrite(ctx context.Context, id int) error {
+	principal := handlers.PrincipalFromContext(ctx)
+	if principal == nil {
+		return errUnauthenticated
+	}
+	if !principal.CanManageUser(id) {
+		return errOtherUser
+	}
+	return nil
+}
+
+// Arbitrary JSON value, used for custom attributes
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "Any JSON value",
+	Serialize:    func(value any) any { return value },
+	ParseValue:   func(value any) any { return value },
+	ParseLiteral: literalValue,
+})
+
+// Convert an inline literal to the value it would have been as a JSON variable
+func literalValue(value ast.Value) any {
+	switch v := value.(type) {
+	case *ast.StringValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.IntValue:
+		n, _ := strconv.ParseFloat(v.Value, 64)
+		return n
+	case *ast.FloatValue:
+		n, _ := strconv.ParseFloat(v.Value, 64)
+		return n
+	case *ast.EnumValue:
+		return v.Value
+	case *ast.ListValue:
+		list := make([]any, len(v.Values))
+		for i, item := range v.Values {
+			list[i] = literalValue(item)
+		}
+		return list
+	case *ast.ObjectValue:
+		object := map[string]any{}
+		for _, field := range v.Fields {
+			object[field.Name.Value] = literalValue(field.Value)
+		}
+		return object
+	}
+	return nil
+}
+
+// Resolve a field of the *models.User being resolved
+func userField(get func(u *models.User) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(*models.User)), nil
+	}
+}
+
+var userStatusType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "UserStatus",
+	Description: "Account state together with why and when it last changed",
+	Fields: graphql.Fields{
+		"state": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "pending, active, suspended or deactivated",
+			Resolve:     userField(func(u *models.User) any { return u.Status }),
+		},
+		"reason": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: userField(func(u *models.User) any { return u.StatusReason }),
+		},
+		"changedAt": &graphql.Field{
+			Type: graphql.DateTime,
+			Resolve: userField(func(u *models.User) any {
+				if u.StatusChangedAt == nil {
+					return nil
+				}
+				return *u.StatusChangedAt
+			}),
+		},
+	},
+})
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.ID),
+			Resolve: userField(func(u *models.User) any { return u.ID }),
+		},
+		"name": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.User) any { return u.Name }),
+		},
+		"email": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.User) any { return u.Email }),
+		},
+		"emailVerified": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Boolean),
+			Resolve: userField(func(u *models.User) any { return u.EmailVerifiedAt != nil }),
+		},
+		"role": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: userField(func(u *models.User) any { return u.Role }),
+		},
+		"status": &graphql.Field{
+			Type:    graphql.NewNonNull(userStatusType),
+			Resolve: userField(func(u *models.User) any { return u }),
+		},
+		"tags": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: userField(func(u *models.User) any {
+				if u.Tags == nil {
+					return []string{}
+				}
+				return u.Tags
+			}),
+		},
+		"attributes": &graphql.Field{
+			Type:        graphql.NewNonNull(jsonScalar),
+			Description: "Custom attributes described by the attribute schema",
+			Resolve: userField(func(u *models.User) any {
+				if u.Attributes == nil {
+					return map[string]any{}
+				}
+				return u.Attributes
+			}),
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: userField(func(u *models.User) any { return u.CreatedAt }),
+		},
+		"updatedAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: userField(func(u *models.User) any { return u.UpdatedAt }),
+		},
+	},
+})
+
+// Relay connection types; the default resolver reads their fields from maps
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var userEdgeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserEdge",
+	Fields: graphql.Fields{
+		"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"node":   &graphql.Field{Type: graphql.NewNonNull(userType)},
+	},
+})
+
+var userConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserConnection",
+	Fields: graphql.Fields{
+		"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userEdgeType)))},
+		"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+	},
+})
+
+func userInputType(name string, password bool) *graphql.InputObject {
+	text := graphql.NewNonNull(graphql.String)
+	fields := graphql.InputObjectConfigFieldMap{
+		"name":       &graphql.InputObjectFieldConfig{Type: text},
+		"email":      &graphql.InputObjectFieldConfig{Type: text},
+		"role":       &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Only administrators can assign roles"},
+		"attributes": &graphql.InputObjectFieldConfig{Type: jsonScalar},
+	}
+	if password {
+		fields["password"] = &graphql.InputObjectFieldConfig{Type: graphql.String}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+}
+
+// Omitted role and attributes keep their current values on update
+// Passwords are changed with POST /users/{id}/password, which checks the current one
+var (
+	createUserInputType = userInputType("CreateUserInput", true)
+	updateUserInputType = userInputType("UpdateUserInput", false)
+)
+
+type resolver struct {
+	userService *services.UserService
+}
+
+// Build the schema with resolvers backed by userService
+func NewSchema(userService *services.UserService) (graphql.Schema, error) {
+	r := &resolver{userService: userService}
+	id := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type:        userType,
+					Description: "A user by ID, or null if there is none",
+					Args:        graphql.FieldConfigArgument{"id": id},
+					Resolve:     r.user,
+				},
+				"users": &graphql.Field{
+					Type:        graphql.NewNonNull(userConnectionType),
+					Description: "Users in ID order, a page at a time",
+					Args: graphql.FieldConfigArgument{
+						"filter": &graphql.ArgumentConfig{Type: graphql.String, Description: `Filter expression, e.g. name co "ann"`},
+						"status": &graphql.ArgumentConfig{Type: graphql.String},
+						"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize, Description: "Page size, at most 100"},
+						"after":  &graphql.ArgumentConfig{Type: graphql.String, Description: "endCursor of the previous page"},
+					},
+					Resolve: r.users,
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"createUser": &graphql.Field{
+					Type:    graphql.NewNonNull(userType),
+					Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createUserInputType)}},
+					Resolve: r.createUser,
+				},
+				"updateUser": &graphql.Field{
+					Type: graphql.NewNonNull(userType),
+					Args: graphql.FieldConfigArgument{
+						"id":    id,
+						"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateUserInputType)},
+					},
+					Resolve: r.updateUser,
+				},
+				"deleteUser": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.ID),
+					Description: "Delete a user, returning its ID",
+					Args:        graphql.FieldConfigArgument{"id": id},
+					Resolve:     r.deleteUser,
+				},
+			},
+		}),
+	})
+}
+
+func (r *resolver) user(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userService.GetUserByID(handlers.OrgFromContext(p.Context), id)
+	if err != nil {
+		if handlers.UserErrorStatus(err) == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, userError(err)
+	}
+	return user, nil
+}
+
+func (r *resolver) users(p graphql.ResolveParams) (any, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxPageSize {
+		return nil, badInput("first must be between 1 and " + strconv.Itoa(maxPageSize))
+	}
+	// One extra row tells whether another page follows
+	criteria := models.UserFilter{Limit: first + 1}
+	criteria.Status, _ = p.Args["status"].(string)
+	if expr, _ := p.Args["filter"].(string); expr != "" {
+		parsed, err := filter.Parse(expr)
+		if err != nil {
+			return nil, badInput(err.Error())
+		}
+		criteria.Expression = parsed
+	}
+	after, _ := p.Args["after"].(string)
+	if after != "" {
+		id, ok := decodeCursor(after)
+		if !ok {
+			return nil, badInput("invalid cursor")
+		}
+		criteria.AfterID = id
+	}
+
+	users, err := r.userService.GetAllUsers(handlers.OrgFromContext(p.Context), criteria)
+	if err != nil {
+		return nil, userError(err)
+	}
+	hasNext := len(users) > first
+	if hasNext {
+		users = users[:first]
+	}
+
+	edges := make([]map[string]any, len(users))
+	for i := range users {
+		edges[i] = map[string]any{"cursor": encodeCursor(users[i].ID), "node": &users[i]}
+	}
+	pageInfo := map[string]any{"hasNextPage": hasNext, "hasPreviousPage": after != ""}
+	if len(edges) > 0 {
+		pageInfo["startCursor"] = edges[0]["cursor"]
+		pageInfo["endCursor"] = edges[len(edges)-1]["cursor"]
+	}
+	return map[string]any{"edges": edges, "pageInfo": pageInfo}, nil
+}
+
+func (r *resolver) createUser(p graphql.ResolveParams) (any, error) {
+	input := p.Args["input"].(map[string]any)
+	user := userFromInput(handlers.OrgFromContext(p.Context), 0, input)
+	if user.Role != "" && user.Role != models.RoleUser && !handlers.PrincipalFromContext(p.Context).IsAdmin() {
+		return nil, errRoleAssignment
+	}
+	if err := r.userService.CreateUser(user); err != nil {
+		return nil, userError(err)
+	}
+	return r.reload(p.Context, user.ID)
+}
+
+func (r *resolver) updateUser(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUserWrite(p.Context, id); err != nil {
+		return nil, err
+	}
+	orgID := handlers.OrgFromContext(p.Context)
+	user := userFromInput(orgID, id, p.Args["input"].(map[string]any))
+	if user.Role != "" && !handlers.PrincipalFromContext(p.Context).IsAdmin() {
+		existing, err := r.userService.GetUserByID(orgID, id)
+		if err != nil {
+			return nil, userError(err)
+		}
+		if existing.Role != user.Role {
+			return nil, errRoleAssignment
+		}
+	}
+	if err := r.userService.UpdateUser(user); err != nil {
+		return nil, userError(err)
+	}
+	return r.reload(p.Context, id)
+}
+
+func (r *resolver) deleteUser(p graphql.ResolveParams) (any, error) {
+	id, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUserWrite(p.Context, id); err != nil {
+		return nil, err
+	}
+	if err := r.userService.DeleteUser(handlers.OrgFromContext(p.Context), id); err != nil {
+		return nil, userError(err)
+	}
+	return id, nil
+}
+
+// Load a user after a write, so the response shows stored values such as timestamps and tags
+func (r *resolver) reload(ctx context.Context, id int) (*models.User, error) {
+	user, err := r.userService.GetUserByID(handlers.OrgFromContext(ctx), id)
+	if err != nil {
+		return nil, userError(err)
+	}
+	return user, nil
+}
+
+func userFromInput(orgID, id int, input map[string]any) *models.User {
+	user := &models.User{ID: id, OrgID: orgID}
+	user.Name, _ = input["name"].(string)
+	user.Email, _ = input["email"].(string)
+	user.Password, _ = input["password"].(string)
+	user.Role, _ = input["role"].(string)
+	user.Attributes, _ = input["attributes"].(map[string]any)
+	return user
+}
+
+func parseID(value any) (int, error) {
+	s, _ := value.(string)
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 || id > math.MaxInt32 {
+		return 0, badInput("invalid user ID")
+	}
+	return id, nil
+}
+
+// Cursors are opaque to clients; they encode the ID of the edge's user
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("user:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	s, ok := strings.CutPrefix(string(b), "user:")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(s)
+	return id, err == nil && id > 0
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Group Handlers: Manages HTTP request/response for groups and memberships
+// Anyone can read groups; administrators manage them and their members
+
+type GroupHandler struct {
+	groupService *services.GroupService
+}
+
+func NewGroupHandler(groupService *services.GroupService) *GroupHandler {
+	return &GroupHandler{groupService: groupService}
+}
+
+type addMemberRequest struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func (h *GroupHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupService.List(OrgFromContext(r.Context()))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// Get a group together with its members
+func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.groupService.Get(OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, group)
+}
+
+// Create a group (admin only)
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var group models.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.Members = nil
+	group.OrgID = OrgFromContext(r.Context())
+
+	if err := h.groupService.Create(&group); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, group)
+}
+
+// Rename a group or change its description (admin only)
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var group models.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.ID = id
+	group.OrgID = OrgFromContext(r.Context())
+
+	if err := h.groupService.Update(&group); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Delete a group and its memberships (admin only)
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groupService.Delete(OrgFromContext(r.Context()), id); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Add a user to a group or change their member role (admin only)
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var req addMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.groupService.AddMember(OrgFromContext(r.Context()), id, req.UserID, req.Role)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, group)
+}
+
+// Remove a user from a group (admin only)
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(params["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groupService.RemoveMember(OrgFromContext(r.Context()), id, userID); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List the groups a user belongs to
+func (h *GroupHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.groupService.ListForUser(OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// Map group service errors onto HTTP status codes
+func writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrNameRequired), errors.Is(err, services.ErrInvalidGroupRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repositories.ErrGroupNameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
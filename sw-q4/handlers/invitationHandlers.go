@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Invitation Handlers: Manages HTTP request/response for user invitations
+// Administrators invite, resend and revoke; invitees accept with their token
+
+type InvitationHandler struct {
+	invitationService *services.InvitationService
+}
+
+func NewInvitationHandler(invitationService *services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitationService: invitationService}
+}
+
+type inviteRequest struct {
+	Email      string         `json:"email"`
+	Role       string         `json:"role"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+type acceptInvitationRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// Invite a new user (admin only)
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req inviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	inv, err := h.invitationService.Invite(OrgFromContext(r.Context()), req.Email, req.Role, req.Attributes, principal.UserID)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, inv)
+}
+
+// List invitations, optionally filtered by ?status= (admin only)
+func (h *InvitationHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.invitationService.List(OrgFromContext(r.Context()), r.URL.Query().Get("status"))
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invitations)
+}
+
+// Accept an invitation with the emailed token
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req acceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.invitationService.Accept(mux.Vars(r)["token"], req.Name, req.Password)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Email a fresh invite token (admin only)
+func (h *InvitationHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.invitationService.Resend(OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// Revoke an invitation (admin only)
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.invitationService.Revoke(OrgFromContext(r.Context()), id); err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map invitation service errors onto HTTP status codes
+func writeInvitationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrNameRequired),
+		errors.Is(err, services.ErrEmailRequired), errors.Is(err, services.ErrInvalidAttribute):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvitationClosed), errors.Is(err, repositories.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// MFA Handlers: Manages HTTP request/response for TOTP enrollment
+// Users enroll themselves; administrators can reset another user's enrollment
+
+type MFAHandler struct {
+	mfaService *services.MFAService
+}
+
+func NewMFAHandler(mfaService *services.MFAService) *MFAHandler {
+	return &MFAHandler{mfaService: mfaService}
+}
+
+type mfaConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Start enrollment for the current user
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	principal := PrincipalFromContext(r.Context())
+
+	enrollment, err := h.mfaService.Enroll(principal.OrgID, principal.UserID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+// Confirm enrollment with a first code and receive recovery codes
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	principal := PrincipalFromContext(r.Context())
+
+	var req mfaConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaService.Confirm(principal.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaConfirmResponse{RecoveryCodes: codes})
+}
+
+// Remove a user's enrollment (admin only)
+func (h *MFAHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.Reset(OrgFromContext(r.Context()), id); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map MFA service errors onto HTTP status codes
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrMFANotEnrolled), errors.Is(err, services.ErrInvalidMFACode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware: Resolves the authenticated principal and tenant, enforces CSRF protection
+// and marks deprecated routes
+// Requests authenticate with a Bearer access token or a session cookie
+
+const (
+	sessionCookieName = "session_id"
+	csrfCookieName    = "csrf_token"
+	csrfHeaderName    = "X-CSRF-Token"
+	orgHeaderName     = "X-Org-ID"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	orgKey
+)
+
+// Principal describes who is making the current request
+type Principal struct {
+	UserID  int
+	OrgID   int // Organization the user belongs to
+	Role    string
+	MFA     bool            // Whether the login completed a second factor
+	Session *models.Session // Set only when authenticated by session cookie
+}
+
+// Administrators only act with admin privileges after a second factor
+func (p *Principal) IsAdmin() bool {
+	return p != nil && p.Role == models.RoleAdmin && p.MFA
+}
+
+// Users may change their own account; administrators may change any user of the organization
+func (p *Principal) CanManageUser(userID int) bool {
+	return p != nil && (p.UserID == userID || p.IsAdmin())
+}
+
+// Administrators of the default organization operate the deployment and may act in any organization
+func (p *Principal) IsPlatformAdmin() bool {
+	return p.IsAdmin() && p.OrgID == models.DefaultOrgID
+}
+
+// Return the organization the request acts in
+// Requests that did not pass through the Authenticator act in the default organization
+func OrgFromContext(ctx context.Context) int {
+	if orgID, ok := ctx.Value(orgKey).(int); ok {
+		return orgID
+	}
+	return models.DefaultOrgID
+}
+
+// Return the principal attached to the request context, or nil if anonymous
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
+
+type Authenticator struct {
+	authService    *services.AuthService
+	sessionService *services.SessionService
+	userService    *services.UserService
+	orgService     *services.OrganizationService
+}
+
+func NewAuthenticator(authService *services.AuthService, sessionService *services.SessionService, userService *services.UserService, orgService *services.OrganizationService) *Authenticator {
+	return &Authenticator{authService: authService, sessionService: sessionService, userService: userService, orgService: orgService}
+}
+
+// AuthError is an authentication failure and the HTTP status it maps to
+type AuthError struct {
+	Status int
+	Msg    string
+}
+
+func (e *AuthError) Error() string {
+	return e.Msg
+}
+
+// Attach the principal and organization to the request context
+// An invalid Bearer token is rejected; an invalid session cookie is ignored
+// Requests act in the principal's organization, or the default one when anonymous;
+// platform administrators may select another organization with the X-Org-ID header
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.bearerPrincipal(r.Header.Get("Authorization"))
+		if err != nil {
+			http.Error(w, err.Msg, err.Status)
+			return
+		}
+		if principal == nil {
+			if cookie, err := r.Cookie(sessionCookieName); err == nil {
+				if session, err := a.sessionService.Validate(cookie.Value); err == nil {
+					principal = &Principal{UserID: session.UserID, OrgID: session.OrgID, MFA: session.MFA, Session: session}
+				}
+			}
+		}
+
+		ctx, err := a.authorize(r.Context(), principal, r.Header.Get(orgHeaderName))
+		if err != nil {
+			http.Error(w, err.Msg, err.Status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticate a call from another transport, given its Authorization and X-Org-ID values
+// Returns ctx carrying the principal and organization, or an *AuthError
+func (a *Authenticator) Authenticate(ctx context.Context, authorization, orgHeader string) (context.Context, error) {
+	principal, err := a.bearerPrincipal(authorization)
+	if err != nil {
+		return ctx, err
+	}
+	ctx, err = a.authorize(ctx, principal, orgHeader)
+	if err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// Principal for an Authorization header value, nil when the header is empty
+func (a *Authenticator) bearerPrincipal(header string) (*Principal, *AuthError) {
+	if header == "" {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, &AuthError{http.StatusUnauthorized, "unsupported authorization scheme"}
+	}
+	claims, err := a.authService.ValidateAccessToken(token)
+	if err != nil {
+		return nil, &AuthError{http.StatusUnauthorized, err.Error()}
+	}
+	return &Principal{UserID: claims.Subject, OrgID: claims.Org, MFA: claims.MFA}, nil
+}
+
+// Load the principal's current role and pick the organization to act in, returning ctx carrying both
+func (a *Authenticator) authorize(ctx context.Context, principal *Principal, orgHeader string) (context.Context, *AuthError) {
+	// Load the current role; credentials of deleted or inactive users no longer authenticate
+	orgID := models.DefaultOrgID
+	if principal != nil {
+		user, err := a.userService.GetUserByID(principal.OrgID, principal.UserID)
+		if err != nil {
+			return ctx, &AuthError{http.StatusUnauthorized, "user no longer exists"}
+		}
+		if user.Status != models.StatusActive {
+			return ctx, &AuthError{http.StatusUnauthorized, services.ErrAccountInactive.Error()}
+		}
+		principal.Role = user.Role
+		orgID = principal.OrgID
+
+		ctx = context.WithValue(ctx, principalKey, principal)
+	}
+
+	if orgHeader != "" {
+		requested, err := strconv.Atoi(orgHeader)
+		if err != nil {
+			return ctx, &AuthError{http.StatusBadRequest, "invalid " + orgHeaderName + " header"}
+		}
+		if requested != orgID {
+			if !principal.IsPlatformAdmin() {
+				return ctx, &AuthError{http.StatusForbidden, "cannot act in another organization"}
+			}
+			if _, err := a.orgService.Get(requested); err != nil {
+				return ctx, &AuthError{http.StatusNotFound, err.Error()}
+			}
+			orgID = requested
+		}
+	}
+
+	return context.WithValue(ctx, orgKey, orgID), nil
+}
+
+// Reject anonymous requests
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if PrincipalFromContext(r.Context()) == nil {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reject requests not made by an administrator who completed a second factor
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := PrincipalFromContext(r.Context())
+		switch {
+		case principal == nil:
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+		case principal.Role != models.RoleAdmin:
+			http.Error(w, "administrator access required", http.StatusForbidden)
+		case !principal.MFA:
+			http.Error(w, "administrator access requires multi-factor authentication", http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Reject requests not made by an administrator of the default organization
+func RequirePlatformAdmin(next http.Handler) http.Handler {
+	return RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !PrincipalFromContext(r.Context()).IsPlatformAdmin() {
+			http.Error(w, "platform administrator access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// Require a matching double-submit CSRF token on unsafe requests made with a session cookie
+// Bearer-authenticated and anonymous requests carry no ambient credentials and pass through
+func RequireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := PrincipalFromContext(r.Context())
+		if principal != nil && principal.Session != nil && !isSafeMethod(r.Method) {
+			header := r.Header.Get(csrfHeaderName)
+			cookie, err := r.Cookie(csrfCookieName)
+			if err != nil || header == "" ||
+				subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(header), []byte(principal.Session.CSRFToken)) != 1 {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Mark responses as served by a deprecated alias, pointing clients at the same path under successor
+// Deprecation follows RFC 9745 and Sunset RFC 8594
+func Deprecated(since, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successor, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
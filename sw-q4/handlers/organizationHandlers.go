@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+)
+
+// Organization Handlers: Manages HTTP request/response for tenants
+// Only platform administrators can list and create organizations
+
+type OrganizationHandler struct {
+	orgService *services.OrganizationService
+}
+
+func NewOrganizationHandler(orgService *services.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{orgService: orgService}
+}
+
+func (h *OrganizationHandler) GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.orgService.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orgs)
+}
+
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var org models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgService.Create(&org); err != nil {
+		switch {
+		case errors.Is(err, services.ErrNameRequired), errors.Is(err, services.ErrInvalidSlug):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repositories.ErrSlugTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, org)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Response Helpers: Shared helpers for writing HTTP responses
+
+// Encode a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Encode a JSON object, or array of objects, keeping only the given keys
+// Writes v unchanged when fields is empty
+func writeProjectedJSON(w http.ResponseWriter, status int, v any, fields []string) {
+	if len(fields) == 0 {
+		writeJSON(w, status, v)
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal(b, &list); err == nil {
+		for i := range list {
+			list[i] = project(list[i], fields)
+		}
+		writeJSON(w, status, list)
+		return
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, project(object, fields))
+}
+
+func project(object map[string]json.RawMessage, fields []string) map[string]json.RawMessage {
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := object[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,161 @@
+package scim
+
+// SCIM Discovery: The ServiceProviderConfig, ResourceTypes and Schemas documents (RFC 7643 sections 5-7)
+// They describe what this service provider supports, so identity providers can adapt to it
+
+// Largest page a list request returns, and the page size when count is not given
+const MaxResults = 100
+
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	DocumentationURI      string                 `json:"documentationUri,omitempty"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	ETag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type ResourceType struct {
+	Schemas  []string `json:"schemas"`
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Endpoint string   `json:"endpoint"`
+	Schema   string   `json:"schema"`
+	Meta     Meta     `json:"meta"`
+}
+
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        Meta        `json:"meta"`
+}
+
+// Definition of an attribute; unset characteristics take their RFC 7643 defaults
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+// A readWrite string attribute returned by default
+func stringAttribute(name string) Attribute {
+	return Attribute{Name: name, Type: "string", Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+}
+
+// A multi-valued complex attribute with value, display, type and primary sub-attributes
+func multiValuedAttribute(name, mutability string) Attribute {
+	attribute := Attribute{Name: name, Type: "complex", MultiValued: true, Mutability: mutability, Returned: "default", Uniqueness: "none"}
+	for _, sub := range []string{"value", "display", "type"} {
+		s := stringAttribute(sub)
+		s.Mutability = mutability
+		attribute.SubAttributes = append(attribute.SubAttributes, s)
+	}
+	attribute.SubAttributes = append(attribute.SubAttributes,
+		Attribute{Name: "primary", Type: "boolean", Mutability: mutability, Returned: "default", Uniqueness: "none"})
+	return attribute
+}
+
+var serviceProviderConfig = ServiceProviderConfig{
+	Schemas:        []string{ServiceConfigSchema},
+	Patch:          Supported{Supported: true},
+	Bulk:           BulkSupport{Supported: false},
+	Filter:         FilterSupport{Supported: true, MaxResults: MaxResults},
+	ChangePassword: Supported{Supported: true},
+	Sort:           Supported{Supported: false},
+	ETag:           Supported{Supported: false},
+	AuthenticationSchemes: []AuthenticationScheme{{
+		Type:        "oauthbearertoken",
+		Name:        "Bearer access token",
+		Description: "An access token of an administrator who completed multi-factor authentication",
+		Primary:     true,
+	}},
+	Meta: Meta{ResourceType: "ServiceProviderConfig", Location: BasePath + "/ServiceProviderConfig"},
+}
+
+var resourceTypes = []ResourceType{
+	{
+		Schemas:  []string{ResourceTypeSchema},
+		ID:       "User",
+		Name:     "User",
+		Endpoint: "/Users",
+		Schema:   UserSchema,
+		Meta:     Meta{ResourceType: "ResourceType", Location: BasePath + "/ResourceTypes/User"},
+	},
+	{
+		Schemas:  []string{ResourceTypeSchema},
+		ID:       "Group",
+		Name:     "Group",
+		Endpoint: "/Groups",
+		Schema:   GroupSchema,
+		Meta:     Meta{ResourceType: "ResourceType", Location: BasePath + "/ResourceTypes/Group"},
+	},
+}
+
+var schemas = func() []Schema {
+	userName := stringAttribute("userName")
+	userName.Required = true
+	userName.Uniqueness = "server"
+	name := Attribute{Name: "name", Type: "complex", Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+		SubAttributes: []Attribute{stringAttribute("formatted"), stringAttribute("givenName"), stringAttribute("familyName")}}
+	password := stringAttribute("password")
+	password.Mutability = "writeOnly"
+	password.Returned = "never"
+	active := Attribute{Name: "active", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+	groupName := stringAttribute("displayName")
+	groupName.Required = true
+
+	return []Schema{
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          UserSchema,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []Attribute{userName, name, stringAttribute("displayName"), multiValuedAttribute("emails", "readWrite"),
+				active, password, multiValuedAttribute("roles", "readWrite"), multiValuedAttribute("groups", "readOnly")},
+			Meta: Meta{ResourceType: "Schema", Location: BasePath + "/Schemas/" + UserSchema},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          GroupSchema,
+			Name:        "Group",
+			Description: "Group",
+			Attributes:  []Attribute{groupName, multiValuedAttribute("members", "readWrite")},
+			Meta:        Meta{ResourceType: "Schema", Location: BasePath + "/Schemas/" + GroupSchema},
+		},
+	}
+}()
@@ -0,0 +1,99 @@
+package scim
+
+import (
+	"myapp/filter"
+	"strconv"
+	"strings"
+)
+
+// SCIM Filters: Maps SCIM attribute paths in ?filter= onto the fields of the shared filter language
+// The syntax is the same, so filters are parsed with filter.Parse and rewritten field by field.
+// Attribute names are case-insensitive; complex filters such as emails[type eq "work"] are not supported.
+
+// Filterable User attributes, lowercased, and the user filter field each maps to
+var userAttributes = map[string]string{
+	"id":                "id",
+	"username":          "email",
+	"emails":            "email",
+	"emails.value":      "email",
+	"displayname":       "name",
+	"name.formatted":    "name",
+	"roles":             "role",
+	"roles.value":       "role",
+	"active":            "status",
+	"meta.created":      "created_at",
+	"meta.lastmodified": "updated_at",
+}
+
+// Filterable Group attributes, lowercased, and the group filter field each maps to
+var groupAttributes = map[string]string{
+	"id":           "id",
+	"displayname":  "name",
+	"meta.created": "created_at",
+}
+
+// Parse a SCIM filter and rewrite it onto the fields in attributes
+func parseFilter(input string, attributes map[string]string) (filter.Expr, error) {
+	expr, err := filter.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return translateFilter(expr, attributes)
+}
+
+func translateFilter(expr filter.Expr, attributes map[string]string) (filter.Expr, error) {
+	switch e := expr.(type) {
+	case *filter.Logical:
+		left, err := translateFilter(e.Left, attributes)
+		if err != nil {
+			return nil, err
+		}
+		right, err := translateFilter(e.Right, attributes)
+		if err != nil {
+			return nil, err
+		}
+		return &filter.Logical{Op: e.Op, Left: left, Right: right}, nil
+	case *filter.Not:
+		inner, err := translateFilter(e.Expr, attributes)
+		if err != nil {
+			return nil, err
+		}
+		return &filter.Not{Expr: inner}, nil
+	case *filter.Comparison:
+		return translateComparison(e, attributes)
+	}
+	panic("unknown filter expression")
+}
+
+func translateComparison(c *filter.Comparison, attributes map[string]string) (filter.Expr, error) {
+	field, ok := attributes[strings.ToLower(c.Field)]
+	if !ok {
+		return nil, c.FieldError("unsupported attribute")
+	}
+	out := *c
+	out.Field = field
+
+	switch {
+	case field == "status" && c.Op != filter.OpPresent:
+		// active is a boolean view of the account status
+		active, ok := c.Value.(bool)
+		if !ok || (c.Op != filter.OpEq && c.Op != filter.OpNe) {
+			return nil, c.ValueError("active can only be compared with eq or ne and true or false")
+		}
+		out.Value = "active"
+		out.Op = filter.OpNe
+		if active == (c.Op == filter.OpEq) {
+			out.Op = filter.OpEq
+		}
+	case field == "id":
+		// SCIM IDs are strings, stored IDs are numbers
+		if s, ok := c.Value.(string); ok {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, c.ValueError("invalid id")
+			}
+			out.Value = float64(id)
+		}
+	}
+	return &out, nil
+}
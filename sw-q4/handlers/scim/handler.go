@@ -0,0 +1,516 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/filter"
+	"myapp/handlers"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// SCIM Handler: Serves the SCIM 2.0 provisioning API (RFC 7644) under /scim/v2
+// Users and Groups map onto the user and group services and act in the caller's organization.
+// Discovery endpoints are public; resource endpoints require an administrator.
+
+// Media type of every SCIM response
+const ContentType = "application/scim+json"
+
+// Reason recorded when a provider changes active
+const statusReason = "Changed through SCIM"
+
+type Handler struct {
+	userService  *services.UserService
+	groupService *services.GroupService
+}
+
+func NewHandler(userService *services.UserService, groupService *services.GroupService) *Handler {
+	return &Handler{userService: userService, groupService: groupService}
+}
+
+// A request the provider has to fix, with the scimType describing why
+type requestError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *requestError) Error() string {
+	return e.detail
+}
+
+func badRequest(scimType, detail string) *requestError {
+	return &requestError{status: http.StatusBadRequest, scimType: scimType, detail: detail}
+}
+
+var errUserNotFound = &requestError{status: http.StatusNotFound, detail: "user not found"}
+var errGroupNotFound = &requestError{status: http.StatusNotFound, detail: "group not found"}
+
+// Reject requests not made by an administrator who completed a second factor, with SCIM error bodies
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := handlers.PrincipalFromContext(r.Context())
+		switch {
+		case principal == nil:
+			writeError(w, http.StatusUnauthorized, "", "authentication required")
+		case !principal.IsAdmin():
+			writeError(w, http.StatusForbidden, "", "administrator access with multi-factor authentication required")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (h *Handler) GetServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, http.StatusOK, serviceProviderConfig)
+}
+
+func (h *Handler) GetResourceTypes(w http.ResponseWriter, r *http.Request) {
+	writeList(w, resourceTypes, len(resourceTypes), 1)
+}
+
+func (h *Handler) GetResourceType(w http.ResponseWriter, r *http.Request) {
+	i := slices.IndexFunc(resourceTypes, func(t ResourceType) bool { return t.ID == mux.Vars(r)["id"] })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "", "resource type not found")
+		return
+	}
+	writeResource(w, http.StatusOK, resourceTypes[i])
+}
+
+func (h *Handler) GetSchemas(w http.ResponseWriter, r *http.Request) {
+	writeList(w, schemas, len(schemas), 1)
+}
+
+func (h *Handler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	i := slices.IndexFunc(schemas, func(s Schema) bool { return s.ID == mux.Vars(r)["id"] })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "", "schema not found")
+		return
+	}
+	writeResource(w, http.StatusOK, schemas[i])
+}
+
+// List users, optionally filtered, one page at a time
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	start, count, err := parsePage(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	criteria := models.UserFilter{Offset: start - 1, Limit: count}
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		if criteria.Expression, err = parseFilter(expr, userAttributes); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+
+	orgID := handlers.OrgFromContext(r.Context())
+	total, err := h.userService.CountUsers(orgID, criteria)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	// A count of 0 only asks for totalResults; a zero Limit would load every user
+	var users []models.User
+	if count > 0 {
+		if users, err = h.userService.GetAllUsers(orgID, criteria); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+
+	resources := make([]User, len(users))
+	for i := range users {
+		if resources[i], err = h.userResource(orgID, &users[i]); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+	writeList(w, resources, total, start)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	orgID := handlers.OrgFromContext(r.Context())
+	user, err := h.loadUser(orgID, mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resource, err := h.userResource(orgID, user)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, resource)
+}
+
+// Provision a user; a user created with active false is stored deactivated
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req User
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+	if req.email() == "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidValue, "userName is required")
+		return
+	}
+
+	orgID := handlers.OrgFromContext(r.Context())
+	user := req.toModel(orgID, 0)
+	status := activeStatus(req.Active)
+	if status == "" {
+		status = models.StatusActive
+	}
+	actorID := handlers.PrincipalFromContext(r.Context()).UserID
+	if err := h.userService.CreateUserWithStatus(user, status, statusReason, actorID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	created, err := h.userService.GetUserByID(orgID, user.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resource, err := h.userResource(orgID, created)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", resource.Meta.Location)
+	writeResource(w, http.StatusCreated, resource)
+}
+
+// Replace a user; an omitted password or role keeps its current value
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	orgID := handlers.OrgFromContext(r.Context())
+	existing, err := h.loadUser(orgID, mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var req User
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+
+	h.saveUser(w, r, existing.ID, &req)
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	orgID := handlers.OrgFromContext(r.Context())
+	existing, err := h.loadUser(orgID, mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var req PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+
+	user := NewUser(existing, nil)
+	if err := user.applyPatch(req.Operations); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.saveUser(w, r, existing.ID, &user)
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	orgID := handlers.OrgFromContext(r.Context())
+	user, err := h.loadUser(orgID, mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := h.userService.DeleteUser(orgID, user.ID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List groups, optionally filtered, one page at a time
+// Members are left out when excludedAttributes names them
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	start, count, err := parsePage(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	var expr filter.Expr
+	if input := query.Get("filter"); input != "" {
+		if expr, err = parseFilter(input, groupAttributes); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+	withMembers := !slices.ContainsFunc(strings.Split(query.Get("excludedAttributes"), ","), func(a string) bool {
+		return strings.EqualFold(strings.TrimSpace(a), "members")
+	})
+
+	orgID := handlers.OrgFromContext(r.Context())
+	groups, err := h.groupService.Find(orgID, expr)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	page := paginate(groups, start, count)
+	resources := make([]Group, len(page))
+	for i := range page {
+		group := &page[i]
+		if withMembers {
+			if group, err = h.groupService.Get(orgID, group.ID); err != nil {
+				writeServiceError(w, err)
+				return
+			}
+		}
+		resources[i] = NewGroup(group)
+	}
+	writeList(w, resources, len(groups), start)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.loadGroup(handlers.OrgFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, NewGroup(group))
+}
+
+// Create a group with its members; nothing is created if a member is not a user
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req Group
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+	members, err := req.memberIDs()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	orgID := handlers.OrgFromContext(r.Context())
+	created, err := h.groupService.Save(&models.Group{OrgID: orgID, Name: req.DisplayName}, members)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resource := NewGroup(created)
+	w.Header().Set("Location", resource.Meta.Location)
+	writeResource(w, http.StatusCreated, resource)
+}
+
+// Replace a group's name and members
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	existing, err := h.loadGroup(handlers.OrgFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var req Group
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+
+	h.saveGroup(w, existing, &req)
+}
+
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	existing, err := h.loadGroup(handlers.OrgFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var req PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSyntax, err.Error())
+		return
+	}
+
+	group := NewGroup(existing)
+	if err := group.applyPatch(req.Operations); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.saveGroup(w, existing, &group)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := handlers.OrgFromContext(r.Context())
+	group, err := h.loadGroup(orgID, mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := h.groupService.Delete(orgID, group.ID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Find a user by its SCIM ID; IDs that are not numbers are not found
+func (h *Handler) loadUser(orgID int, rawID string) (*models.User, error) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, errUserNotFound
+	}
+	return h.userService.GetUserByID(orgID, id)
+}
+
+// Find a group and its members by its SCIM ID
+func (h *Handler) loadGroup(orgID int, rawID string) (*models.Group, error) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, errGroupNotFound
+	}
+	return h.groupService.Get(orgID, id)
+}
+
+func (h *Handler) userResource(orgID int, user *models.User) (User, error) {
+	groups, err := h.groupService.ListForUser(orgID, user.ID)
+	if err != nil {
+		return User{}, err
+	}
+	return NewUser(user, groups), nil
+}
+
+// Update a user from its full representation and write the result
+func (h *Handler) saveUser(w http.ResponseWriter, r *http.Request, id int, req *User) {
+	if req.email() == "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidValue, "userName is required")
+		return
+	}
+	orgID := handlers.OrgFromContext(r.Context())
+	actorID := handlers.PrincipalFromContext(r.Context()).UserID
+	if err := h.userService.UpdateUserWithStatus(req.toModel(orgID, id), activeStatus(req.Active), statusReason, actorID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	user, err := h.userService.GetUserByID(orgID, id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resource, err := h.userResource(orgID, user)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, resource)
+}
+
+// Status a SCIM active value asks for, or "" when it is not given
+func activeStatus(active *bool) string {
+	switch {
+	case active == nil:
+		return ""
+	case *active:
+		return models.StatusActive
+	default:
+		return models.StatusDeactivated
+	}
+}
+
+// Update a group from its full representation and write the result
+func (h *Handler) saveGroup(w http.ResponseWriter, existing *models.Group, req *Group) {
+	members, err := req.memberIDs()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	update := &models.Group{ID: existing.ID, OrgID: existing.OrgID, Name: req.DisplayName, Description: existing.Description}
+	group, err := h.groupService.Save(update, members)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, NewGroup(group))
+}
+
+// Read startIndex (1-based, default 1) and count (default and at most MaxResults)
+// Out-of-range values are clamped as RFC 7644 section 3.4.2.4 requires
+func parsePage(r *http.Request) (start, count int, err error) {
+	start, count = 1, MaxResults
+	query := r.URL.Query()
+	if s := query.Get("startIndex"); s != "" {
+		if start, err = strconv.Atoi(s); err != nil {
+			return 0, 0, badRequest(ErrInvalidValue, "startIndex must be a number")
+		}
+		start = max(start, 1)
+	}
+	if s := query.Get("count"); s != "" {
+		if count, err = strconv.Atoi(s); err != nil {
+			return 0, 0, badRequest(ErrInvalidValue, "count must be a number")
+		}
+		count = min(max(count, 0), MaxResults)
+	}
+	return start, count, nil
+}
+
+// The page of items starting at the 1-based index start
+func paginate[T any](items []T, start, count int) []T {
+	from := min(start-1, len(items))
+	return items[from:min(from+count, len(items))]
+}
+
+func writeResource(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeList[T any](w http.ResponseWriter, resources []T, total, start int) {
+	writeResource(w, http.StatusOK, ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeResource(w, status, Error{Schemas: []string{ErrorSchema}, Status: strconv.Itoa(status), ScimType: scimType, Detail: detail})
+}
+
+// Map service errors onto SCIM error responses
+func writeServiceError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	var filterErr *filter.Error
+	switch {
+	case errors.As(err, &reqErr):
+		writeError(w, reqErr.status, reqErr.scimType, reqErr.detail)
+	case errors.As(err, &filterErr):
+		writeError(w, http.StatusBadRequest, ErrInvalidFilter, err.Error())
+	case errors.Is(err, repositories.ErrEmailTaken), errors.Is(err, repositories.ErrGroupNameTaken):
+		writeError(w, http.StatusConflict, ErrUniqueness, err.Error())
+	case errors.Is(err, services.ErrNameRequired), errors.Is(err, repositories.ErrUnknownMember):
+		writeError(w, http.StatusBadRequest, ErrInvalidValue, err.Error())
+	default:
+		status := handlers.UserErrorStatus(err)
+		scimType := ""
+		if status == http.StatusBadRequest {
+			scimType = ErrInvalidValue
+		}
+		writeError(w, status, scimType, err.Error())
+	}
+}
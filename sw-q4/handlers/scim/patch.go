@@ -0,0 +1,332 @@
+package scim
+
+import (
+	"encoding/json"
+	"myapp/filter"
+	"myapp/models"
+	"slices"
+	"strings"
+)
+
+// SCIM Patch: Applies PATCH operations (RFC 7644 section 3.5.2) to a user or group representation
+// The patched representation is then saved like a PUT. Operation names and attribute paths are
+// case-insensitive, and paths may carry the schema URN as a prefix. Without a path, the value is
+// an object of attributes to set. Value filters on emails are ignored since users have one email;
+// on members they select members by value.
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"` // add, replace or remove
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// An attribute path split into its lowercased attribute, value filter and sub-attribute,
+// e.g. members[value eq "2"] or emails[type eq "work"].value
+type attributePath struct {
+	attribute string // With the sub-attribute appended after a dot, e.g. emails.value
+	filter    string // Value filter as written, without the brackets
+}
+
+func parsePath(path, schema string) (attributePath, error) {
+	if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+		path = path[len(schema)+1:]
+	}
+	attribute, rest, hasFilter := strings.Cut(path, "[")
+	if !hasFilter {
+		return attributePath{attribute: strings.ToLower(path)}, nil
+	}
+	valueFilter, sub, ok := strings.Cut(rest, "]")
+	if !ok || (sub != "" && !strings.HasPrefix(sub, ".")) {
+		return attributePath{}, badRequest(ErrInvalidPath, "invalid path "+path)
+	}
+	return attributePath{attribute: strings.ToLower(attribute + sub), filter: valueFilter}, nil
+}
+
+// Decode an operation value, reporting invalidValue when it has the wrong type
+func decodeValue(raw json.RawMessage, path string, v any) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return badRequest(ErrInvalidValue, "invalid value for "+path)
+	}
+	return nil
+}
+
+// Split a path-less value into attribute paths, flattening complex attributes such as name
+func valueAttributes(raw json.RawMessage, complexAttributes ...string) (map[string]json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, badRequest(ErrInvalidValue, "an operation without a path needs an object value")
+	}
+	attributes := map[string]json.RawMessage{}
+	for name, value := range object {
+		name = strings.ToLower(name)
+		if name == "schemas" {
+			continue
+		}
+		if slices.Contains(complexAttributes, name) {
+			var sub map[string]json.RawMessage
+			if err := json.Unmarshal(value, &sub); err != nil {
+				return nil, badRequest(ErrInvalidValue, "invalid value for "+name)
+			}
+			for subName, subValue := range sub {
+				attributes[name+"."+strings.ToLower(subName)] = subValue
+			}
+			continue
+		}
+		attributes[name] = value
+	}
+	return attributes, nil
+}
+
+// Accept true and false, and the strings "True" and "False" some providers send
+func decodeBool(raw json.RawMessage, path string) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, badRequest(ErrInvalidValue, path+" must be true or false")
+}
+
+// Apply PATCH operations to u, keeping the name attributes consistent with each other
+func (u *User) applyPatch(ops []PatchOperation) error {
+	if u.Name == nil {
+		u.Name = &Name{}
+	}
+	touched := map[string]bool{}
+	for _, op := range ops {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if op.Path == "" {
+				attributes, err := valueAttributes(op.Value, "name")
+				if err != nil {
+					return err
+				}
+				for attribute, value := range attributes {
+					if err := u.setAttribute(attribute, value, touched); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			path, err := parsePath(op.Path, UserSchema)
+			if err != nil {
+				return err
+			}
+			if err := u.setAttribute(path.attribute, op.Value, touched); err != nil {
+				return err
+			}
+		case "remove":
+			path, err := parsePath(op.Path, UserSchema)
+			if err != nil {
+				return err
+			}
+			if err := u.removeAttribute(path.attribute, touched); err != nil {
+				return err
+			}
+		default:
+			return badRequest(ErrInvalidSyntax, "unsupported operation "+op.Op)
+		}
+	}
+
+	if (touched["name.givenname"] || touched["name.familyname"]) && !touched["name.formatted"] {
+		u.Name.Formatted = strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+		touched["name.formatted"] = true
+	}
+	if touched["name.formatted"] && !touched["displayname"] {
+		u.DisplayName = u.Name.Formatted
+	}
+	return nil
+}
+
+func (u *User) setAttribute(attribute string, value json.RawMessage, touched map[string]bool) error {
+	touched[attribute] = true
+	switch attribute {
+	case "username":
+		return decodeValue(value, attribute, &u.UserName)
+	case "displayname":
+		return decodeValue(value, attribute, &u.DisplayName)
+	case "name":
+		var name Name
+		if err := decodeValue(value, attribute, &name); err != nil {
+			return err
+		}
+		u.Name = &name
+		touched["name.formatted"] = name.Formatted != ""
+		touched["name.givenname"] = true
+	case "name.formatted":
+		return decodeValue(value, attribute, &u.Name.Formatted)
+	case "name.givenname":
+		return decodeValue(value, attribute, &u.Name.GivenName)
+	case "name.familyname":
+		return decodeValue(value, attribute, &u.Name.FamilyName)
+	case "emails":
+		var emails []MultiValue
+		if err := decodeValue(value, attribute, &emails); err != nil {
+			return err
+		}
+		u.Emails = emails
+		u.UserName = (&User{Emails: emails}).email()
+	case "emails.value":
+		var email string
+		if err := decodeValue(value, attribute, &email); err != nil {
+			return err
+		}
+		u.Emails = []MultiValue{{Value: email, Type: "work", Primary: true}}
+		u.UserName = email
+	case "active":
+		active, err := decodeBool(value, attribute)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+	case "password":
+		return decodeValue(value, attribute, &u.Password)
+	case "roles":
+		return decodeValue(value, attribute, &u.Roles)
+	default:
+		return badRequest(ErrInvalidPath, "unsupported attribute "+attribute)
+	}
+	return nil
+}
+
+func (u *User) removeAttribute(attribute string, touched map[string]bool) error {
+	touched[attribute] = true
+	switch attribute {
+	case "name.givenname":
+		u.Name.GivenName = ""
+	case "name.familyname":
+		u.Name.FamilyName = ""
+	case "roles":
+		u.Roles = []MultiValue{{Value: models.RoleUser}}
+	case "":
+		return badRequest(ErrNoTarget, "remove needs a path")
+	default:
+		return badRequest(ErrMutability, attribute+" cannot be removed")
+	}
+	return nil
+}
+
+// Apply PATCH operations to g
+func (g *Group) applyPatch(ops []PatchOperation) error {
+	for _, op := range ops {
+		name := strings.ToLower(op.Op)
+		if name != "add" && name != "replace" && name != "remove" {
+			return badRequest(ErrInvalidSyntax, "unsupported operation "+op.Op)
+		}
+		if op.Path == "" {
+			if name == "remove" {
+				return badRequest(ErrNoTarget, "remove needs a path")
+			}
+			attributes, err := valueAttributes(op.Value)
+			if err != nil {
+				return err
+			}
+			for attribute, value := range attributes {
+				if err := g.setAttribute(name, attribute, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		path, err := parsePath(op.Path, GroupSchema)
+		if err != nil {
+			return err
+		}
+		if name == "remove" {
+			err = g.removeMembers(path, op.Value)
+		} else {
+			err = g.setAttribute(name, path.attribute, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set displayName, or add or replace members
+func (g *Group) setAttribute(op, attribute string, value json.RawMessage) error {
+	switch attribute {
+	case "displayname":
+		return decodeValue(value, attribute, &g.DisplayName)
+	case "members":
+		var members []MultiValue
+		if err := decodeValue(value, attribute, &members); err != nil {
+			return err
+		}
+		if op == "replace" {
+			g.Members = nil
+		}
+		for _, member := range members {
+			if !slices.ContainsFunc(g.Members, func(m MultiValue) bool { return m.Value == member.Value }) {
+				g.Members = append(g.Members, member)
+			}
+		}
+		return nil
+	}
+	return badRequest(ErrInvalidPath, "unsupported attribute "+attribute)
+}
+
+// Remove the members selected by a value filter or listed in value, or every member when neither is given
+func (g *Group) removeMembers(path attributePath, value json.RawMessage) error {
+	if path.attribute != "members" {
+		return badRequest(ErrMutability, path.attribute+" cannot be removed")
+	}
+	selected := func(MultiValue) bool { return true }
+	switch {
+	case path.filter != "":
+		expr, err := filter.Parse(path.filter)
+		if err != nil {
+			return badRequest(ErrInvalidFilter, err.Error())
+		}
+		selected = func(m MultiValue) bool { return matchMember(expr, m) }
+	case len(value) > 0:
+		var members []MultiValue
+		if err := decodeValue(value, path.attribute, &members); err != nil {
+			return err
+		}
+		selected = func(m MultiValue) bool {
+			return slices.ContainsFunc(members, func(r MultiValue) bool { return r.Value == m.Value })
+		}
+	}
+	g.Members = slices.DeleteFunc(g.Members, selected)
+	return nil
+}
+
+// Evaluate a members value filter; only comparisons of value with eq and ne select members
+func matchMember(expr filter.Expr, m MultiValue) bool {
+	switch e := expr.(type) {
+	case *filter.Logical:
+		if e.Op == "and" {
+			return matchMember(e.Left, m) && matchMember(e.Right, m)
+		}
+		return matchMember(e.Left, m) || matchMember(e.Right, m)
+	case *filter.Not:
+		return !matchMember(e.Expr, m)
+	case *filter.Comparison:
+		value, _ := e.Value.(string)
+		if !strings.EqualFold(e.Field, "value") {
+			return false
+		}
+		switch e.Op {
+		case filter.OpEq:
+			return m.Value == value
+		case filter.OpNe:
+			return m.Value != value
+		}
+	}
+	return false
+}
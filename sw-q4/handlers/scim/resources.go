@@ -0,0 +1,203 @@
+package scim
+
+import (
+	"myapp/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM Resources: The SCIM 2.0 representations of users and groups (RFC 7643)
+// userName and the single email address are both backed by models.User.Email, and the
+// name attributes by models.User.Name; group members are plain users without member roles
+
+// Schema and message URNs
+const (
+	UserSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema        = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// Path every SCIM endpoint is served under
+const BasePath = "/scim/v2"
+
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// A value of a multi-valued attribute such as emails, roles, groups or members
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Password    string       `json:"password,omitempty"` // Accepted on input only
+	Roles       []MultiValue `json:"roles,omitempty"`
+	Groups      []MultiValue `json:"groups,omitempty"` // Read-only; managed through Groups
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+// Error body; Status is the HTTP status code as a string
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// scimType values of error responses
+const (
+	ErrInvalidFilter = "invalidFilter"
+	ErrInvalidSyntax = "invalidSyntax"
+	ErrInvalidPath   = "invalidPath"
+	ErrInvalidValue  = "invalidValue"
+	ErrNoTarget      = "noTarget"
+	ErrMutability    = "mutability"
+	ErrUniqueness    = "uniqueness"
+)
+
+func userLocation(id int) string {
+	return BasePath + "/Users/" + strconv.Itoa(id)
+}
+
+func groupLocation(id int) string {
+	return BasePath + "/Groups/" + strconv.Itoa(id)
+}
+
+// Convert a stored user and the groups it belongs to into a SCIM User
+func NewUser(u *models.User, groups []models.UserGroup) User {
+	active := u.Status == models.StatusActive
+	given, family, _ := strings.Cut(u.Name, " ")
+	user := User{
+		Schemas:     []string{UserSchema},
+		ID:          strconv.Itoa(u.ID),
+		UserName:    u.Email,
+		Name:        &Name{Formatted: u.Name, GivenName: given, FamilyName: family},
+		DisplayName: u.Name,
+		Emails:      []MultiValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []MultiValue{{Value: u.Role, Primary: true}},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      &u.CreatedAt,
+			LastModified: &u.UpdatedAt,
+			Location:     userLocation(u.ID),
+		},
+	}
+	for _, g := range groups {
+		user.Groups = append(user.Groups, MultiValue{Value: strconv.Itoa(g.ID), Display: g.Name, Ref: groupLocation(g.ID)})
+	}
+	return user
+}
+
+// Convert a stored group, with its members loaded, into a SCIM Group
+func NewGroup(g *models.Group) Group {
+	group := Group{
+		Schemas:     []string{GroupSchema},
+		ID:          strconv.Itoa(g.ID),
+		DisplayName: g.Name,
+		Meta:        &Meta{ResourceType: "Group", Created: &g.CreatedAt, Location: groupLocation(g.ID)},
+	}
+	for _, m := range g.Members {
+		group.Members = append(group.Members, MultiValue{Value: strconv.Itoa(m.UserID), Display: m.Name, Ref: userLocation(m.UserID)})
+	}
+	return group
+}
+
+// The user's full name: displayName, else name.formatted, else the given and family names
+func (u *User) fullName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// The user's email: userName, else the primary or first email address
+func (u *User) email() string {
+	if u.UserName != "" || len(u.Emails) == 0 {
+		return u.UserName
+	}
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	return u.Emails[0].Value
+}
+
+// The user's role: the primary or first role, empty when none is given
+func (u *User) role() string {
+	for _, role := range u.Roles {
+		if role.Primary {
+			return role.Value
+		}
+	}
+	if len(u.Roles) > 0 {
+		return u.Roles[0].Value
+	}
+	return ""
+}
+
+func (u *User) toModel(orgID, id int) *models.User {
+	return &models.User{ID: id, OrgID: orgID, Name: u.fullName(), Email: u.email(), Password: u.Password, Role: u.role()}
+}
+
+// IDs of the group's members, which must be numbers
+func (g *Group) memberIDs() ([]int, error) {
+	ids := make([]int, 0, len(g.Members))
+	for _, m := range g.Members {
+		id, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return nil, badRequest(ErrInvalidValue, "invalid member value "+strconv.Quote(m.Value))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
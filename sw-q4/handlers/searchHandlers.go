@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"myapp/services"
+	"net/http"
+	"strconv"
+)
+
+// Search Handlers: Manages HTTP request/response for user search
+
+type SearchHandler struct {
+	searchService *services.UserSearchService
+}
+
+func NewSearchHandler(searchService *services.UserSearchService) *SearchHandler {
+	return &SearchHandler{searchService: searchService}
+}
+
+// Search users by name and email with ?q=, paginated by ?limit= and ?offset=
+func (h *SearchHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	page, err := h.searchService.Search(OrgFromContext(r.Context()), query.Get("q"), limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptySearchQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
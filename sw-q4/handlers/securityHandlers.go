@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Security Handlers: Manages HTTP request/response for admin security tools
+// Implements account unlocking and audit log listing
+
+type SecurityHandler struct {
+	lockoutService *services.LockoutService
+	auditService   *services.AuditService
+}
+
+func NewSecurityHandler(lockoutService *services.LockoutService, auditService *services.AuditService) *SecurityHandler {
+	return &SecurityHandler{lockoutService: lockoutService, auditService: auditService}
+}
+
+// Lift a login lockout on a user's account (admin only)
+func (h *SecurityHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	if err := h.lockoutService.Unlock(OrgFromContext(r.Context()), id, principal.UserID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List recent audit events, filtered by ?type= and limited by ?limit= (admin only)
+func (h *SecurityHandler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	events, err := h.auditService.List(OrgFromContext(r.Context()), r.URL.Query().Get("type"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Tag Handlers: Manages HTTP request/response for user tags
+// Anyone can list tags; administrators add and remove them
+
+type TagHandler struct {
+	tagService *services.TagService
+}
+
+func NewTagHandler(tagService *services.TagService) *TagHandler {
+	return &TagHandler{tagService: tagService}
+}
+
+type addTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// List tags with the number of users carrying each
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.tagService.List(OrgFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// Add tags to a user (admin only)
+func (h *TagHandler) AddUserTags(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req addTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.tagService.AddToUser(OrgFromContext(r.Context()), id, req.Tags)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Remove a tag from a user (admin only)
+func (h *TagHandler) RemoveUserTag(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.tagService.RemoveFromUser(OrgFromContext(r.Context()), id, params["tag"]); err != nil {
+		writeTagError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map tag service errors onto HTTP status codes
+func writeTagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
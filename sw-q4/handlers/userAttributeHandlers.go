@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// User Attribute Handlers: Manages HTTP request/response for the custom attribute schema
+// Anyone can read the schema; platform administrators define it
+
+type UserAttributeHandler struct {
+	attributeService *services.UserAttributeService
+}
+
+func NewUserAttributeHandler(attributeService *services.UserAttributeService) *UserAttributeHandler {
+	return &UserAttributeHandler{attributeService: attributeService}
+}
+
+func (h *UserAttributeHandler) GetAttributes(w http.ResponseWriter, r *http.Request) {
+	defs, err := h.attributeService.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, defs)
+}
+
+// Create or replace the definition named in the path (platform admin only)
+func (h *UserAttributeHandler) SaveAttribute(w http.ResponseWriter, r *http.Request) {
+	var def models.AttributeDefinition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	def.Name = mux.Vars(r)["name"]
+
+	if err := h.attributeService.Save(&def); err != nil {
+		writeAttributeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, def)
+}
+
+// Remove a definition (platform admin only)
+func (h *UserAttributeHandler) DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+	if err := h.attributeService.Delete(mux.Vars(r)["name"]); err != nil {
+		writeAttributeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map attribute service errors onto HTTP status codes
+func writeAttributeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAttributeDefinition):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// User Event Handlers: Streams user changes as Server-Sent Events
+// Clients resume after a disconnect by sending the last event ID they received
+
+const heartbeatInterval = 30 * time.Second
+
+type UserEventHandler struct {
+	bus *services.UserEventBus
+}
+
+func NewUserEventHandler(bus *services.UserEventBus) *UserEventHandler {
+	return &UserEventHandler{bus: bus}
+}
+
+// Stream the organization's user events, resuming after the Last-Event-ID header or ?last_event_id=
+// A "reset" event is sent first when events after the resume point are no longer available,
+// telling the client to reload its copy of the users
+func (h *UserEventHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseInt(lastID, 10, 64); err != nil || after < 0 {
+			http.Error(w, "invalid last event ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	replay, complete, sub := h.bus.Subscribe(OrgFromContext(r.Context()), after)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if writeEvent(w, event) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if writeEvent(w, event) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// Write one event in text/event-stream format
+func writeEvent(w http.ResponseWriter, event models.UserEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"myapp/filter"
 	"myapp/models"
+	"myapp/repositories"
 	"myapp/services"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -22,16 +26,40 @@ func NewUserHandler(userService *services.UserService) *UserHandler {
 	return &UserHandler{userService: userService}
 }
 
+// List users, optionally filtered by ?status=, custom attributes (?attr.department=eng),
+// tags (?tags=beta,vip&tags_mode=all) and a filter expression (?filter=name co "ann")
+// ?fields=id,name limits each user to the listed fields
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.GetAllUsers()
+	query := r.URL.Query()
+	criteria := models.UserFilter{Status: query.Get("status"), TagsMode: query.Get("tags_mode"), Fields: parseFields(r)}
+	if tags := query.Get("tags"); tags != "" {
+		criteria.Tags = strings.Split(tags, ",")
+	}
+	if expr := query.Get("filter"); expr != "" {
+		parsed, err := filter.Parse(expr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		criteria.Expression = parsed
+	}
+	for key := range query {
+		if name, ok := strings.CutPrefix(key, "attr."); ok {
+			if criteria.Attributes == nil {
+				criteria.Attributes = map[string]any{}
+			}
+			criteria.Attributes[name] = query.Get(key)
+		}
+	}
+	users, err := h.userService.GetAllUsers(OrgFromContext(r.Context()), criteria)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeUserError(w, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeProjectedJSON(w, http.StatusOK, users, criteria.Fields)
 }
 
+// Get one user; ?fields=id,name limits the response to the listed fields
 func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
@@ -40,18 +68,31 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(id)
+	var user *models.User
+	fields := parseFields(r)
+	if len(fields) > 0 {
+		user, err = h.userService.GetUserFields(OrgFromContext(r.Context()), id, fields)
+	} else {
+		user, err = h.userService.GetUserByID(OrgFromContext(r.Context()), id)
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeUserError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeProjectedJSON(w, http.StatusOK, user, fields)
+}
+
+// Split ?fields= into field names, dropping blanks and duplicates
+func parseFields(r *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		field = strings.TrimSpace(field)
+		if field != "" && !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
 }
 
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -61,14 +102,22 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.OrgID = OrgFromContext(r.Context())
+
+	if user.Role != "" && user.Role != models.RoleUser && !PrincipalFromContext(r.Context()).IsAdmin() {
+		http.Error(w, "only administrators can assign roles", http.StatusForbidden)
+		return
+	}
+
 	if err := h.userService.CreateUser(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeUserError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// Update a user's profile (the user themselves or an admin); passwords are changed separately
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
@@ -77,25 +126,44 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !PrincipalFromContext(r.Context()).CanManageUser(id) {
+		http.Error(w, "cannot modify another user", http.StatusForbidden)
+		return
+	}
+
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if user.Password != "" {
+		http.Error(w, "passwords are changed with POST /users/{id}/password", http.StatusBadRequest)
+		return
+	}
 	user.ID = id
+	user.OrgID = OrgFromContext(r.Context())
 
-	if err := h.userService.UpdateUser(&user); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, err.Error(), http.StatusNotFound)
+	if user.Role != "" && !PrincipalFromContext(r.Context()).IsAdmin() {
+		existing, err := h.userService.GetUserByID(user.OrgID, id)
+		if err != nil {
+			writeUserError(w, err)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if existing.Role != user.Role {
+			http.Error(w, "only administrators can assign roles", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.userService.UpdateUser(&user); err != nil {
+		writeUserError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// Delete a user (the user themselves or an admin)
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
@@ -104,7 +172,12 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.DeleteUser(id); err != nil {
+	if !PrincipalFromContext(r.Context()).CanManageUser(id) {
+		http.Error(w, "cannot delete another user", http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.DeleteUser(OrgFromContext(r.Context()), id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
@@ -115,3 +188,69 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Status change endpoints (admin only)
+func (h *UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusSuspended)
+}
+
+func (h *UserHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusActive)
+}
+
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusDeactivated)
+}
+
+// Apply a status transition with an optional {"reason"} body
+func (h *UserHandler) changeStatus(w http.ResponseWriter, r *http.Request, status string) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	user, err := h.userService.ChangeStatus(OrgFromContext(r.Context()), id, status, req.Reason, principal.UserID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Map user service errors onto HTTP status codes
+func writeUserError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), UserErrorStatus(err))
+}
+
+// HTTP status code for an error returned by the user service
+func UserErrorStatus(err error) int {
+	var filterErr *filter.Error
+	switch {
+	case errors.As(err, &filterErr):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidPassword), errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrInvalidStatus),
+		errors.Is(err, services.ErrInvalidAttribute), errors.Is(err, services.ErrInvalidTag),
+		errors.Is(err, services.ErrInvalidTagsMode), errors.Is(err, services.ErrUnknownField):
+		return http.StatusBadRequest
+	case errors.Is(err, repositories.ErrEmailTaken), errors.Is(err, services.ErrInvalidTransition):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,112 @@
+package v2
+
+import (
+	"myapp/models"
+	"time"
+)
+
+// Version 2 DTOs: The user representation served under /v2
+// Decoupled from models.User so storage fields can change without breaking clients
+
+// Response envelope; every v2 body wraps its payload in "data"
+type Envelope struct {
+	Data any `json:"data"`
+}
+
+// Response envelope for paginated lists; NextCursor is set when more items follow
+type ListEnvelope struct {
+	Data       any    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Error body for failed v2 requests
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"` // One of the Code constants, stable across message changes
+	Message string `json:"message"`
+}
+
+// Machine-readable error codes
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeEmailTaken     = "email_taken"
+	CodeInternal       = "internal"
+)
+
+type User struct {
+	ID            int            `json:"id"`
+	Name          string         `json:"name"`
+	Email         string         `json:"email"`
+	EmailVerified bool           `json:"email_verified"`
+	Role          string         `json:"role"`
+	Status        UserStatus     `json:"status"`
+	Tags          []string       `json:"tags"`
+	Attributes    map[string]any `json:"attributes"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// Account state together with why and when it last changed
+type UserStatus struct {
+	State     string     `json:"state"`
+	Reason    string     `json:"reason,omitempty"`
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+}
+
+// Body of POST /v2/users
+type CreateUserRequest struct {
+	Name       string         `json:"name"`
+	Email      string         `json:"email"`
+	Password   string         `json:"password,omitempty"`
+	Role       string         `json:"role,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Body of PUT /v2/users/{id}; omitted role and attributes keep their values
+// Passwords are changed with POST /v1/users/{id}/password
+type UpdateUserRequest struct {
+	Name       string         `json:"name"`
+	Email      string         `json:"email"`
+	Role       string         `json:"role,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Convert a stored user to its v2 representation
+func NewUser(u *models.User) User {
+	tags := u.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	attributes := u.Attributes
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	return User{
+		ID:            u.ID,
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Role:          u.Role,
+		Status:        UserStatus{State: u.Status, Reason: u.StatusReason, ChangedAt: u.StatusChangedAt},
+		Tags:          tags,
+		Attributes:    attributes,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+}
+
+func (r CreateUserRequest) toModel(orgID int) *models.User {
+	return &models.User{OrgID: orgID, Name: r.Name, Email: r.Email, Password: r.Password, Role: r.Role, Attributes: r.Attributes}
+}
+
+func (r UpdateUserRequest) toModel(orgID, id int) *models.User {
+	return &models.User{ID: id, OrgID: orgID, Name: r.Name, Email: r.Email, Role: r.Role, Attributes: r.Attributes}
+}
@@ -0,0 +1,241 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/filter"
+	"myapp/handlers"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Version 2 User Handlers: RESTful user endpoints served under /v2
+// Share the user service with v1 but translate to and from the v2 DTOs
+
+// Largest page ListUsers returns
+const maxPageSize = 100
+
+type UserHandler struct {
+	userService *services.UserService
+}
+
+func NewUserHandler(userService *services.UserService) *UserHandler {
+	return &UserHandler{userService: userService}
+}
+
+// List users, optionally filtered by ?status= and ?filter=
+// With ?limit= the list is paginated: pass the returned next_cursor as ?cursor= for the next page
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	criteria := models.UserFilter{Status: query.Get("status")}
+	if expr := query.Get("filter"); expr != "" {
+		parsed, err := filter.Parse(expr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		criteria.Expression = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+			return
+		}
+		// One extra row tells whether another page follows
+		criteria.Limit = n + 1
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		// Cursors are the last ID of the previous page, but clients should treat them as opaque
+		after, err := strconv.Atoi(cursor)
+		if err != nil || after < 1 {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		criteria.AfterID = after
+	}
+
+	users, err := h.userService.GetAllUsers(handlers.OrgFromContext(r.Context()), criteria)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	var next string
+	if criteria.Limit > 0 && len(users) == criteria.Limit {
+		users = users[:len(users)-1]
+		next = strconv.Itoa(users[len(users)-1].ID)
+	}
+	data := make([]User, len(users))
+	for i := range users {
+		data[i] = NewUser(&users[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListEnvelope{Data: data, NextCursor: next})
+}
+
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUserByID(handlers.OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	writeData(w, http.StatusOK, NewUser(user))
+}
+
+// Create a user and return it with a Location header
+// Like POST /v1/users this allows sign-up; only administrators may assign a role other than user
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Role != "" && req.Role != models.RoleUser && !handlers.PrincipalFromContext(r.Context()).IsAdmin() {
+		writeError(w, http.StatusForbidden, "only administrators can assign roles")
+		return
+	}
+
+	orgID := handlers.OrgFromContext(r.Context())
+	user := req.toModel(orgID)
+	if err := h.userService.CreateUser(user); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	created, err := h.userService.GetUserByID(orgID, user.ID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/users/"+strconv.Itoa(user.ID))
+	writeData(w, http.StatusCreated, NewUser(created))
+}
+
+// Replace a user's name and email, and optionally role and attributes (the user themselves or an admin)
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok || !authorizeUserWrite(w, r, id) {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orgID := handlers.OrgFromContext(r.Context())
+	if req.Role != "" && !handlers.PrincipalFromContext(r.Context()).IsAdmin() {
+		existing, err := h.userService.GetUserByID(orgID, id)
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+		if existing.Role != req.Role {
+			writeError(w, http.StatusForbidden, "only administrators can assign roles")
+			return
+		}
+	}
+
+	if err := h.userService.UpdateUser(req.toModel(orgID, id)); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	updated, err := h.userService.GetUserByID(orgID, id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, NewUser(updated))
+}
+
+// Delete a user (the user themselves or an admin)
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok || !authorizeUserWrite(w, r, id) {
+		return
+	}
+
+	if err := h.userService.DeleteUser(handlers.OrgFromContext(r.Context()), id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Parse the {id} route variable, writing a 400 response if it is not a number
+func userID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// Check that the caller is the user or an administrator, writing a 401 or 403 response if not
+func authorizeUserWrite(w http.ResponseWriter, r *http.Request, id int) bool {
+	principal := handlers.PrincipalFromContext(r.Context())
+	if principal == nil {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return false
+	}
+	if !principal.CanManageUser(id) {
+		writeError(w, http.StatusForbidden, "cannot modify another user")
+		return false
+	}
+	return true
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Envelope{Data: data})
+}
+
+// Write an error with the code that corresponds to status
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeCodedError(w, status, statusCodes[status], message)
+}
+
+func writeCodedError(w http.ResponseWriter, status int, code, message string) {
+	if code == "" {
+		code = CodeInternal
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorBody{Error: ErrorDetail{Status: status, Code: code, Message: message}})
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:   CodeInvalidRequest,
+	http.StatusUnauthorized: CodeUnauthorized,
+	http.StatusForbidden:    CodeForbidden,
+	http.StatusNotFound:     CodeNotFound,
+	http.StatusConflict:     CodeConflict,
+}
+
+// Map user service errors onto v2 error responses
+func writeUserError(w http.ResponseWriter, err error) {
+	status := handlers.UserErrorStatus(err)
+	code := statusCodes[status]
+	if errors.Is(err, repositories.ErrEmailTaken) {
+		code = CodeEmailTaken
+	}
+	writeCodedError(w, status, code, err.Error())
+}
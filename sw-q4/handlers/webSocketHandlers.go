@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket Handlers: Pushes user changes to clients subscribed to topics over a WebSocket
+// Clients acknowledge the events they have processed; once too many are unacknowledged
+// the server holds further events, and disconnects the client if it falls further behind
+
+// Topics a client can subscribe to
+const (
+	TopicUsers       = "users"  // Every user in the organization
+	topicUserPrefix  = "user:"  // user:<id>, one user
+	topicGroupPrefix = "group:" // group:<id>, the members of a group
+)
+
+const (
+	wsAckWindow      = 100 // Events sent without acknowledgement before the server holds further ones
+	wsMaxPending     = 256 // Events held for a client before it is disconnected
+	wsMaxMessageSize = 4096
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second // Connections silent for longer are closed
+	wsPingInterval   = 25 * time.Second
+	wsGroupCacheSize = 2048 // Events whose groups are remembered, more than a subscription can queue
+)
+
+// SocketFrame is a JSON message sent in either direction
+// Clients send subscribe, unsubscribe, ping and ack; the server sends subscribed, event, pong and error
+type SocketFrame struct {
+	Type    string            `json:"type"`
+	Topics  []string          `json:"topics,omitempty"`  // Topics to change, or all current topics in subscribed
+	ID      int64             `json:"id,omitempty"`      // In ack, the last event processed
+	Event   *models.UserEvent `json:"event,omitempty"`   // In event
+	Message string            `json:"message,omitempty"` // In error
+}
+
+type WebSocketHandler struct {
+	bus      *services.UserEventBus
+	groups   *services.GroupService
+	members  *eventGroups
+	upgrader websocket.Upgrader
+	conns    sync.WaitGroup
+}
+
+// Create a handler accepting browser connections from the API's own origin or allowedOrigins
+func NewWebSocketHandler(bus *services.UserEventBus, groups *services.GroupService, allowedOrigins []string) *WebSocketHandler {
+	h := &WebSocketHandler{bus: bus, groups: groups, members: newEventGroups(groups)}
+	h.upgrader.CheckOrigin = func(r *http.Request) bool {
+		return allowedOrigin(r, allowedOrigins)
+	}
+	return h
+}
+
+// Upgrade an authenticated request to a WebSocket and serve it until either side closes
+// Connections end with "going away" when the event bus shuts down
+func (h *WebSocketHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an error
+		return
+	}
+	h.conns.Add(1)
+	defer h.conns.Done()
+	defer conn.Close()
+
+	orgID := OrgFromContext(r.Context())
+	_, _, sub := h.bus.Subscribe(orgID, 0)
+	defer sub.Close()
+
+	c := &socketConn{
+		conn:    conn,
+		sub:     sub,
+		groups:  h.groups,
+		lookup:  h.members,
+		orgID:   orgID,
+		topics:  make(map[string]bool),
+		members: make(map[int]map[int]bool),
+	}
+	c.serve()
+}
+
+// Wait for open connections to finish closing, for server shutdown
+func (h *WebSocketHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Browsers send cookies with cross-site WebSocket handshakes, so only trusted origins may connect
+// Clients that send no Origin are not browsers and pass
+func allowedOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(allowed, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// One client connection; serve owns every field, so no locking is needed
+type socketConn struct {
+	conn     *websocket.Conn
+	sub      *services.UserSubscription
+	groups   *services.GroupService
+	lookup   *eventGroups
+	orgID    int
+	topics   map[string]bool
+	members  map[int]map[int]bool // Known members of each subscribed group, to route deletions
+	inflight []int64              // IDs of events sent but not yet acknowledged
+	pending  []models.UserEvent   // Events held until the client acknowledges earlier ones
+}
+
+// Handle client frames and deliver events until the connection ends
+// gorilla/websocket allows one concurrent reader and one writer: a goroutine reads, this loop writes
+func (c *socketConn) serve() {
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	frames := make(chan SocketFrame)
+	readDone := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(readDone)
+		for {
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			var frame SocketFrame
+			if err := json.Unmarshal(data, &frame); err != nil {
+				frame = SocketFrame{Type: "invalid"}
+			}
+			select {
+			case frames <- frame:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-readDone:
+			// The client closed the connection or stopped answering pings
+			return
+		case frame := <-frames:
+			err = c.handle(frame)
+		case event, ok := <-c.sub.C:
+			if !ok {
+				c.closeFor(c.sub.Err())
+				return
+			}
+			err = c.deliver(event)
+		case <-ping.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Respond to one client frame
+func (c *socketConn) handle(frame SocketFrame) error {
+	switch frame.Type {
+	case "subscribe":
+		subscribed := make(map[int]map[int]bool)
+		for _, topic := range frame.Topics {
+			groupID, isGroup, err := parseTopic(topic)
+			if err != nil {
+				return c.write(SocketFrame{Type: "error", Message: err.Error()})
+			}
+			if isGroup && !c.topics[topic] {
+				group, err := c.groups.Get(c.orgID, groupID)
+				if err != nil {
+					return c.write(SocketFrame{Type: "error", Message: err.Error()})
+				}
+				subscribed[groupID] = make(map[int]bool)
+				for _, member := range group.Members {
+					subscribed[groupID][member.UserID] = true
+				}
+			}
+		}
+		for _, topic := range frame.Topics {
+			c.topics[topic] = true
+		}
+		for groupID, members := range subscribed {
+			c.members[groupID] = members
+		}
+		return c.writeTopics()
+	case "unsubscribe":
+		for _, topic := range frame.Topics {
+			delete(c.topics, topic)
+			if groupID, isGroup, err := parseTopic(topic); err == nil && isGroup {
+				delete(c.members, groupID)
+			}
+		}
+		return c.writeTopics()
+	case "ping":
+		return c.write(SocketFrame{Type: "pong"})
+	case "ack":
+		i := 0
+		for i < len(c.inflight) && c.inflight[i] <= frame.ID {
+			i++
+		}
+		c.inflight = c.inflight[i:]
+		return c.flush()
+	case "invalid":
+		return c.write(SocketFrame{Type: "error", Message: "frames must be JSON objects"})
+	default:
+		return c.write(SocketFrame{Type: "error", Message: fmt.Sprintf("unknown frame type %q", frame.Type)})
+	}
+}
+
+// Queue an event the client subscribed to and send it if the client is keeping up
+func (c *socketConn) deliver(event models.UserEvent) error {
+	if !c.matches(event) {
+		return nil
+	}
+	if len(c.pending) >= wsMaxPending {
+		c.close(websocket.CloseTryAgainLater, "too many unacknowledged events")
+		return errors.New("client fell behind")
+	}
+	c.pending = append(c.pending, event)
+	return c.flush()
+}
+
+// Send held events while fewer than wsAckWindow are unacknowledged
+func (c *socketConn) flush() error {
+	for len(c.pending) > 0 && len(c.inflight) < wsAckWindow {
+		event := c.pending[0]
+		if err := c.write(SocketFrame{Type: "event", Event: &event}); err != nil {
+			return err
+		}
+		c.pending = c.pending[1:]
+		c.inflight = append(c.inflight, event.ID)
+	}
+	return nil
+}
+
+// Report whether an event falls under a subscribed topic, tracking group membership as users change
+// Membership is looked up once per event for all connections; a deleted user no longer has groups,
+// so deletions are routed by the members known from the subscription or earlier events
+func (c *socketConn) matches(event models.UserEvent) bool {
+	matched := c.topics[TopicUsers] || c.topics[topicUserPrefix+strconv.Itoa(event.UserID)]
+	if len(c.members) == 0 {
+		return matched
+	}
+
+	if event.Type == models.UserDeleted {
+		for _, members := range c.members {
+			matched = matched || members[event.UserID]
+			delete(members, event.UserID)
+		}
+		return matched
+	}
+	groupIDs, err := c.lookup.groupsOf(event)
+	if err != nil {
+		return matched
+	}
+	for groupID, members := range c.members {
+		member := slices.Contains(groupIDs, groupID)
+		if member {
+			members[event.UserID] = true
+		} else {
+			delete(members, event.UserID)
+		}
+		matched = matched || member
+	}
+	return matched
+}
+
+// Groups of the users in recent events, shared by every connection so each event is looked up once
+type eventGroups struct {
+	groups  *services.GroupService
+	mu      sync.Mutex
+	entries map[int64]*eventGroupsEntry
+	order   []int64 // IDs of the remembered events, oldest first
+}
+
+type eventGroupsEntry struct {
+	once     sync.Once
+	groupIDs []int
+	err      error
+}
+
+func newEventGroups(groups *services.GroupService) *eventGroups {
+	return &eventGroups{groups: groups, entries: make(map[int64]*eventGroupsEntry)}
+}
+
+// IDs of the groups the event's user belongs to; connections asking at the same time wait for one lookup
+func (e *eventGroups) groupsOf(event models.UserEvent) ([]int, error) {
+	e.mu.Lock()
+	entry, ok := e.entries[event.ID]
+	if !ok {
+		entry = &eventGroupsEntry{}
+		e.entries[event.ID] = entry
+		e.order = append(e.order, event.ID)
+		if len(e.order) > wsGroupCacheSize {
+			delete(e.entries, e.order[0])
+			e.order = e.order[1:]
+		}
+	}
+	e.mu.Unlock()
+
+	entry.once.Do(func() {
+		groups, err := e.groups.ListForUser(event.OrgID, event.UserID)
+		if err != nil {
+			entry.err = err
+			return
+		}
+		for _, g := range groups {
+			entry.groupIDs = append(entry.groupIDs, g.ID)
+		}
+	})
+	return entry.groupIDs, entry.err
+}
+
+func (c *socketConn) writeTopics() error {
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	return c.write(SocketFrame{Type: "subscribed", Topics: topics})
+}
+
+func (c *socketConn) write(frame SocketFrame) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(frame)
+}
+
+// Close the connection with the status matching why the subscription ended
+func (c *socketConn) closeFor(err error) {
+	switch {
+	case errors.Is(err, services.ErrEventBusClosed):
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	case errors.Is(err, services.ErrSubscriberTooSlow):
+		c.close(websocket.CloseTryAgainLater, "subscriber fell too far behind")
+	}
+}
+
+func (c *socketConn) close(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+}
+
+// Validate a topic, returning the group ID for group topics
+func parseTopic(topic string) (groupID int, isGroup bool, err error) {
+	if topic == TopicUsers {
+		return 0, false, nil
+	}
+	if id, ok := strings.CutPrefix(topic, topicUserPrefix); ok {
+		if n, err := strconv.Atoi(id); err == nil && n > 0 {
+			return 0, false, nil
+		}
+	}
+	if id, ok := strings.CutPrefix(topic, topicGroupPrefix); ok {
+		if n, err := strconv.Atoi(id); err == nil && n > 0 {
+			return n, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("unknown topic %q; use %q, \"user:<id>\" or \"group:<id>\"", topic, TopicUsers)
+}
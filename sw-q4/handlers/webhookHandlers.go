@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Webhook Handlers: Manages HTTP request/response for webhook subscriptions and their deliveries
+// Every route is restricted to administrators of the organization
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"` // Defaults to true
+}
+
+func (req webhookRequest) webhook() *models.Webhook {
+	return &models.Webhook{URL: req.URL, Events: req.Events, Active: req.Active == nil || *req.Active}
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.List(OrgFromContext(r.Context()))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.webhookService.Get(OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// Create a webhook; the response carries the signing secret, which is not shown again
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook := req.webhook()
+	webhook.OrgID = OrgFromContext(r.Context())
+
+	if err := h.webhookService.Create(webhook); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// Replace a webhook's URL, events and active flag
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook := req.webhook()
+	webhook.ID = id
+	webhook.OrgID = OrgFromContext(r.Context())
+
+	if err := h.webhookService.Update(webhook); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webhookService.Delete(OrgFromContext(r.Context()), id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List a webhook's 100 most recent deliveries
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.webhookService.Deliveries(OrgFromContext(r.Context()), id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// Queue a dead-lettered delivery again
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.Atoi(params["deliveryId"])
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.webhookService.RetryDelivery(OrgFromContext(r.Context()), id, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// Map webhook service errors onto HTTP status codes
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidWebhookEvent),
+		errors.Is(err, services.ErrWebhookDestination):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repositories.ErrWebhookNotFound), errors.Is(err, repositories.ErrDeliveryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrDeliveryNotDead):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"myapp/mailer"
+	"myapp/models"
+	"myapp/publisher"
+	"myapp/repositories"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Test inviting a user and accepting the invitation
+func TestInvitationAccept(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	mail := mailer.NewMemoryMailer()
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Mailer = mail
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	rr := doJSONWithToken(t, router, "POST", "/invitations", map[string]string{"email": "carol@example.com"}, adminToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var inv models.Invitation
+	decodeBody(t, rr.Body, &inv)
+	if inv.Status != models.InvitationPending || inv.UserID == nil {
+		t.Fatalf("Unexpected invitation: %+v", inv)
+	}
+
+	// The invitee exists as a pending user until they accept
+	var pending models.User
+	decodeBody(t, doJSON(t, router, "GET", "/users/3", nil).Body, &pending)
+	if pending.Status != models.StatusPending {
+		t.Errorf("Expected pending user, got %q", pending.Status)
+	}
+
+	token := tokenFromLastEmail(t, mail)
+	accept := map[string]string{"name": "Carol", "password": "carol password"}
+	rr = doJSON(t, router, "POST", "/invitations/"+token+"/accept", accept)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Accept: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var user models.User
+	decodeBody(t, rr.Body, &user)
+	if user.Name != "Carol" || user.Status != models.StatusActive || user.EmailVerifiedAt == nil {
+		t.Errorf("Unexpected accepted user: %+v", user)
+	}
+
+	if rr := doJSON(t, router, "POST", "/invitations/"+token+"/accept", accept); rr.Code != http.StatusBadRequest {
+		t.Errorf("Reused token: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if resp := login(t, router, "carol@example.com", "carol password"); resp.AccessToken == "" {
+		t.Error("Expected the invitee to be able to log in")
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/invitations/1", nil, adminToken); rr.Code != http.StatusConflict {
+		t.Errorf("Revoke accepted invitation: got %v want %v", rr.Code, http.StatusConflict)
+	}
+}
+
+// Test that invitations carry attributes and that accepting checks them against the current schema
+func TestInvitationAttributes(t *testing.T) {
+	for _, store := range []string{"table", "events"} {
+		t.Run("store="+store, func(t *testing.T) {
+			setupTestDatabase(t)
+			clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+			mail := mailer.NewMemoryMailer()
+			cfg := testConfig()
+			cfg.Clock = clock
+			cfg.Mailer = mail
+			cfg.UserStore = store
+			router := newRouter(db, cfg)
+			adminToken := setupAdmin(t, router, clock)
+			if store == "events" {
+				if _, err := repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval).ImportUsers(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			define := func(name string, def models.AttributeDefinition) {
+				t.Helper()
+				if rr := doJSONWithToken(t, router, "PUT", "/user-attributes/"+name, def, adminToken); rr.Code != http.StatusOK {
+					t.Fatalf("Define %s: got %v want %v", name, rr.Code, http.StatusOK)
+				}
+			}
+			define("department", models.AttributeDefinition{Type: "string", Required: true, Enum: []string{"eng", "sales"}})
+
+			invite := map[string]any{"email": "carol@example.com", "attributes": map[string]any{"department": "hr"}}
+			if rr := doJSONWithToken(t, router, "POST", "/invitations", invite, adminToken); rr.Code != http.StatusBadRequest {
+				t.Errorf("Invalid attribute: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			if rr := doJSONWithToken(t, router, "POST", "/invitations", map[string]any{"email": "carol@example.com"}, adminToken); rr.Code != http.StatusBadRequest {
+				t.Errorf("Missing required attribute: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			invite["attributes"] = map[string]any{"department": "eng"}
+			if rr := doJSONWithToken(t, router, "POST", "/invitations", invite, adminToken); rr.Code != http.StatusCreated {
+				t.Fatalf("Invite: got %v want %v", rr.Code, http.StatusCreated)
+			}
+			var pending models.User
+			decodeBody(t, doJSON(t, router, "GET", "/users/3", nil).Body, &pending)
+			if pending.Attributes["department"] != "eng" {
+				t.Errorf("Pending user attributes: got %v", pending.Attributes)
+			}
+
+			// An attribute made required after the invite blocks acceptance until it is set
+			define("floor", models.AttributeDefinition{Type: "number", Required: true})
+			token := tokenFromLastEmail(t, mail)
+			accept := map[string]string{"name": "Carol", "password": "carol password"}
+			if rr := doJSON(t, router, "POST", "/invitations/"+token+"/accept", accept); rr.Code != http.StatusBadRequest {
+				t.Fatalf("Accept with missing attribute: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			update := models.User{Name: "Carol", Email: "carol@example.com", Attributes: map[string]any{"department": "eng", "floor": 3}}
+			if rr := doJSONWithToken(t, router, "PUT", "/users/3", update, adminToken); rr.Code != http.StatusOK {
+				t.Fatalf("Set attribute: got %v want %v", rr.Code, http.StatusOK)
+			}
+			rr := doJSON(t, router, "POST", "/invitations/"+token+"/accept", accept)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Accept: got %v want %v", rr.Code, http.StatusOK)
+			}
+			var user models.User
+			decodeBody(t, rr.Body, &user)
+			if user.Status != models.StatusActive || user.Attributes["floor"] != float64(3) {
+				t.Errorf("Unexpected accepted user: %+v", user)
+			}
+		})
+	}
+}
+
+// Test resending, expiry, listing and revoking invitations
+func TestInvitationLifecycle(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	mail := mailer.NewMemoryMailer()
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Mailer = mail
+	cfg.AccessTokenTTL = 30 * 24 * time.Hour // Outlive the invitation
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	doJSONWithToken(t, router, "POST", "/invitations", map[string]string{"email": "carol@example.com"}, adminToken)
+	firstToken := tokenFromLastEmail(t, mail)
+
+	clock.Advance(8 * 24 * time.Hour)
+	var invitations []models.Invitation
+	decodeBody(t, doJSONWithToken(t, router, "GET", "/invitations?status=expired", nil, adminToken).Body, &invitations)
+	if len(invitations) != 1 {
+		t.Fatalf("Expected 1 expired invitation, got %d", len(invitations))
+	}
+
+	rr := doJSONWithToken(t, router, "POST", "/invitations/1/resend", nil, adminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Resend: got %v want %v", rr.Code, http.StatusOK)
+	}
+	accept := map[string]string{"name": "Carol", "password": "carol password"}
+	if rr := doJSON(t, router, "POST", "/invitations/"+firstToken+"/accept", accept); rr.Code != http.StatusBadRequest {
+		t.Errorf("Superseded token: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	if rr := doJSONWithToken(t, router, "DELETE", "/invitations/1", nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Revoke: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := doJSON(t, router, "POST", "/invitations/"+tokenFromLastEmail(t, mail)+"/accept", accept); rr.Code != http.StatusBadRequest {
+		t.Errorf("Revoked invitation: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSON(t, router, "GET", "/users/3", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected pending user to be removed, got %v", rr.Code)
+	}
+}
+
+// Test that inviting, accepting and revoking relay user events
+func TestInvitationEvents(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	mail := mailer.NewMemoryMailer()
+	memory := publisher.NewMemoryPublisher()
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Mailer = mail
+	cfg.Publisher = memory
+	app := newServers(db, cfg)
+	router := app.router
+	adminToken := setupAdmin(t, router, clock)
+
+	var carol, dave models.Invitation
+	decodeBody(t, doJSONWithToken(t, router, "POST", "/invitations", map[string]string{"email": "carol@example.com"}, adminToken).Body, &carol)
+	token := tokenFromLastEmail(t, mail)
+	decodeBody(t, doJSONWithToken(t, router, "POST", "/invitations", map[string]string{"email": "dave@example.com"}, adminToken).Body, &dave)
+	if carol.UserID == nil || dave.UserID == nil {
+		t.Fatalf("Unexpected invitations: %+v %+v", carol, dave)
+	}
+
+	accept := map[string]string{"name": "Carol", "password": "carol password"}
+	if rr := doJSON(t, router, "POST", "/invitations/"+token+"/accept", accept); rr.Code != http.StatusOK {
+		t.Fatalf("Accept: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/invitations/"+strconv.Itoa(dave.ID), nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Revoke: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	// A second revoke removes nothing and records nothing
+	doJSONWithToken(t, router, "DELETE", "/invitations/"+strconv.Itoa(dave.ID), nil, adminToken)
+
+	if _, err := app.outbox.RelayPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var events []models.UserEvent
+	for _, event := range memory.Events() {
+		if event.UserID == *carol.UserID || event.UserID == *dave.UserID {
+			events = append(events, event)
+		}
+	}
+	want := []struct {
+		typ    string
+		userID int
+	}{
+		{models.UserCreated, *carol.UserID},
+		{models.UserCreated, *dave.UserID},
+		{models.UserUpdated, *carol.UserID},
+		{models.UserDeleted, *dave.UserID},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Type != w.typ || events[i].UserID != w.userID {
+			t.Errorf("Event %d: got %s for user %d, want %s for user %d", i, events[i].Type, events[i].UserID, w.typ, w.userID)
+		}
+	}
+	if u := events[0].User; u == nil || u.Status != models.StatusPending {
+		t.Errorf("Created payload: got %+v", u)
+	}
+	if u := events[2].User; u == nil || u.Name != "Carol" || u.Status != models.StatusActive {
+		t.Errorf("Accepted payload: got %+v", u)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"myapp/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test lockout after repeated failures and exponential backoff, for both stores
+func TestAccountLockout(t *testing.T) {
+	for _, store := range []string{"sqlite", "memory"} {
+		t.Run(store, func(t *testing.T) {
+			setupTestDatabase(t)
+			clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+			cfg := testConfig()
+			cfg.Clock = clock
+			cfg.LockoutStore = store
+			router := newRouter(db, cfg)
+
+			loginTestUser(t, router)
+			wrong := models.Credentials{Email: "bob@example.com", Password: "wrong password"}
+			right := models.Credentials{Email: "bob@example.com", Password: "correct horse"}
+
+			for i := 0; i < 3; i++ {
+				if rr := doJSON(t, router, "POST", "/auth/login", wrong); rr.Code != http.StatusUnauthorized {
+					t.Fatalf("Attempt %d: got %v want %v", i+1, rr.Code, http.StatusUnauthorized)
+				}
+			}
+
+			// Even the right password is refused while locked
+			rr := doJSON(t, router, "POST", "/auth/login", right)
+			if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "61" {
+				t.Fatalf("Locked login: got %v (Retry-After %q)", rr.Code, rr.Header().Get("Retry-After"))
+			}
+
+			// Another failure after the lock expires doubles the lockout
+			clock.Advance(61 * time.Second)
+			doJSON(t, router, "POST", "/auth/login", wrong)
+			rr = doJSON(t, router, "POST", "/auth/login", right)
+			if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "121" {
+				t.Fatalf("Backoff: got %v (Retry-After %q)", rr.Code, rr.Header().Get("Retry-After"))
+			}
+
+			clock.Advance(121 * time.Second)
+			if rr := doJSON(t, router, "POST", "/auth/login", right); rr.Code != http.StatusOK {
+				t.Errorf("After lockout: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			var count int
+			db.QueryRow("SELECT COUNT(*) FROM audit_events WHERE type = ?", models.AuditAccountLocked).Scan(&count)
+			if count != 2 {
+				t.Errorf("Expected 2 lockout audit events, got %d", count)
+			}
+		})
+	}
+}
+
+// Test that an administrator can lift a lockout
+func TestAdminUnlock(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+
+	loginTestUser(t, router)
+	adminToken := setupAdmin(t, router, clock)
+
+	for i := 0; i < 3; i++ {
+		doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "wrong password"})
+	}
+	right := models.Credentials{Email: "bob@example.com", Password: "correct horse"}
+	if rr := doJSON(t, router, "POST", "/auth/login", right); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected lockout, got %v", rr.Code)
+	}
+
+	rr := doJSONWithToken(t, router, "POST", "/users/2/unlock", nil, adminToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/login", right); rr.Code != http.StatusOK {
+		t.Errorf("After unlock: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = doJSONWithToken(t, router, "GET", "/audit-events?type=account.unlocked", nil, adminToken)
+	var events []models.AuditEvent
+	decodeBody(t, rr.Body, &events)
+	if len(events) != 1 || events[0].Subject != "bob@example.com" {
+		t.Errorf("Expected one unlock audit event, got %+v", events)
+	}
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// File Mailer: Writes messages to a file or stdout instead of sending them
+// Intended for local development where no mail server is available
+
+type FileMailer struct {
+	mu   sync.Mutex
+	from string
+	w    io.Writer
+}
+
+func NewFileMailer(from string, w io.Writer) *FileMailer {
+	return &FileMailer{from: from, w: w}
+}
+
+// Print messages to standard output
+func NewStdoutMailer(from string) *FileMailer {
+	return NewFileMailer(from, os.Stdout)
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "%s\r\n.\r\n", formatMessage(m.from, msg))
+	return err
+}
@@ -0,0 +1,14 @@
+package mailer
+
+// Mailer: Abstraction for sending transactional email
+// Implementations deliver over SMTP, write to a file or stdout, or keep messages in memory
+
+type Message struct {
+	To      string // Recipient address
+	Subject string // Subject line
+	Body    string // Plain-text body
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
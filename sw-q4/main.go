@@ -1,28 +1,187 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"log"
 	"myapp/handlers"
+	"myapp/handlers/gql"
+	"myapp/handlers/scim"
+	"myapp/handlers/v2"
+	"myapp/mailer"
+	"myapp/models"
+	"myapp/publisher"
 	"myapp/repositories"
+	"myapp/rpc"
 	"myapp/services"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/cors"
+	"google.golang.org/grpc"
 )
 
 // Main Application Entry Point
-// Sets up database connection, routing, and starts the HTTP server
+// Sets up database connection, routing, and starts the HTTP and gRPC servers
 
-func main() {
+// Unversioned routes are an alias of /v1, deprecated since rootDeprecatedAt and removed at rootSunset
+var (
+	rootDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	rootSunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// Browser origins allowed to call the API with credentials, over CORS or WebSocket
+var allowedOrigins = []string{"http://localhost:3000"}
+
+// How long shutdown waits for in-flight requests and open streams before exiting
+const shutdownTimeout = 15 * time.Second
+
+// Runtime configuration, read from the environment
+type config struct {
+	AuthSecret      []byte        // AUTH_SECRET: key used to sign access tokens
+	AccessTokenTTL  time.Duration // Lifetime of access tokens
+	RefreshTokenTTL time.Duration // Lifetime of refresh tokens
+	BcryptCost      int           // Cost factor for new password hashes
+	SessionIdle     time.Duration // Cookie sessions end after this much inactivity
+	SessionMaxAge   time.Duration // Cookie sessions end this long after login
+	SecureCookies   bool          // COOKIE_SECURE: only send cookies over HTTPS
+	MFAIssuer       string        // MFA_ISSUER: name shown in authenticator apps
+	LockoutStore    string        // LOCKOUT_STORE: "sqlite" (default) or "memory"
+	UserStore       string        // USER_STORE: "table" (default) or "events" to event-source users
+	SearchBackend   string        // SEARCH_BACKEND: "fts" (default when SQLite has FTS5) or "memory"
+	GRPCAddr        string        // GRPC_ADDR: listen address of the gRPC server, default ":9090"
+	DevMode         bool          // DEV_MODE: enable development tools such as the GraphiQL IDE
+	Lockout         services.LockoutConfig
+	Webhooks        services.WebhookConfig // WEBHOOK_ALLOW_PRIVATE: deliver to loopback and private addresses
+	Outbox          services.OutboxConfig
+	BaseURL         string              // APP_BASE_URL: frontend URL used in email links
+	Mailer          mailer.Mailer       // Selected by MAILER: "stdout" (default), "file" or "smtp"
+	Publisher       publisher.Publisher // Selected by EVENT_PUBLISHER: "stdout", "file" or "http"; none by default
+	Clock           services.Clock
+}
+
+func loadConfig() config {
+	cfg := config{
+		AuthSecret:      []byte(os.Getenv("AUTH_SECRET")),
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+		SessionIdle:     30 * time.Minute,
+		SessionMaxAge:   12 * time.Hour,
+		SecureCookies:   os.Getenv("COOKIE_SECURE") == "true",
+		MFAIssuer:       os.Getenv("MFA_ISSUER"),
+		LockoutStore:    os.Getenv("LOCKOUT_STORE"),
+		UserStore:       os.Getenv("USER_STORE"),
+		SearchBackend:   os.Getenv("SEARCH_BACKEND"),
+		GRPCAddr:        os.Getenv("GRPC_ADDR"),
+		DevMode:         os.Getenv("DEV_MODE") == "true",
+		Lockout: services.LockoutConfig{
+			AccountThreshold: 5,
+			IPThreshold:      20,
+			Window:           15 * time.Minute,
+			BaseLockout:      time.Minute,
+			MaxLockout:       time.Hour,
+		},
+		Webhooks: services.WebhookConfig{
+			MaxAttempts:  10,
+			BaseBackoff:  time.Minute,
+			MaxBackoff:   6 * time.Hour,
+			Timeout:      10 * time.Second,
+			PollInterval: 5 * time.Second,
+			Workers:      8,
+			AllowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true",
+		},
+		Outbox: services.OutboxConfig{
+			PollInterval: time.Second,
+			Retention:    7 * 24 * time.Hour,
+		},
+		BaseURL:   os.Getenv("APP_BASE_URL"),
+		Mailer:    loadMailer(),
+		Publisher: loadPublisher(),
+		Clock:     services.SystemClock{},
+	}
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = "User Management"
+	}
+	if cfg.GRPCAddr == "" {
+		cfg.GRPCAddr = ":9090"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:3000"
+	}
+	if len(cfg.AuthSecret) == 0 {
+		log.Println("AUTH_SECRET not set; generating a random key, tokens will not survive restarts")
+		cfg.AuthSecret = make([]byte, 32)
+		rand.Read(cfg.AuthSecret)
+	}
+	return cfg
+}
+
+// Select the mailer implementation from the environment
+func loadMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return mailer.NewSMTPMailer(os.Getenv("SMTP_ADDR"), from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "./mail.log"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal("Failed to open mail file:", err)
+		}
+		return mailer.NewFileMailer(from, f)
+	default:
+		return mailer.NewStdoutMailer(from)
+	}
+}
+
+// Select the external event publisher from the environment, or nil for none
+func loadPublisher() publisher.Publisher {
+	switch os.Getenv("EVENT_PUBLISHER") {
+	case "stdout":
+		return publisher.NewStdoutPublisher()
+	case "file":
+		path := os.Getenv("EVENT_FILE")
+		if path == "" {
+			path = "./events.log"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal("Failed to open event file:", err)
+		}
+		return publisher.NewFilePublisher(f)
+	case "http":
+		url := os.Getenv("EVENT_URL")
+		if url == "" {
+			log.Fatal("EVENT_URL must be set for the http event publisher")
+		}
+		return publisher.NewHTTPPublisher(url, 10*time.Second)
+	default:
+		return nil
+	}
+}
+
+// Open the database and bring its schema up to date
+func openDatabase() *sql.DB {
 	// Initialize database connection
-	db, err := sql.Open("sqlite3", "./db/database.db")
+	db, err := sql.Open("sqlite3", "./db/database.db?_foreign_keys=on")
 	if err != nil {
 		log.Fatal("Failed to open database:", err)
 	}
-	defer db.Close()
 
 	// Verify database connection
 	err = db.Ping()
@@ -31,41 +190,378 @@ func main() {
 	}
 	log.Println("Database connection successful!")
 
-	// Create database schema
-	createTableSQL := `CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		email TEXT
-	);`
-	_, err = db.Exec(createTableSQL)
+	// Create or upgrade database schema
+	if err := repositories.Migrate(db); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+	log.Println("Database schema is up to date!")
+	return db
+}
+
+// Recreate the users table from the user event store, for `go run . rebuild-projections`
+func rebuildProjections(db *sql.DB, cfg config) {
+	if cfg.UserStore != "events" {
+		log.Fatal("rebuild-projections needs USER_STORE=events; in table mode the users table is the source of truth")
+	}
+	store := repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval)
+	projected, removed, err := store.RebuildProjections(cfg.Clock.Now())
 	if err != nil {
-		log.Fatal("Failed to create table:", err)
+		log.Fatal("Failed to rebuild projections:", err)
 	}
-	log.Println("Table 'users' created successfully!")
+	log.Printf("Rebuilt the users projection: %d users written, %d deleted users removed", projected, removed)
+}
 
-	// Initialize application layers
-	userRepo := repositories.NewUserRepository(db)
-	userService := services.NewUserService(userRepo)
-	userHandler := handlers.NewUserHandler(userService)
+func main() {
+	cfg := loadConfig()
+	db := openDatabase()
+	defer db.Close()
 
-	// Set up routing
-	router := mux.NewRouter()
-	router.HandleFunc("/users", userHandler.GetAllUsers).Methods("GET")
-	router.HandleFunc("/users/{id}", userHandler.GetUserByID).Methods("GET")
-	router.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	router.HandleFunc("/users/{id}", userHandler.UpdateUser).Methods("PUT")
-	router.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE")
+	if len(os.Args) > 1 {
+		if os.Args[1] != "rebuild-projections" {
+			log.Fatalf("Unknown command %q; the only command is rebuild-projections", os.Args[1])
+		}
+		rebuildProjections(db, cfg)
+		return
+	}
+
+	// Users created before event sourcing was turned on start their streams from the table
+	if cfg.UserStore == "events" {
+		imported, err := repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval).ImportUsers()
+		if err != nil {
+			log.Fatal("Failed to import users into the event store:", err)
+		}
+		if imported > 0 {
+			log.Printf("Imported %d users into the event store", imported)
+		}
+	}
+
+	app := newServers(db, cfg)
 
 	// Configure CORS
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"http://localhost:3000"},
+		AllowedOrigins: allowedOrigins,
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		// Browsers must send the session cookie with cross-origin requests
+		AllowCredentials: true,
 	})
 
-	handler := c.Handler(router)
+	handler := c.Handler(app.router)
+
+	// Start gRPC server on its own port
+	listener, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		log.Fatal("Failed to listen for gRPC:", err)
+	}
+	go func() {
+		log.Println("gRPC server started on " + cfg.GRPCAddr)
+		if err := app.grpc.Serve(listener); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	// Start HTTP server
-	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", handler))
+	server := &http.Server{Addr: ":8080", Handler: handler}
+	go func() {
+		log.Println("Server started on :8080")
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Start background workers, which stop with the servers
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go app.outbox.Run(workers)
+	go app.webhooks.Run(workers)
+
+	// Shut down gracefully on SIGINT or SIGTERM: stop accepting connections, end event streams
+	// and WebSockets, then wait for in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	stopWorkers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	go func() {
+		app.grpc.GracefulStop()
+		close(grpcStopped)
+	}()
+	// Streams are closed once the listener stops accepting connections; Shutdown does not wait
+	// for hijacked WebSocket connections, so closeStreams does
+	streamsClosed := make(chan error, 1)
+	server.RegisterOnShutdown(func() { streamsClosed <- app.closeStreams(ctx) })
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("HTTP server did not shut down in time:", err)
+	}
+	if err := <-streamsClosed; err != nil {
+		log.Println("Streams did not close in time:", err)
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		app.grpc.Stop()
+	}
+}
+
+// Servers and background services sharing one set of application layers
+type servers struct {
+	router   *mux.Router
+	grpc     *grpc.Server
+	events   *services.UserEventBus
+	sockets  *handlers.WebSocketHandler
+	outbox   *services.OutboxRelay    // Run publishes user events from the outbox
+	webhooks *services.WebhookService // Run delivers queued webhooks
+}
+
+// End open event streams and WebSockets and wait for them to finish
+func (s *servers) closeStreams(ctx context.Context) error {
+	s.events.Close()
+	return s.sockets.Wait(ctx)
+}
+
+// Wire application layers and register routes
+func newRouter(db *sql.DB, cfg config) *mux.Router {
+	return newServers(db, cfg).router
+}
+
+// Wire application layers into the HTTP router and the gRPC server, which share every service
+func newServers(db *sql.DB, cfg config) *servers {
+	// Initialize application layers
+	hasher := services.NewPasswordHasher(cfg.BcryptCost)
+	var userStore *repositories.UserEventStore
+	userRepo := repositories.NewUserRepository(db)
+	if cfg.UserStore == "events" {
+		userStore = repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval)
+		userRepo = repositories.NewEventSourcedUserRepository(db, userStore)
+	}
+	tokenRepo := repositories.NewRefreshTokenRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	mfaRepo := repositories.NewMFARepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
+	userTokenRepo := repositories.NewUserTokenRepository(db)
+	invitationRepo := repositories.NewInvitationRepository(db, userStore)
+	groupRepo := repositories.NewGroupRepository(db)
+	orgRepo := repositories.NewOrganizationRepository(db)
+	attributeRepo := repositories.NewUserAttributeRepository(db)
+	tagRepo := repositories.NewTagRepository(db, userStore)
+	webhookRepo := repositories.NewWebhookRepository(db)
+	outboxRepo := repositories.NewOutboxRepository(db)
+	var attemptStore services.AttemptStore = repositories.NewLoginAttemptRepository(db)
+	if cfg.LockoutStore == "memory" {
+		attemptStore = repositories.NewMemoryLoginAttemptStore()
+	}
+	var searchIndex services.UserSearchIndex = repositories.NewMemoryUserSearch(userRepo)
+	if cfg.SearchBackend != "memory" {
+		if err := repositories.EnableUserSearchIndex(db); err == nil {
+			searchIndex = repositories.NewUserSearchRepository(db)
+		} else if cfg.SearchBackend == "fts" || !errors.Is(err, repositories.ErrFTS5Unavailable) {
+			log.Println("Full-text search index unavailable, falling back to in-memory search:", err)
+		}
+	}
+	authService := services.NewAuthService(userRepo, tokenRepo, hasher, services.AuthConfig{
+		Secret:     cfg.AuthSecret,
+		AccessTTL:  cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}, cfg.Clock)
+	sessionService := services.NewSessionService(sessionRepo, services.SessionConfig{
+		IdleTimeout:     cfg.SessionIdle,
+		AbsoluteTimeout: cfg.SessionMaxAge,
+	}, cfg.Clock)
+	mfaService := services.NewMFAService(mfaRepo, userRepo, cfg.MFAIssuer, cfg.Clock)
+	auditService := services.NewAuditService(auditRepo, cfg.Clock)
+	attributeService := services.NewUserAttributeService(attributeRepo)
+	userEvents := services.NewUserEventBus(services.DefaultEventReplaySize, cfg.Clock)
+	webhookService := services.NewWebhookService(webhookRepo, cfg.Webhooks, cfg.Clock)
+	// Events reach the change feed, the webhook queue and the configured external publisher, each at its own pace
+	publishers := []services.OutboxPublisher{
+		{Name: "feed", Publisher: publisher.Func(func(_ context.Context, event models.UserEvent) error {
+			userEvents.Publish(event)
+			return nil
+		})},
+		{Name: "webhooks", Publisher: publisher.Func(func(_ context.Context, event models.UserEvent) error {
+			return webhookService.Enqueue(event)
+		})},
+	}
+	if cfg.Publisher != nil {
+		publishers = append(publishers, services.OutboxPublisher{Name: "external", Publisher: cfg.Publisher})
+	}
+	outbox := services.NewOutboxRelay(outboxRepo, publishers, cfg.Outbox, cfg.Clock)
+	userService := services.NewUserService(userRepo, tokenRepo, sessionRepo, hasher, auditService, attributeService, outbox, cfg.Clock)
+	lockoutService := services.NewLockoutService(attemptStore, auditService, userRepo, cfg.Lockout, cfg.Clock)
+	accountService := services.NewAccountService(userRepo, userTokenRepo, tokenRepo, sessionRepo, hasher, cfg.Mailer, services.AccountConfig{
+		BaseURL:          cfg.BaseURL,
+		VerificationTTL:  48 * time.Hour,
+		PasswordResetTTL: time.Hour,
+	}, cfg.Clock)
+	invitationService := services.NewInvitationService(invitationRepo, userRepo, attributeService, hasher, cfg.Mailer, outbox, services.InvitationConfig{
+		BaseURL: cfg.BaseURL,
+		TTL:     7 * 24 * time.Hour,
+	}, cfg.Clock)
+	groupService := services.NewGroupService(groupRepo, userRepo, cfg.Clock)
+	orgService := services.NewOrganizationService(orgRepo, cfg.Clock)
+	tagService := services.NewTagService(tagRepo, userRepo, outbox, cfg.Clock)
+	searchService := services.NewUserSearchService(searchIndex)
+	userHandler := handlers.NewUserHandler(userService)
+	authHandler := handlers.NewAuthHandler(authService, sessionService, userService, mfaService, lockoutService, cfg.SecureCookies)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	securityHandler := handlers.NewSecurityHandler(lockoutService, auditService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	groupHandler := handlers.NewGroupHandler(groupService)
+	orgHandler := handlers.NewOrganizationHandler(orgService)
+	attributeHandler := handlers.NewUserAttributeHandler(attributeService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	v2UserHandler := v2.NewUserHandler(userService)
+	graphQLHandler := gql.NewHandler(userService, cfg.DevMode)
+	scimHandler := scim.NewHandler(userService, groupService)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	userEventHandler := handlers.NewUserEventHandler(userEvents)
+	webSocketHandler := handlers.NewWebSocketHandler(userEvents, groupService, allowedOrigins)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	authenticator := handlers.NewAuthenticator(authService, sessionService, userService, orgService)
+
+	// Set up routing
+	router := mux.NewRouter()
+	router.Use(authenticator.Middleware)
+
+	router.HandleFunc("/openapi.json", handlers.OpenAPI).Methods("GET")
+	router.HandleFunc("/docs", handlers.APIReference).Methods("GET")
+	router.Handle("/graphql", csrf(graphQLHandler.Query)).Methods("POST")
+	router.HandleFunc("/graphql", graphQLHandler.GraphiQL).Methods("GET")
+	router.Handle("/ws", authed(webSocketHandler.Connect)).Methods("GET")
+
+	apiV2 := router.PathPrefix("/v2").Subrouter()
+	apiV2.HandleFunc("/users", v2UserHandler.ListUsers).Methods("GET")
+	apiV2.HandleFunc("/users/{id}", v2UserHandler.GetUser).Methods("GET")
+	apiV2.Handle("/users", csrf(v2UserHandler.CreateUser)).Methods("POST")
+	apiV2.Handle("/users/{id}", csrf(v2UserHandler.UpdateUser)).Methods("PUT")
+	apiV2.Handle("/users/{id}", csrf(v2UserHandler.DeleteUser)).Methods("DELETE")
+
+	scimAPI := router.PathPrefix(scim.BasePath).Subrouter()
+	scimAPI.HandleFunc("/ServiceProviderConfig", scimHandler.GetServiceProviderConfig).Methods("GET")
+	scimAPI.HandleFunc("/ResourceTypes", scimHandler.GetResourceTypes).Methods("GET")
+	scimAPI.HandleFunc("/ResourceTypes/{id}", scimHandler.GetResourceType).Methods("GET")
+	scimAPI.HandleFunc("/Schemas", scimHandler.GetSchemas).Methods("GET")
+	scimAPI.HandleFunc("/Schemas/{id}", scimHandler.GetSchema).Methods("GET")
+	scimAPI.Handle("/Users", scimAdmin(scimHandler.ListUsers)).Methods("GET")
+	scimAPI.Handle("/Users", scimAdmin(scimHandler.CreateUser)).Methods("POST")
+	scimAPI.Handle("/Users/{id}", scimAdmin(scimHandler.GetUser)).Methods("GET")
+	scimAPI.Handle("/Users/{id}", scimAdmin(scimHandler.ReplaceUser)).Methods("PUT")
+	scimAPI.Handle("/Users/{id}", scimAdmin(scimHandler.PatchUser)).Methods("PATCH")
+	scimAPI.Handle("/Users/{id}", scimAdmin(scimHandler.DeleteUser)).Methods("DELETE")
+	scimAPI.Handle("/Groups", scimAdmin(scimHandler.ListGroups)).Methods("GET")
+	scimAPI.Handle("/Groups", scimAdmin(scimHandler.CreateGroup)).Methods("POST")
+	scimAPI.Handle("/Groups/{id}", scimAdmin(scimHandler.GetGroup)).Methods("GET")
+	scimAPI.Handle("/Groups/{id}", scimAdmin(scimHandler.ReplaceGroup)).Methods("PUT")
+	scimAPI.Handle("/Groups/{id}", scimAdmin(scimHandler.PatchGroup)).Methods("PATCH")
+	scimAPI.Handle("/Groups/{id}", scimAdmin(scimHandler.DeleteGroup)).Methods("DELETE")
+
+	// The v1 API, also served at the root as a deprecated alias
+	registerV1 := func(router *mux.Router) {
+		router.HandleFunc("/users", userHandler.GetAllUsers).Methods("GET")
+		// Registered before /users/{id} so "search" and "events" are not taken for an ID
+		router.HandleFunc("/users/search", searchHandler.SearchUsers).Methods("GET")
+		router.Handle("/users/events", authed(userEventHandler.StreamEvents)).Methods("GET")
+		router.HandleFunc("/users/{id}", userHandler.GetUserByID).Methods("GET")
+		router.Handle("/users", csrf(userHandler.CreateUser)).Methods("POST")
+		router.Handle("/users/{id}", authed(userHandler.UpdateUser)).Methods("PUT")
+		router.Handle("/users/{id}", authed(userHandler.DeleteUser)).Methods("DELETE")
+		router.Handle("/users/{id}/password", authed(authHandler.ChangePassword)).Methods("POST")
+
+		router.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+		router.HandleFunc("/auth/login/mfa", authHandler.LoginMFA).Methods("POST")
+		router.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+		router.Handle("/auth/logout", csrf(authHandler.Logout)).Methods("POST")
+		router.HandleFunc("/auth/session", authHandler.GetSession).Methods("GET")
+
+		router.Handle("/auth/mfa/enroll", authed(mfaHandler.Enroll)).Methods("POST")
+		router.Handle("/auth/mfa/confirm", authed(mfaHandler.Confirm)).Methods("POST")
+		router.Handle("/users/{id}/mfa", admin(mfaHandler.Reset)).Methods("DELETE")
+		router.Handle("/users/{id}/suspend", admin(userHandler.SuspendUser)).Methods("POST")
+		router.Handle("/users/{id}/activate", admin(userHandler.ActivateUser)).Methods("POST")
+		router.Handle("/users/{id}/deactivate", admin(userHandler.DeactivateUser)).Methods("POST")
+		router.Handle("/users/{id}/unlock", admin(securityHandler.UnlockUser)).Methods("POST")
+		router.Handle("/audit-events", admin(securityHandler.GetAuditEvents)).Methods("GET")
+
+		router.Handle("/users/{id}/verify-email", authed(accountHandler.SendVerification)).Methods("POST")
+		router.HandleFunc("/users/{id}/verify-email/confirm", accountHandler.ConfirmVerification).Methods("POST")
+		router.HandleFunc("/auth/password-reset", accountHandler.RequestPasswordReset).Methods("POST")
+		router.HandleFunc("/auth/password-reset/confirm", accountHandler.ConfirmPasswordReset).Methods("POST")
+
+		router.Handle("/invitations", admin(invitationHandler.GetInvitations)).Methods("GET")
+		router.Handle("/invitations", admin(invitationHandler.CreateInvitation)).Methods("POST")
+		router.HandleFunc("/invitations/{token}/accept", invitationHandler.AcceptInvitation).Methods("POST")
+		router.Handle("/invitations/{id}/resend", admin(invitationHandler.ResendInvitation)).Methods("POST")
+		router.Handle("/invitations/{id}", admin(invitationHandler.RevokeInvitation)).Methods("DELETE")
+
+		router.HandleFunc("/groups", groupHandler.GetGroups).Methods("GET")
+		router.HandleFunc("/groups/{id}", groupHandler.GetGroup).Methods("GET")
+		router.Handle("/groups", admin(groupHandler.CreateGroup)).Methods("POST")
+		router.Handle("/groups/{id}", admin(groupHandler.UpdateGroup)).Methods("PUT")
+		router.Handle("/groups/{id}", admin(groupHandler.DeleteGroup)).Methods("DELETE")
+		router.Handle("/groups/{id}/members", admin(groupHandler.AddMember)).Methods("POST")
+		router.Handle("/groups/{id}/members/{userId}", admin(groupHandler.RemoveMember)).Methods("DELETE")
+		router.HandleFunc("/users/{id}/groups", groupHandler.GetUserGroups).Methods("GET")
+
+		router.Handle("/organizations", platformAdmin(orgHandler.GetOrganizations)).Methods("GET")
+		router.Handle("/organizations", platformAdmin(orgHandler.CreateOrganization)).Methods("POST")
+
+		router.HandleFunc("/user-attributes", attributeHandler.GetAttributes).Methods("GET")
+		router.Handle("/user-attributes/{name}", platformAdmin(attributeHandler.SaveAttribute)).Methods("PUT")
+		router.Handle("/user-attributes/{name}", platformAdmin(attributeHandler.DeleteAttribute)).Methods("DELETE")
+
+		router.HandleFunc("/tags", tagHandler.GetTags).Methods("GET")
+		router.Handle("/users/{id}/tags", admin(tagHandler.AddUserTags)).Methods("POST")
+		router.Handle("/users/{id}/tags/{tag}", admin(tagHandler.RemoveUserTag)).Methods("DELETE")
+
+		router.Handle("/webhooks", admin(webhookHandler.GetWebhooks)).Methods("GET")
+		router.Handle("/webhooks", admin(webhookHandler.CreateWebhook)).Methods("POST")
+		router.Handle("/webhooks/{id}", admin(webhookHandler.GetWebhook)).Methods("GET")
+		router.Handle("/webhooks/{id}", admin(webhookHandler.UpdateWebhook)).Methods("PUT")
+		router.Handle("/webhooks/{id}", admin(webhookHandler.DeleteWebhook)).Methods("DELETE")
+		router.Handle("/webhooks/{id}/deliveries", admin(webhookHandler.GetDeliveries)).Methods("GET")
+		router.Handle("/webhooks/{id}/deliveries/{deliveryId}/retry", admin(webhookHandler.RetryDelivery)).Methods("POST")
+	}
+	registerV1(router.PathPrefix("/v1").Subrouter())
+	root := router.NewRoute().Subrouter()
+	root.Use(handlers.Deprecated(rootDeprecatedAt, rootSunset, "/v1"))
+	registerV1(root)
+
+	return &servers{
+		router:   router,
+		grpc:     rpc.NewServer(authenticator, userService),
+		events:   userEvents,
+		sockets:  webSocketHandler,
+		outbox:   outbox,
+		webhooks: webhookService,
+	}
+}
+
+// Wrap a mutating handler with CSRF protection for cookie sessions
+func csrf(h http.HandlerFunc) http.Handler {
+	return handlers.RequireCSRF(h)
+}
+
+// Restrict a handler to authenticated users
+func authed(h http.HandlerFunc) http.Handler {
+	return handlers.RequireCSRF(handlers.RequireAuth(h))
+}
+
+// Restrict a handler to administrators who completed a second factor
+func admin(h http.HandlerFunc) http.Handler {
+	return handlers.RequireCSRF(handlers.RequireAdmin(h))
+}
+
+// Restrict a SCIM handler to administrators who completed a second factor, with SCIM error bodies
+func scimAdmin(h http.HandlerFunc) http.Handler {
+	return handlers.RequireCSRF(scim.RequireAdmin(h))
+}
+
+// Restrict a handler to administrators of the default organization
+func platformAdmin(h http.HandlerFunc) http.Handler {
+	return handlers.RequireCSRF(handlers.RequirePlatformAdmin(h))
 }
@@ -6,15 +6,18 @@ import (
 	"encoding/json"
 	"log"
 	"myapp/handlers"
+	"myapp/mailer"
 	"myapp/models"
 	"myapp/repositories"
 	"myapp/services"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -22,27 +25,20 @@ var (
 	userHandler *handlers.UserHandler
 )
 
-func init() {
-	var err error
-	db, err = sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		log.Fatal(err)
+func setupTestDatabase(t *testing.T) {
+	if db != nil {
+		db.Close()
 	}
-}
 
-func setupTestDatabase(t *testing.T) {
-	_, err := db.Exec("DROP TABLE IF EXISTS users")
+	// A single connection keeps every query on the same in-memory database
+	var err error
+	db, err = sql.Open("sqlite3", ":memory:?_foreign_keys=on")
 	if err != nil {
-		t.Fatal(err)
+		log.Fatal(err)
 	}
+	db.SetMaxOpenConns(1)
 
-	createTableSQL := `CREATE TABLE users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		email TEXT
-	);`
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
+	if err := repositories.Migrate(db); err != nil {
 		t.Fatal(err)
 	}
 
@@ -56,10 +52,124 @@ func setupTestDatabase(t *testing.T) {
 func setupHandler(t *testing.T) {
 	setupTestDatabase(t)
 	userRepo := repositories.NewUserRepository(db)
-	userService := services.NewUserService(userRepo)
+	userService := services.NewUserService(
+		userRepo,
+		repositories.NewRefreshTokenRepository(db),
+		repositories.NewSessionRepository(db),
+		services.NewPasswordHasher(bcrypt.MinCost),
+		services.NewAuditService(repositories.NewAuditRepository(db), services.SystemClock{}),
+		services.NewUserAttributeService(repositories.NewUserAttributeRepository(db)),
+		services.NewOutboxRelay(repositories.NewOutboxRepository(db), nil, services.OutboxConfig{}, services.SystemClock{}),
+		services.SystemClock{},
+	)
 	userHandler = handlers.NewUserHandler(userService)
 }
 
+// Configuration used by router tests
+func testConfig() config {
+	return config{
+		AuthSecret:      []byte("test-secret"),
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		BcryptCost:      bcrypt.MinCost,
+		SessionIdle:     time.Minute,
+		SessionMaxAge:   time.Hour,
+		MFAIssuer:       "Test",
+		Lockout: services.LockoutConfig{
+			AccountThreshold: 3,
+			IPThreshold:      10,
+			Window:           15 * time.Minute,
+			BaseLockout:      time.Minute,
+			MaxLockout:       time.Hour,
+		},
+		Webhooks: services.WebhookConfig{
+			MaxAttempts:  3,
+			BaseBackoff:  time.Minute,
+			MaxBackoff:   time.Hour,
+			Timeout:      5 * time.Second,
+			PollInterval: time.Second,
+			Workers:      4,
+			// Test receivers listen on 127.0.0.1
+			AllowPrivate: true,
+		},
+		Outbox: services.OutboxConfig{
+			PollInterval: time.Second,
+			Retention:    time.Hour,
+		},
+		BaseURL: "http://frontend.test",
+		Mailer:  mailer.NewMemoryMailer(),
+		Clock:   services.SystemClock{},
+	}
+}
+
+// Build the full application router on a fresh test database
+func setupRouter(t *testing.T) *mux.Router {
+	setupTestDatabase(t)
+	return newRouter(db, testConfig())
+}
+
+// Clock that only moves when a test advances it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// Send a JSON request through the router and return the recorded response
+func doJSON(t *testing.T, router http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONWithToken(t, router, method, path, body, "")
+}
+
+// Send a JSON request with an optional Bearer access token
+func doJSONWithToken(t *testing.T, router http.Handler, method, path string, body any, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Issue an access token for a user of the default organization as logging in would,
+// with mfa set as if the user completed a second factor
+func accessToken(t *testing.T, cfg config, userID int, mfa bool) string {
+	t.Helper()
+	return accessTokenInOrg(t, cfg, models.DefaultOrgID, userID, mfa)
+}
+
+// Issue an access token for a user of the given organization
+func accessTokenInOrg(t *testing.T, cfg config, orgID, userID int, mfa bool) string {
+	t.Helper()
+	auth := services.NewAuthService(
+		repositories.NewUserRepository(db),
+		repositories.NewRefreshTokenRepository(db),
+		services.NewPasswordHasher(cfg.BcryptCost),
+		services.AuthConfig{Secret: cfg.AuthSecret, AccessTTL: cfg.AccessTokenTTL, RefreshTTL: cfg.RefreshTokenTTL},
+		cfg.Clock,
+	)
+	tokens, err := auth.IssueTokens(userID, orgID, mfa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
 // Test GET /users
 func TestGetAllUsers(t *testing.T) {
 	setupHandler(t)
@@ -144,73 +254,66 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
-// Test PUT /users/{id} with existing user
+// Test PUT /users/{id} by the user themselves
 func TestUpdateUser(t *testing.T) {
-	setupHandler(t)
-
-	updatedUser := models.User{ID: 1, Name: "Alice Updated", Email: "alice.updated@example.com"}
-	jsonData, _ := json.Marshal(updatedUser)
-
-	req := httptest.NewRequest("PUT", "/users/1", bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	rr := httptest.NewRecorder()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/users/{id}", userHandler.UpdateUser)
-	router.ServeHTTP(rr, req)
+	router := setupRouter(t)
+	bob := loginTestUser(t, router)
 
+	updatedUser := models.User{ID: 2, Name: "Bob Updated", Email: "bob.updated@example.com"}
+	rr := doJSONWithToken(t, router, "PUT", "/users/2", updatedUser, bob.AccessToken)
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
+
+	// Anonymous callers, other users and password changes are refused
+	if rr := doJSON(t, router, "PUT", "/users/2", updatedUser); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous update: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/users/1", updatedUser, bob.AccessToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Update of another user: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	withPassword := models.User{Name: "Bob", Email: "bob@example.com", Password: "new password"}
+	if rr := doJSONWithToken(t, router, "PUT", "/users/2", withPassword, bob.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Update with password: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
 }
 
-// Test PUT /users/{id} with non-existing user
+// Test PUT /users/{id} by an administrator with non-existing user
 func TestUpdateUser_NotFound(t *testing.T) {
-	setupHandler(t)
+	router := setupRouter(t)
+	db.Exec("UPDATE users SET role = 'admin' WHERE id = 1")
 
 	updatedUser := models.User{Name: "Updated Name", Email: "updated@example.com"}
-	jsonData, _ := json.Marshal(updatedUser)
-
-	req := httptest.NewRequest("PUT", "/users/999", bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	rr := httptest.NewRecorder()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/users/{id}", userHandler.UpdateUser)
-	router.ServeHTTP(rr, req)
-
+	rr := doJSONWithToken(t, router, "PUT", "/users/999", updatedUser, accessToken(t, testConfig(), 1, true))
 	if status := rr.Code; status != http.StatusNotFound {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
 	}
 }
 
-// Test DELETE /users/{id} with existing user
+// Test DELETE /users/{id} by the user themselves
 func TestDeleteUser(t *testing.T) {
-	setupHandler(t)
+	router := setupRouter(t)
 
-	req := httptest.NewRequest("DELETE", "/users/1", nil)
-	rr := httptest.NewRecorder()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/users/{id}", userHandler.DeleteUser)
-	router.ServeHTTP(rr, req)
+	if rr := doJSON(t, router, "DELETE", "/users/1", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous delete: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	bob := loginTestUser(t, router)
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, bob.AccessToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Delete of another user: got %v want %v", rr.Code, http.StatusForbidden)
+	}
 
+	rr := doJSONWithToken(t, router, "DELETE", "/users/2", nil, bob.AccessToken)
 	if status := rr.Code; status != http.StatusNoContent {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
 	}
 }
 
-// Test DELETE /users/{id} with non-existing user
+// Test DELETE /users/{id} by an administrator with non-existing user
 func TestDeleteUser_NotFound(t *testing.T) {
-	setupHandler(t)
-
-	req := httptest.NewRequest("DELETE", "/users/999", nil)
-	rr := httptest.NewRecorder()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/users/{id}", userHandler.DeleteUser)
-	router.ServeHTTP(rr, req)
+	router := setupRouter(t)
+	db.Exec("UPDATE users SET role = 'admin' WHERE id = 1")
 
+	rr := doJSONWithToken(t, router, "DELETE", "/users/999", nil, accessToken(t, testConfig(), 1, true))
 	if status := rr.Code; status != http.StatusNotFound {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
 	}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mfaLoginResponse struct {
+	models.TokenPair
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// Decode a JSON response body into v
+func decodeBody(t *testing.T, body io.Reader, v any) {
+	t.Helper()
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func login(t *testing.T, router http.Handler, email, password string) mfaLoginResponse {
+	t.Helper()
+	rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: email, Password: password})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var resp mfaLoginResponse
+	decodeBody(t, rr.Body, &resp)
+	return resp
+}
+
+// Enroll the logged-in user and return the TOTP secret and recovery codes
+func enrollMFA(t *testing.T, router http.Handler, clock *fakeClock, accessToken string) (string, []string) {
+	t.Helper()
+	rr := doJSONWithToken(t, router, "POST", "/auth/mfa/enroll", nil, accessToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enroll: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var enrollment models.MFAEnrollment
+	decodeBody(t, rr.Body, &enrollment)
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") || !strings.Contains(enrollment.ProvisioningURI, enrollment.Secret) {
+		t.Fatalf("Unexpected provisioning URI %q", enrollment.ProvisioningURI)
+	}
+
+	code, _ := services.GenerateTOTPCode(enrollment.Secret, clock.Now())
+	rr = doJSONWithToken(t, router, "POST", "/auth/mfa/confirm", map[string]string{"code": code}, accessToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("confirm: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	decodeBody(t, rr.Body, &confirmed)
+	return enrollment.Secret, confirmed.RecoveryCodes
+}
+
+// Test TOTP codes against the RFC 6238 SHA-1 test vectors
+func TestTOTPVectors(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := services.GenerateTOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("At %d: got %s want %s", unix, code, expected)
+		}
+	}
+}
+
+// Test enrollment, drift window, replay protection and recovery codes
+func TestMFALogin(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+
+	tokens := loginTestUser(t, router)
+	secret, recoveryCodes := enrollMFA(t, router, clock, tokens.AccessToken)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(recoveryCodes))
+	}
+
+	clock.Advance(2 * time.Minute)
+	challenge := login(t, router, "bob@example.com", "correct horse")
+	if !challenge.MFARequired || challenge.AccessToken != "" {
+		t.Fatalf("Expected an MFA challenge, got %+v", challenge)
+	}
+
+	// Codes more than one step old fall outside the drift window
+	stale, _ := services.GenerateTOTPCode(secret, clock.Now().Add(-90*time.Second))
+	rr := doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": stale})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Stale code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	drifted, _ := services.GenerateTOTPCode(secret, clock.Now().Add(-30*time.Second))
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": drifted})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Drifted code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// A code is accepted only once
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": drifted})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Replayed code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Recovery codes work once, with or without formatting
+	recovery := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": recovery})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Recovery code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": recoveryCodes[0]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Reused recovery code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Challenge tokens expire
+	clock.Advance(10 * time.Minute)
+	code, _ := services.GenerateTOTPCode(secret, clock.Now())
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": code})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expired challenge: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test that only administrators who completed MFA can reset another user's enrollment
+func TestAdminMFAReset(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+
+	tokens := loginTestUser(t, router)
+	rr := doJSONWithToken(t, router, "DELETE", "/users/1/mfa", nil, tokens.AccessToken)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Non-admin reset: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	if _, err := db.Exec("UPDATE users SET role = 'admin' WHERE email = 'bob@example.com'"); err != nil {
+		t.Fatal(err)
+	}
+	rr = doJSONWithToken(t, router, "DELETE", "/users/1/mfa", nil, tokens.AccessToken)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Admin without MFA: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	secret, _ := enrollMFA(t, router, clock, tokens.AccessToken)
+	clock.Advance(time.Minute)
+	challenge := login(t, router, "bob@example.com", "correct horse")
+	code, _ := services.GenerateTOTPCode(secret, clock.Now())
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": code})
+	var adminTokens models.TokenPair
+	decodeBody(t, rr.Body, &adminTokens)
+
+	rr = doJSONWithToken(t, router, "DELETE", "/users/2/mfa", nil, adminTokens.AccessToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Admin reset: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if resp := login(t, router, "bob@example.com", "correct horse"); resp.MFARequired {
+		t.Error("Expected login without MFA after reset")
+	}
+}
+
+// Create an administrator with MFA enrolled and return an access token from an MFA login
+func setupAdmin(t *testing.T, router http.Handler, clock *fakeClock) string {
+	t.Helper()
+	rr := doJSON(t, router, "POST", "/users", models.User{Name: "Admin", Email: "admin@example.com", Password: "admin password"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create admin: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if _, err := db.Exec("UPDATE users SET role = 'admin' WHERE email = 'admin@example.com'"); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := login(t, router, "admin@example.com", "admin password")
+	secret, _ := enrollMFA(t, router, clock, tokens.AccessToken)
+	clock.Advance(time.Minute)
+
+	challenge := login(t, router, "admin@example.com", "admin password")
+	code, _ := services.GenerateTOTPCode(secret, clock.Now())
+	rr = doJSON(t, router, "POST", "/auth/login/mfa", map[string]string{"mfa_token": challenge.MFAToken, "code": code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("admin MFA login: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var adminTokens models.TokenPair
+	decodeBody(t, rr.Body, &adminTokens)
+	return adminTokens.AccessToken
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"myapp/repositories"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Email of every user by ID
+func userEmails(t *testing.T, db *sql.DB) map[int]string {
+	t.Helper()
+	rows, err := db.Query("SELECT id, email FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	emails := map[int]string{}
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			t.Fatal(err)
+		}
+		emails[id] = email
+	}
+	return emails
+}
+
+// Test migrating a database from before migrations that holds duplicate emails, like db/database.db
+func TestMigrateDuplicateEmails(t *testing.T) {
+	legacy, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	legacy.SetMaxOpenConns(1)
+
+	_, err = legacy.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		email TEXT
+	);
+	INSERT INTO users (id, name, email) VALUES
+		(6, 'John Doe', 'john@example.com'),
+		(7, 'John Doe', 'john@example.com'),
+		(8, 'Jane Doe', 'jane@example.com'),
+		(9, 'Johnny', 'john@example.com'),
+		(10, 'No Domain', 'local'),
+		(11, 'No Domain', 'local');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repositories.Migrate(legacy); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	want := map[int]string{
+		6:  "john@example.com",
+		7:  "john+duplicate-7@example.com",
+		8:  "jane@example.com",
+		9:  "john+duplicate-9@example.com",
+		10: "local",
+		11: "local+duplicate-11",
+	}
+	got := userEmails(t, legacy)
+	for id, email := range want {
+		if got[id] != email {
+			t.Errorf("User %d: got %q want %q", id, got[id], email)
+		}
+	}
+
+	// Migrating again is a no-op, and the unique index now holds
+	if err := repositories.Migrate(legacy); err != nil {
+		t.Fatalf("Second migrate: %v", err)
+	}
+	if _, err := legacy.Exec("INSERT INTO users (name, email) VALUES ('Copy', 'john@example.com')"); err == nil {
+		t.Error("Expected the unique email index to reject a duplicate")
+	}
+}
+
+// Test that a copy of the shipped database migrates
+func TestMigrateShippedDatabase(t *testing.T) {
+	src, err := os.Open("db/database.db")
+	if err != nil {
+		t.Skip("shipped database not present:", err)
+	}
+	defer src.Close()
+	path := filepath.Join(t.TempDir(), "database.db")
+	dst, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+
+	shipped, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shipped.Close()
+	if err := repositories.Migrate(shipped); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	seen := map[string]int{}
+	for id, email := range userEmails(t, shipped) {
+		if other, ok := seen[email]; ok {
+			t.Errorf("Users %d and %d share email %q", other, id, email)
+		}
+		seen[email] = id
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Audit Models: Defines security-relevant events recorded for review
+
+// Audit event types
+const (
+	AuditAccountLocked   = "account.locked"
+	AuditIPLocked        = "ip.locked"
+	AuditAccountUnlocked = "account.unlocked"
+	AuditUserActivated   = "user.activated"
+	AuditUserSuspended   = "user.suspended"
+	AuditUserDeactivated = "user.deactivated"
+)
+
+type AuditEvent struct {
+	ID        int       `json:"id"`                 // Unique identifier for the event
+	OrgID     int       `json:"org_id"`             // Organization the event belongs to
+	Type      string    `json:"type"`               // Event type, e.g. "account.locked"
+	ActorID   *int      `json:"actor_id,omitempty"` // User who caused the event, if any
+	Subject   string    `json:"subject"`            // What the event is about, e.g. an email or IP
+	Details   string    `json:"details,omitempty"`  // Free-form description
+	CreatedAt time.Time `json:"created_at"`         // When the event happened
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Group Model: Defines a team of users and their membership roles
+// Users can belong to many groups, with one role in each
+
+// Member roles within a group
+const (
+	GroupRoleMember = "member"
+	GroupRoleOwner  = "owner"
+)
+
+type Group struct {
+	ID          int           `json:"id"`                // Unique identifier for the group
+	OrgID       int           `json:"org_id"`            // Organization the group belongs to
+	Name        string        `json:"name"`              // Group name, unique across groups
+	Description string        `json:"description"`       // Optional free-form description
+	CreatedAt   time.Time     `json:"created_at"`        // When the group was created
+	Members     []GroupMember `json:"members,omitempty"` // Populated when a single group is fetched
+}
+
+type GroupMember struct {
+	GroupID  int       `json:"group_id"`  // Group the user belongs to
+	UserID   int       `json:"user_id"`   // Member user
+	Name     string    `json:"name"`      // Member's name, for display
+	Email    string    `json:"email"`     // Member's email, for display
+	Role     string    `json:"role"`      // member or owner
+	JoinedAt time.Time `json:"joined_at"` // When the user joined the group
+}
+
+// A group as seen from one of its members
+type UserGroup struct {
+	Group
+	Role     string    `json:"role"`      // The user's role in the group
+	JoinedAt time.Time `json:"joined_at"` // When the user joined the group
+}
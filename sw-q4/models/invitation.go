@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Invitation Model: Defines an invitation for a pending user to join
+// The invite token is emailed to the invitee and only its hash is stored
+
+// Invitation states, derived from the timestamps
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+type Invitation struct {
+	ID         int        `json:"id"`                    // Unique identifier for the invitation
+	OrgID      int        `json:"org_id"`                // Organization the invitee joins
+	UserID     *int       `json:"user_id"`               // Pending user created for the invitee
+	Email      string     `json:"email"`                 // Invitee's email address
+	Role       string     `json:"role"`                  // Role granted on acceptance
+	InvitedBy  *int       `json:"invited_by"`            // Administrator who sent the invitation
+	TokenHash  string     `json:"-"`                     // SHA-256 hash of the invite token
+	ExpiresAt  time.Time  `json:"expires_at"`            // Invite token expiry
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"` // Set when the invitee accepts
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`  // Set when an administrator revokes it
+	CreatedAt  time.Time  `json:"created_at"`            // When the invitation was first sent
+	Status     string     `json:"status"`                // pending, accepted, revoked or expired
+}
+
+// Derive the invitation state at the given time
+func (i *Invitation) StatusAt(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
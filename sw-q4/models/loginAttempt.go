@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Login Attempt Model: Tracks failed logins for a throttling key
+// Keys identify either an account ("account:<email>") or a client ("ip:<address>")
+
+type LoginAttempt struct {
+	Key           string     // Throttling key
+	Failures      int        // Consecutive failures within the tracking window
+	LastFailureAt time.Time  // Most recent failure
+	LockedUntil   *time.Time // Set while the key is locked out
+}
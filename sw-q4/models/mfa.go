@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// MFA Models: Defines TOTP enrollment state for a user
+// The shared secret is never serialized after enrollment
+
+type MFA struct {
+	UserID       int        // Owner of the enrollment
+	Secret       string     // Base32 TOTP shared secret
+	EnabledAt    *time.Time // Set once the first code is confirmed
+	LastUsedStep int64      // Last accepted time step, prevents code replay
+	CreatedAt    time.Time  // Enrollment start time
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`           // Base32 secret for manual entry
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to render as a QR code
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Organization Model: Defines a tenant of the deployment
+// Users and their data belong to exactly one organization
+
+// Organization that existing data and anonymous requests belong to
+const DefaultOrgID = 1
+
+type Organization struct {
+	ID        int       `json:"id"`         // Unique identifier for the organization
+	Name      string    `json:"name"`       // Display name
+	Slug      string    `json:"slug"`       // Unique, URL-safe short name
+	CreatedAt time.Time `json:"created_at"` // When the organization was created
+}
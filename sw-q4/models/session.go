@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session Model: Defines server-side cookie sessions
+// The session token itself is only stored as a hash
+
+type Session struct {
+	ID         int       `json:"-"`            // Unique identifier for the session
+	UserID     int       `json:"user_id"`      // Owner of the session
+	OrgID      int       `json:"org_id"`       // Organization of the owner, read from the user
+	TokenHash  string    `json:"-"`            // SHA-256 hash of the cookie value
+	CSRFToken  string    `json:"csrf_token"`   // Double-submit CSRF token bound to the session
+	CreatedAt  time.Time `json:"created_at"`   // Login time
+	LastSeenAt time.Time `json:"last_seen_at"` // Last authenticated request, for idle expiry
+	ExpiresAt  time.Time `json:"expires_at"`   // Absolute expiry
+	MFA        bool      `json:"mfa"`          // Whether the login completed a second factor
+}
@@ -0,0 +1,15 @@
+package models
+
+// Tag Model: Defines free-form labels attached to users
+// Tags belong to an organization and are shared by its users
+
+// Tag query modes for filtering users
+const (
+	TagsModeAny = "any" // Users with at least one of the tags
+	TagsModeAll = "all" // Users with every one of the tags
+)
+
+type Tag struct {
+	Name  string `json:"name"`  // Lowercase label, e.g. "beta"
+	Count int    `json:"count"` // Number of users with the tag
+}
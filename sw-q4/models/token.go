@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Token Models: Defines credentials and token structures for authentication
+// Refresh tokens are stored hashed and rotated on every use
+
+type Credentials struct {
+	OrgID    int    `json:"org_id,omitempty"` // Organization to log in to, default organization if omitted
+	Email    string `json:"email"`            // Login email address
+	Password string `json:"password"`         // Plain-text password
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`  // Short-lived signed access token
+	RefreshToken string `json:"refresh_token"` // Opaque single-use refresh token
+	TokenType    string `json:"token_type"`    // Always "Bearer"
+	ExpiresIn    int    `json:"expires_in"`    // Access token lifetime in seconds
+}
+
+type RefreshToken struct {
+	ID         int        // Unique identifier for the token record
+	UserID     int        // Owner of the token
+	OrgID      int        // Organization of the owner, read from the user
+	FamilyID   string     // Shared by all tokens rotated from the same login
+	TokenHash  string     // SHA-256 hash of the opaque token
+	ExpiresAt  time.Time  // Absolute expiry
+	RevokedAt  *time.Time // Set when rotated or revoked
+	ReplacedBy *int       // Token that replaced this one on rotation
+	MFA        bool       // Whether the login completed a second factor
+	CreatedAt  time.Time  // Issue time
+}
@@ -1,10 +1,56 @@
 package models
 
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
 // User Model: Defines the structure for user data
 // Provides JSON mapping for API communication
 
+// Roles a user can hold
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account states
+const (
+	StatusPending     = "pending"     // Invited, has not accepted yet
+	StatusActive      = "active"      // Can log in and use the system
+	StatusSuspended   = "suspended"   // Temporarily blocked by an administrator
+	StatusDeactivated = "deactivated" // Closed; kept for records and can be reactivated
+)
+
 type User struct {
-	ID    int    `json:"id"`    // Unique identifier for the user
-	Name  string `json:"name"`  // User's full name
-	Email string `json:"email"` // User's email address
+	ID              int            `json:"id"`                          // Unique identifier for the user
+	OrgID           int            `json:"org_id"`                      // Organization the user belongs to
+	Name            string         `json:"name"`                        // User's full name
+	Email           string         `json:"email"`                       // User's email address
+	Role            string         `json:"role"`                        // Access level: "user" or "admin"
+	Status          string         `json:"status"`                      // Account state: pending, active, suspended or deactivated
+	StatusReason    string         `json:"status_reason,omitempty"`     // Reason given for the last status change
+	StatusChangedAt *time.Time     `json:"status_changed_at,omitempty"` // When the status last changed
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`           // When the email address was confirmed, null if unverified
+	Attributes      map[string]any `json:"attributes"`                  // Custom attributes described by the attribute schema
+	Tags            []string       `json:"tags"`                        // Labels attached to the user, managed through the tag endpoints
+	CreatedAt       time.Time      `json:"created_at"`                  // When the user was created
+	UpdatedAt       time.Time      `json:"updated_at"`                  // When the profile or status last changed
+	Password        string         `json:"password,omitempty"`          // Plain-text password, accepted on input only
+	PasswordHash    string         `json:"-"`                           // Hashed password, never serialized
 }
+
+// JSON names of the User fields clients can select with ?fields=, in declaration order
+// Input-only and hidden fields are left out
+var UserFields = func() []string {
+	var fields []string
+	t := reflect.TypeOf(User{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && name != "password" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}()
@@ -0,0 +1,20 @@
+package models
+
+// User Attribute Model: Defines the schema for custom user attributes
+// Attribute values are stored on the user as a JSON object keyed by name
+
+// Attribute value types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+type AttributeDefinition struct {
+	Name        string   `json:"name"`                  // Key in the user's attributes object
+	Type        string   `json:"type"`                  // string, number or boolean
+	Required    bool     `json:"required"`              // Whether every new or updated user must set it
+	Enum        []string `json:"enum,omitempty"`        // Allowed values for string attributes
+	Pattern     string   `json:"pattern,omitempty"`     // Regular expression string values must match entirely
+	Description string   `json:"description,omitempty"` // Shown to administrators and clients
+}
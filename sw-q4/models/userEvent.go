@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// User Event Models: Defines the change notifications published when users are written
+// Events are recorded in the outbox with the write and relayed to publishers afterwards
+
+// User event types
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+type UserEvent struct {
+	ID         int64     `json:"id"`             // Increasing sequence number: the outbox position, or on a feed the position used to resume it
+	DedupID    string    `json:"dedup_id"`       // Unique per change and stable across redeliveries, for dropping duplicates
+	Type       string    `json:"type"`           // user.created, user.updated or user.deleted
+	OrgID      int       `json:"org_id"`         // Organization the user belongs to
+	UserID     int       `json:"user_id"`        // User that changed
+	User       *User     `json:"user,omitempty"` // The user after the change; omitted on delete
+	OccurredAt time.Time `json:"occurred_at"`    // When the change was written
+}
@@ -0,0 +1,18 @@
+package models
+
+import "myapp/filter"
+
+// User Filter: Criteria for listing users
+// Zero values mean "no restriction"
+
+type UserFilter struct {
+	Status     string         // Only users in this account state
+	Attributes map[string]any // Only users whose custom attributes have these values
+	Tags       []string       // Only users with these tags
+	TagsMode   string         // Whether users need "any" (default) or "all" of the tags
+	Expression filter.Expr    // Only users matching a parsed ?filter= expression
+	Fields     []string       // Only load these fields (JSON names); all fields when empty
+	AfterID    int            // Only users with a greater ID, for keyset pagination
+	Limit      int            // At most this many users; all matching users when zero
+	Offset     int            // Skip this many matching users, for offset pagination
+}
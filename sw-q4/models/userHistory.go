@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// User History Models: Defines the append-only events a user is rebuilt from when users are event-sourced
+// Unlike UserEvent notifications, these record each individual change and are never published
+
+// Stored user event types
+const (
+	EventUserCreated       = "UserCreated"       // Full initial state, also recorded when existing users are imported
+	EventNameChanged       = "NameChanged"       // name
+	EventEmailChanged      = "EmailChanged"      // email; clears the verification
+	EventRoleChanged       = "RoleChanged"       // role
+	EventAttributesChanged = "AttributesChanged" // attributes
+	EventPasswordChanged   = "PasswordChanged"   // no data; the hash stays in the users table
+	EventStatusChanged     = "StatusChanged"     // status and status_reason
+	EventEmailVerified     = "EmailVerified"     // no data; verified at the event time
+	EventTagsChanged       = "TagsChanged"       // tags; only the update time is projected, tags stay in user_tags
+	EventUserDeleted       = "UserDeleted"       // no data
+)
+
+type UserHistoryEvent struct {
+	ID         int64           `json:"id"`          // Position in the whole store
+	UserID     int             `json:"user_id"`     // User whose stream the event belongs to
+	OrgID      int             `json:"org_id"`      // Organization of the user
+	Version    int             `json:"version"`     // Position in the user's stream, starting at 1
+	Type       string          `json:"type"`        // One of the stored event types
+	Data       json.RawMessage `json:"data"`        // Fields set by the event
+	OccurredAt time.Time       `json:"occurred_at"` // When the change was made
+}
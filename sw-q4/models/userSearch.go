@@ -0,0 +1,17 @@
+package models
+
+// User Search Models: Ranked full-text search results
+// Highlights are HTML-escaped and mark matched words with <mark> tags
+
+type UserSearchResult struct {
+	User       User              `json:"user"`
+	Score      float64           `json:"score"`      // Relevance, higher is better
+	Highlights map[string]string `json:"highlights"` // Matched fields ("name", "email") with marked words
+}
+
+type UserSearchPage struct {
+	Results []UserSearchResult `json:"results"`
+	Total   int                `json:"total"` // Matches across all pages
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// User Token Model: Single-use, expiring tokens sent to users by email
+// Only a hash of the token is stored
+
+// Token purposes
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposePasswordReset = "password_reset"
+)
+
+type UserToken struct {
+	ID        int        // Unique identifier for the token record
+	UserID    int        // User the token was issued to
+	Purpose   string     // What the token may be used for
+	TokenHash string     // SHA-256 hash of the token
+	ExpiresAt time.Time  // Absolute expiry
+	UsedAt    *time.Time // Set once the token is consumed or superseded
+	CreatedAt time.Time  // Issue time
+}
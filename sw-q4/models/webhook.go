@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook Models: Defines outgoing webhook subscriptions and their delivery log
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"   // Waiting for its first or next attempt
+	DeliverySucceeded = "succeeded" // The receiver answered with a 2xx status
+	DeliveryDead      = "dead"      // Every attempt failed; can be retried by hand
+)
+
+type Webhook struct {
+	ID        int       `json:"id"`               // Unique identifier for the webhook
+	OrgID     int       `json:"org_id"`           // Organization whose user events are delivered
+	URL       string    `json:"url"`              // Endpoint receiving POST requests
+	Events    []string  `json:"events"`           // User event types to deliver; all types when empty
+	Secret    string    `json:"secret,omitempty"` // HMAC-SHA256 signing key, only returned when the webhook is created
+	Active    bool      `json:"active"`           // Inactive webhooks receive no new deliveries
+	CreatedAt time.Time `json:"created_at"`       // When the webhook was created
+	UpdatedAt time.Time `json:"updated_at"`       // When the webhook was last changed
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`                        // Unique identifier, sent as X-Webhook-ID
+	WebhookID      int             `json:"webhook_id"`                // Webhook the event is delivered to
+	EventID        int64           `json:"event_id"`                  // ID of the user event
+	EventType      string          `json:"event_type"`                // user.created, user.updated or user.deleted
+	Payload        json.RawMessage `json:"payload"`                   // Request body, identical on every attempt
+	Status         string          `json:"status"`                    // pending, succeeded or dead
+	Attempts       int             `json:"attempts"`                  // Requests made so far
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"` // When a pending delivery is tried next
+	ResponseStatus int             `json:"response_status,omitempty"` // HTTP status of the last attempt, 0 if none was received
+	LastError      string          `json:"last_error,omitempty"`      // Why the last attempt failed
+	CreatedAt      time.Time       `json:"created_at"`                // When the event was queued
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`    // When the delivery succeeded or was dead-lettered
+	URL            string          `json:"-"`                         // Webhook URL, loaded for sending
+	Secret         string          `json:"-"`                         // Webhook secret, loaded for signing
+}
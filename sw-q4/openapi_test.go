@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"myapp/docs"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Minimal view of the OpenAPI document, enough to compare it with the router
+type openAPIDoc struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Parameters []openAPIParameter `json:"parameters"`
+}
+
+type openAPIParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+var pathVariable = regexp.MustCompile(`\{([^}:]+)[^}]*\}`)
+
+// Routes registered outside the versioned APIs
+var topLevelPaths = map[string]bool{"/openapi.json": true, "/docs": true, "/graphql": true, "/ws": true}
+
+// Collect "METHOD /path" for every route, with root alias routes under their /v1 path
+func registeredOperations(t *testing.T, router *mux.Router) map[string]bool {
+	t.Helper()
+	operations := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // Subrouter prefixes
+		}
+		if !strings.HasPrefix(path, "/v1/") && !strings.HasPrefix(path, "/v2/") && !strings.HasPrefix(path, "/scim/") && !topLevelPaths[path] {
+			path = "/v1" + path
+		}
+		for _, method := range methods {
+			operations[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return operations
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(docs.OpenAPI, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return doc
+}
+
+// Test that the OpenAPI document describes exactly the registered routes
+func TestOpenAPICoversRoutes(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	doc := loadOpenAPI(t)
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi: got %q want 3.1.0", doc.OpenAPI)
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			key := strings.ToUpper(method) + " " + path
+			documented[key] = true
+
+			// Declared path parameters must match the template variables
+			var declared []string
+			for _, param := range op.Parameters {
+				if param.Ref != "" {
+					name := strings.TrimPrefix(param.Ref, "#/components/parameters/")
+					resolved, ok := doc.Components.Parameters[name]
+					if !ok {
+						t.Errorf("%s: unresolved parameter %s", key, param.Ref)
+						continue
+					}
+					param = resolved
+				}
+				if param.In == "path" {
+					declared = append(declared, param.Name)
+				}
+			}
+			var variables []string
+			for _, m := range pathVariable.FindAllStringSubmatch(path, -1) {
+				variables = append(variables, m[1])
+			}
+			sort.Strings(declared)
+			sort.Strings(variables)
+			if strings.Join(declared, ",") != strings.Join(variables, ",") {
+				t.Errorf("%s: path parameters %v, want %v", key, declared, variables)
+			}
+		}
+	}
+
+	registered := registeredOperations(t, router)
+	for key := range registered {
+		if !documented[key] {
+			t.Errorf("%s is registered but missing from openapi.json", key)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			t.Errorf("%s is in openapi.json but not registered", key)
+		}
+	}
+}
+
+// Test that the document and reference page are served
+func TestOpenAPIServed(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+
+	rr := doJSON(t, router, "GET", "/openapi.json", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("openapi.json: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type: got %q", got)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Error("openapi.json should not be deprecated")
+	}
+
+	rr = doJSON(t, router, "GET", "/docs", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("docs: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), `spec-url="/openapi.json"`) {
+		t.Error("Reference page does not load /openapi.json")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"myapp/publisher"
+	"myapp/repositories"
+	"myapp/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Relay outbox events in the background until the test ends
+func startOutbox(t *testing.T, app *servers) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.outbox.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func unpublishedEvents(t *testing.T) []models.UserEvent {
+	t.Helper()
+	events, err := repositories.NewOutboxRepository(db).Unpublished(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// Test that writes record events in their transaction and that the relay publishes them in order
+func TestOutboxRelay(t *testing.T) {
+	setupTestDatabase(t)
+	memory := publisher.NewMemoryPublisher()
+	cfg := testConfig()
+	cfg.Publisher = memory
+	app := newServers(db, cfg)
+	router := app.router
+	ctx := context.Background()
+
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	// A failed write leaves no event behind
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bobby", Email: "bob@example.com"}); rr.Code != http.StatusConflict {
+		t.Fatalf("Duplicate email: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/users/2", models.User{Name: "Robert", Email: "bob@example.com"}, accessToken(t, cfg, 2, false)); rr.Code != http.StatusOK {
+		t.Fatalf("Update user: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, cfg, 1, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete user: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	// Nothing is published until the relay runs
+	if pending := unpublishedEvents(t); len(pending) != 3 || len(memory.Events()) != 0 {
+		t.Fatalf("Before relay: %d pending, %d published", len(pending), len(memory.Events()))
+	}
+	if n, err := app.outbox.RelayPending(ctx); err != nil || n != 3 {
+		t.Fatalf("Relay: published %d, %v", n, err)
+	}
+	events := memory.Events()
+	types := []string{models.UserCreated, models.UserUpdated, models.UserDeleted}
+	for i, event := range events {
+		if event.Type != types[i] || event.DedupID == "" || (i > 0 && event.ID <= events[i-1].ID) {
+			t.Errorf("Event %d: got %+v", i, event)
+		}
+	}
+	if events[1].User == nil || events[1].User.Name != "Robert" || events[2].User != nil || events[2].UserID != 1 {
+		t.Errorf("Payloads: got %+v", events)
+	}
+	if events[0].DedupID == events[1].DedupID {
+		t.Error("Dedup IDs are not unique")
+	}
+	if n, _ := app.outbox.RelayPending(ctx); n != 0 || len(unpublishedEvents(t)) != 0 {
+		t.Errorf("Second relay: published %d", n)
+	}
+}
+
+// Test at-least-once delivery: a failed publisher is retried from its own cursor without holding up or repeating the others
+func TestOutboxRelayRetry(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	for _, name := range []string{"Bob", "Carol"} {
+		doJSON(t, router, "POST", "/users", models.User{Name: name, Email: name + "@example.com"})
+	}
+
+	first := publisher.NewMemoryPublisher()
+	last := publisher.NewMemoryPublisher()
+	failing := true
+	flaky := publisher.Func(func(ctx context.Context, event models.UserEvent) error {
+		if failing {
+			return errors.New("unavailable")
+		}
+		return last.Publish(ctx, event)
+	})
+	repo := repositories.NewOutboxRepository(db)
+	publishers := []services.OutboxPublisher{{Name: "first", Publisher: first}, {Name: "flaky", Publisher: flaky}}
+	relay := services.NewOutboxRelay(repo, publishers, testConfig().Outbox, services.SystemClock{})
+	ctx := context.Background()
+
+	if n, err := relay.RelayPending(ctx); err == nil || n != 0 {
+		t.Fatalf("Failing publisher: published %d, %v", n, err)
+	}
+	if got := len(first.Events()); got != 2 {
+		t.Errorf("Healthy publisher behind a failing one: got %d events, want 2", got)
+	}
+	// The cursors are stored, so a new relay carries on where this one stopped
+	failing = false
+	relay = services.NewOutboxRelay(repo, publishers, testConfig().Outbox, services.SystemClock{})
+	if n, err := relay.RelayPending(ctx); err != nil || n != 2 {
+		t.Fatalf("Retry: published %d, %v", n, err)
+	}
+	if len(first.Events()) != 2 || len(last.Events()) != 2 {
+		t.Errorf("Got %d and %d events, want 2 each", len(first.Events()), len(last.Events()))
+	}
+
+	// A new publisher starts with the events not yet marked published, keeping their dedup IDs
+	doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, testConfig(), 1, false))
+	pending := unpublishedEvents(t)
+	restarted := publisher.NewMemoryPublisher()
+	relay = services.NewOutboxRelay(repo, []services.OutboxPublisher{{Name: "restarted", Publisher: restarted}}, testConfig().Outbox, services.SystemClock{})
+	relay.RelayPending(ctx)
+	if got := restarted.Events(); len(got) != 1 || got[0].DedupID != pending[0].DedupID {
+		t.Errorf("Restarted relay: got %+v want %+v", got, pending)
+	}
+
+	// Published events are removed once the retention period has passed
+	if n, err := repo.DeletePublished(time.Now().Add(time.Hour)); err != nil || n != 3 {
+		t.Errorf("Delete published: removed %d, %v", n, err)
+	}
+}
+
+// Test the JSON line and HTTP publishers
+func TestEventPublishers(t *testing.T) {
+	event := models.UserEvent{ID: 7, DedupID: "evt_test", Type: models.UserDeleted, OrgID: 1, UserID: 3}
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := publisher.NewFilePublisher(&buf).Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	var line models.UserEvent
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line.DedupID != "evt_test" || buf.Bytes()[buf.Len()-1] != '\n' {
+		t.Errorf("File publisher wrote %q", buf.String())
+	}
+
+	status := http.StatusInternalServerError
+	var key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	p := publisher.NewHTTPPublisher(server.URL, 5*time.Second)
+	if err := p.Publish(ctx, event); err == nil {
+		t.Error("HTTP publisher: want error for a 500 response")
+	}
+	status = http.StatusAccepted
+	if err := p.Publish(ctx, event); err != nil || key != "evt_test" {
+		t.Errorf("HTTP publisher: got %v, Idempotency-Key %q", err, key)
+	}
+}
@@ -0,0 +1,39 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"myapp/models"
+	"os"
+	"sync"
+)
+
+// File Publisher: Writes each event as one line of JSON to a file or stdout
+
+type FilePublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFilePublisher(w io.Writer) *FilePublisher {
+	return &FilePublisher{w: w}
+}
+
+// Print events to standard output
+func NewStdoutPublisher() *FilePublisher {
+	return NewFilePublisher(os.Stdout)
+}
+
+func (p *FilePublisher) Publish(_ context.Context, event models.UserEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,49 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myapp/models"
+	"net/http"
+	"time"
+)
+
+// HTTP Publisher: POSTs each event as JSON to a fixed endpoint
+// The dedup ID is sent as Idempotency-Key; any status other than 2xx is a failure and is retried
+
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPPublisher(url string, timeout time.Duration) *HTTPPublisher {
+	return &HTTPPublisher{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, event models.UserEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.DedupID)
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event endpoint responded %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package publisher
+
+import (
+	"context"
+	"myapp/models"
+	"sync"
+)
+
+// Memory Publisher: Keeps published events in memory for tests
+
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []models.UserEvent
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event models.UserEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Return a copy of every event published so far
+func (p *MemoryPublisher) Events() []models.UserEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]models.UserEvent(nil), p.events...)
+}
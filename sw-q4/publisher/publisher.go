@@ -0,0 +1,21 @@
+package publisher
+
+import (
+	"context"
+	"myapp/models"
+)
+
+// Publisher: Abstraction for handing user events from the outbox to other systems
+// Implementations write JSON lines to a file or stdout, POST to an HTTP endpoint or keep events in memory
+// Delivery is at least once: an event may be published again after a failure or restart, with the same DedupID
+
+type Publisher interface {
+	Publish(ctx context.Context, event models.UserEvent) error
+}
+
+// Adapter allowing an ordinary function to be used as a Publisher
+type Func func(ctx context.Context, event models.UserEvent) error
+
+func (f Func) Publish(ctx context.Context, event models.UserEvent) error {
+	return f(ctx, event)
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"database/sql"
+	"myapp/models"
+)
+
+// Audit Repository: Appends and lists audit events
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Append an event to the audit log
+func (r *AuditRepository) Record(event *models.AuditEvent) error {
+	query := "INSERT INTO audit_events (org_id, type, actor_id, subject, details, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := r.db.Exec(query, event.OrgID, event.Type, event.ActorID, event.Subject, event.Details, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = int(id)
+	return nil
+}
+
+// List an organization's most recent events, optionally filtered by type
+func (r *AuditRepository) List(orgID int, eventType string, limit int) ([]models.AuditEvent, error) {
+	query := "SELECT id, org_id, type, actor_id, subject, details, created_at FROM audit_events WHERE org_id = ?"
+	args := []any{orgID}
+	if eventType != "" {
+		query += " AND type = ?"
+		args = append(args, eventType)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var actorID sql.NullInt64
+		if err := rows.Scan(&event.ID, &event.OrgID, &event.Type, &actorID, &event.Subject, &event.Details, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			event.ActorID = &id
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"myapp/filter"
+	"strings"
+	"time"
+)
+
+// Filter SQL: Compiles parsed filter expressions into parameterized WHERE clauses
+// Only fields listed in a field map can be queried, and every value is bound as an argument
+
+type fieldKind int
+
+const (
+	fieldString fieldKind = iota
+	fieldNumber
+	fieldTime
+)
+
+// A queryable field and the column that stores it
+type filterField struct {
+	column string
+	kind   fieldKind
+}
+
+// Fields accepted in ?filter= expressions on /users
+var userFilterFields = map[string]filterField{
+	"id":                {"users.id", fieldNumber},
+	"name":              {"users.name", fieldString},
+	"email":             {"users.email", fieldString},
+	"role":              {"users.role", fieldString},
+	"status":            {"users.status", fieldString},
+	"created_at":        {"users.created_at", fieldTime},
+	"updated_at":        {"users.updated_at", fieldTime},
+	"email_verified_at": {"users.email_verified_at", fieldTime},
+	"status_changed_at": {"users.status_changed_at", fieldTime},
+}
+
+// Fields accepted in filter expressions on groups
+var groupFilterFields = map[string]filterField{
+	"id":          {"groups.id", fieldNumber},
+	"name":        {"groups.name", fieldString},
+	"description": {"groups.description", fieldString},
+	"created_at":  {"groups.created_at", fieldTime},
+}
+
+var comparisonSQL = map[string]string{
+	filter.OpEq: "=", filter.OpNe: "!=",
+	filter.OpGt: ">", filter.OpGe: ">=", filter.OpLt: "<", filter.OpLe: "<=",
+}
+
+// Accepted layouts for time values
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// Compile an expression to SQL, checking fields and values against fields
+func compileFilter(expr filter.Expr, fields map[string]filterField) (string, []any, error) {
+	switch e := expr.(type) {
+	case *filter.Logical:
+		left, leftArgs, err := compileFilter(e.Left, fields)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := compileFilter(e.Right, fields)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(e.Op) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case *filter.Not:
+		inner, args, err := compileFilter(e.Expr, fields)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + inner, args, nil
+	case *filter.Comparison:
+		return compileComparison(e, fields)
+	}
+	panic("unknown filter expression")
+}
+
+func compileComparison(c *filter.Comparison, fields map[string]filterField) (string, []any, error) {
+	field, ok := fields[c.Field]
+	if !ok {
+		return "", nil, c.FieldError("unknown field")
+	}
+	column := field.column
+
+	if c.Op == filter.OpPresent {
+		if field.kind == fieldString {
+			return "(" + column + " IS NOT NULL AND " + column + " != '')", nil, nil
+		}
+		return column + " IS NOT NULL", nil, nil
+	}
+	if c.Value == nil {
+		switch c.Op {
+		case filter.OpEq:
+			return column + " IS NULL", nil, nil
+		case filter.OpNe:
+			return column + " IS NOT NULL", nil, nil
+		}
+		return "", nil, c.ValueError("null can only be compared with eq or ne")
+	}
+
+	op, isComparison := comparisonSQL[c.Op]
+	if !isComparison && field.kind != fieldString {
+		return "", nil, c.OpError("operator only applies to strings")
+	}
+
+	var value any
+	switch field.kind {
+	case fieldString:
+		s, ok := c.Value.(string)
+		if !ok {
+			return "", nil, c.ValueError("expected a string")
+		}
+		if pattern, ok := likePattern(c.Op, s); ok {
+			return column + ` LIKE ? ESCAPE '\'`, []any{pattern}, nil
+		}
+		value = s
+	case fieldNumber:
+		n, ok := c.Value.(float64)
+		if !ok {
+			return "", nil, c.ValueError("expected a number")
+		}
+		value = n
+	case fieldTime:
+		s, ok := c.Value.(string)
+		if !ok {
+			return "", nil, c.ValueError("expected a date or time string")
+		}
+		t, ok := parseFilterTime(s)
+		if !ok {
+			return "", nil, c.ValueError("expected a date (2006-01-02) or RFC 3339 time")
+		}
+		value = t
+	}
+
+	return column + " " + op + " ?", []any{value}, nil
+}
+
+// Build the LIKE pattern for the co, sw and ew operators
+func likePattern(op, s string) (string, bool) {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	switch op {
+	case filter.OpContain:
+		return "%" + s + "%", true
+	case filter.OpStarts:
+		return s + "%", true
+	case filter.OpEnds:
+		return "%" + s, true
+	}
+	return "", false
+}
+
+// Parse a time value as UTC, matching how timestamps are stored
+func parseFilterTime(s string) (time.Time, bool) {
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
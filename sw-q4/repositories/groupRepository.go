@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"myapp/filter"
+	"myapp/models"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Group Repository: Handles database operations for groups and memberships
+// Groups are scoped to an organization; memberships are removed with their group or user
+
+var (
+	ErrGroupNameTaken = errors.New("group name already in use")
+	ErrUnknownMember  = errors.New("member is not a user of the organization")
+)
+
+type GroupRepository struct {
+	db *sql.DB
+}
+
+func NewGroupRepository(db *sql.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+func translateGroupError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrGroupNameTaken
+	}
+	return err
+}
+
+// Retrieve the groups of an organization matching a parsed filter expression, ordered by name
+// A nil expression matches every group
+func (r *GroupRepository) List(orgID int, expr filter.Expr) ([]models.Group, error) {
+	query := "SELECT id, org_id, name, description, created_at FROM groups WHERE org_id = ?"
+	args := []any{orgID}
+	if expr != nil {
+		condition, exprArgs, err := compileFilter(expr, groupFilterFields)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND " + condition
+		args = append(args, exprArgs...)
+	}
+	rows, err := r.db.Query(query+" ORDER BY name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	for rows.Next() {
+		var g models.Group
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// Find a group by ID within an organization
+func (r *GroupRepository) GetByID(orgID, id int) (*models.Group, error) {
+	var g models.Group
+	err := r.db.QueryRow("SELECT id, org_id, name, description, created_at FROM groups WHERE id = ? AND org_id = ?", id, orgID).
+		Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &g.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("group not found")
+		}
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// Insert a new group into its organization
+func (r *GroupRepository) Create(g *models.Group) error {
+	result, err := r.db.Exec("INSERT INTO groups (org_id, name, description, created_at) VALUES (?, ?, ?, ?)",
+		g.OrgID, g.Name, g.Description, g.CreatedAt)
+	if err != nil {
+		return translateGroupError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	g.ID = int(id)
+
+	return nil
+}
+
+// Update a group's name and description
+func (r *GroupRepository) Update(g *models.Group) error {
+	result, err := r.db.Exec("UPDATE groups SET name = ?, description = ? WHERE id = ? AND org_id = ?",
+		g.Name, g.Description, g.ID, g.OrgID)
+	if err != nil {
+		return translateGroupError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("group not found")
+	}
+
+	return nil
+}
+
+// Insert a new group, or update an existing one, and give it exactly the given members in one transaction
+// New members join with the member role; existing members keep theirs
+func (r *GroupRepository) Save(g *models.Group, userIDs []int, joinedAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if g.ID == 0 {
+		result, err := tx.Exec("INSERT INTO groups (org_id, name, description, created_at) VALUES (?, ?, ?, ?)",
+			g.OrgID, g.Name, g.Description, g.CreatedAt)
+		if err != nil {
+			return translateGroupError(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		g.ID = int(id)
+	} else {
+		result, err := tx.Exec("UPDATE groups SET name = ?, description = ? WHERE id = ? AND org_id = ?",
+			g.Name, g.Description, g.ID, g.OrgID)
+		if err != nil {
+			return translateGroupError(err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errors.New("group not found")
+		}
+	}
+
+	keep := make(map[int]bool, len(userIDs))
+	for _, userID := range userIDs {
+		var exists int
+		err := tx.QueryRow("SELECT 1 FROM users WHERE id = ? AND org_id = ?", userID, g.OrgID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrUnknownMember, userID)
+		}
+		if err != nil {
+			return err
+		}
+		query := `INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(group_id, user_id) DO NOTHING`
+		if _, err := tx.Exec(query, g.ID, userID, models.GroupRoleMember, joinedAt); err != nil {
+			return err
+		}
+		keep[userID] = true
+	}
+
+	rows, err := tx.Query("SELECT user_id FROM group_members WHERE group_id = ?", g.ID)
+	if err != nil {
+		return err
+	}
+	var removed []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		if !keep[userID] {
+			removed = append(removed, userID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, userID := range removed {
+		if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", g.ID, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete a group and, through the cascade, its memberships
+func (r *GroupRepository) Delete(orgID, id int) error {
+	result, err := r.db.Exec("DELETE FROM groups WHERE id = ? AND org_id = ?", id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("group not found")
+	}
+
+	return nil
+}
+
+// Add a user to a group, or change the role of an existing member
+func (r *GroupRepository) AddMember(groupID, userID int, role string, joinedAt time.Time) error {
+	query := `INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(group_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err := r.db.Exec(query, groupID, userID, role, joinedAt)
+	return err
+}
+
+// Remove a user from a group
+func (r *GroupRepository) RemoveMember(groupID, userID int) error {
+	result, err := r.db.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("member not found")
+	}
+
+	return nil
+}
+
+// List the members of a group with their names and emails
+func (r *GroupRepository) ListMembers(groupID int) ([]models.GroupMember, error) {
+	query := `SELECT m.group_id, m.user_id, u.name, u.email, m.role, m.joined_at
+		FROM group_members m JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ? ORDER BY m.joined_at, m.user_id`
+	rows, err := r.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.GroupMember{}
+	for rows.Next() {
+		var m models.GroupMember
+		if err := rows.Scan(&m.GroupID, &m.UserID, &m.Name, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// List the groups a user belongs to, with their role in each
+func (r *GroupRepository) ListForUser(userID int) ([]models.UserGroup, error) {
+	query := `SELECT g.id, g.org_id, g.name, g.description, g.created_at, m.role, m.joined_at
+		FROM group_members m JOIN groups g ON g.id = m.group_id
+		WHERE m.user_id = ? ORDER BY g.name`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.UserGroup{}
+	for rows.Next() {
+		var g models.UserGroup
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &g.CreatedAt, &g.Role, &g.JoinedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
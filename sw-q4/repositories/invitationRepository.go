@@ -0,0 +1,278 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// Invitation Repository: Persists invitations and their pending users
+// Accepting or revoking an invitation updates the user in the same transaction
+// Each change to a user is recorded in the outbox within that transaction too
+
+type InvitationRepository struct {
+	db     *sql.DB
+	events *UserEventStore // Records user changes when users are event-sourced; nil otherwise
+}
+
+func NewInvitationRepository(db *sql.DB, events *UserEventStore) *InvitationRepository {
+	return &InvitationRepository{db: db, events: events}
+}
+
+const invitationColumns = "id, org_id, user_id, email, role, invited_by, token_hash, expires_at, accepted_at, revoked_at, created_at"
+
+func scanInvitation(row interface{ Scan(...any) error }, inv *models.Invitation) error {
+	var userID, invitedBy sql.NullInt64
+	var acceptedAt, revokedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.OrgID, &userID, &inv.Email, &inv.Role, &invitedBy, &inv.TokenHash,
+		&inv.ExpiresAt, &acceptedAt, &revokedAt, &inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		inv.UserID = &id
+	}
+	if invitedBy.Valid {
+		id := int(invitedBy.Int64)
+		inv.InvitedBy = &id
+	}
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+	if revokedAt.Valid {
+		inv.RevokedAt = &revokedAt.Time
+	}
+	return nil
+}
+
+// Insert a pending user together with their invitation
+func (r *InvitationRepository) Create(inv *models.Invitation, user *models.User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user.OrgID = inv.OrgID
+	if r.events != nil {
+		user.CreatedAt, user.UpdatedAt = inv.CreatedAt, inv.CreatedAt
+		if err := r.events.create(tx, user); err != nil {
+			return err
+		}
+	} else {
+		attributes, err := encodeAttributes(user.Attributes)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec("INSERT INTO users (org_id, name, email, role, status, attributes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			inv.OrgID, user.Name, user.Email, user.Role, user.Status, attributes, inv.CreatedAt, inv.CreatedAt)
+		if err != nil {
+			return translateUserError(err)
+		}
+		userID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		user.ID = int(userID)
+	}
+	inv.UserID = &user.ID
+	if err := recordUserEvent(tx, models.UserCreated, inv.OrgID, user.ID, inv.CreatedAt); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO invitations (org_id, user_id, email, role, invited_by, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, inv.OrgID, inv.UserID, inv.Email, inv.Role, inv.InvitedBy, inv.TokenHash, inv.ExpiresAt, inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	inv.ID = int(id)
+
+	return tx.Commit()
+}
+
+// Find an invitation by the hash of its token, in any state
+func (r *InvitationRepository) GetByTokenHash(tokenHash string) (*models.Invitation, error) {
+	row := r.db.QueryRow("SELECT "+invitationColumns+" FROM invitations WHERE token_hash = ?", tokenHash)
+
+	var inv models.Invitation
+	if err := scanInvitation(row, &inv); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// Find an invitation by ID within an organization
+func (r *InvitationRepository) GetByID(orgID, id int) (*models.Invitation, error) {
+	row := r.db.QueryRow("SELECT "+invitationColumns+" FROM invitations WHERE id = ? AND org_id = ?", id, orgID)
+
+	var inv models.Invitation
+	if err := scanInvitation(row, &inv); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// Retrieve all invitations of an organization, newest first
+func (r *InvitationRepository) List(orgID int) ([]models.Invitation, error) {
+	rows, err := r.db.Query("SELECT "+invitationColumns+" FROM invitations WHERE org_id = ? ORDER BY id DESC", orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		var inv models.Invitation
+		if err := scanInvitation(rows, &inv); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// Replace the token of an open invitation and extend its expiry
+func (r *InvitationRepository) Renew(id int, tokenHash string, expiresAt time.Time) error {
+	query := `UPDATE invitations SET token_hash = ?, expires_at = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, tokenHash, expiresAt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("invitation not found")
+	}
+
+	return nil
+}
+
+// Consume an open invitation token and activate its user with a name and password
+func (r *InvitationRepository) Accept(tokenHash string, now time.Time, name, passwordHash string) (*models.Invitation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE invitations SET accepted_at = ?
+		WHERE token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ? AND user_id IS NOT NULL
+		RETURNING ` + invitationColumns
+	var inv models.Invitation
+	if err := scanInvitation(tx.QueryRow(query, now, tokenHash, now), &inv); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+
+	// The invitee proved control of the address by receiving the token
+	if r.events != nil {
+		accepted, err := r.events.change(tx, inv.OrgID, *inv.UserID, now, func(u *models.User) bool {
+			if u.Status != models.StatusPending {
+				return false
+			}
+			u.Name, u.PasswordHash, u.Role, u.Status, u.EmailVerifiedAt = name, passwordHash, inv.Role, models.StatusActive, &now
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !accepted {
+			return nil, ErrTokenInvalid
+		}
+		if err := recordUserEvent(tx, models.UserUpdated, inv.OrgID, *inv.UserID, now); err != nil {
+			return nil, err
+		}
+		return &inv, tx.Commit()
+	}
+
+	query = `UPDATE users SET name = ?, password_hash = ?, role = ?, status = ?, email_verified_at = ?, updated_at = ?
+		WHERE id = ? AND status = ?`
+	result, err := tx.Exec(query, name, passwordHash, inv.Role, models.StatusActive, now, now, *inv.UserID, models.StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := recordUserEvent(tx, models.UserUpdated, inv.OrgID, *inv.UserID, now); err != nil {
+		return nil, err
+	}
+	return &inv, tx.Commit()
+}
+
+// Revoke an open invitation and remove the pending user created for it
+func (r *InvitationRepository) Revoke(id int, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID sql.NullInt64
+	var orgID int
+	query := `UPDATE invitations SET revoked_at = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+		RETURNING user_id, org_id`
+	if err := tx.QueryRow(query, now, id).Scan(&userID, &orgID); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("invitation not found")
+		}
+		return err
+	}
+
+	removed := false
+	if userID.Valid && r.events != nil {
+		removed, err = r.events.remove(tx, orgID, int(userID.Int64), now, func(u models.User) bool {
+			return u.Status == models.StatusPending
+		})
+		// The pending user may already have been deleted
+		if err != nil && !errors.Is(err, errUserNotFound) {
+			return err
+		}
+	} else if userID.Valid {
+		result, err := tx.Exec("DELETE FROM users WHERE id = ? AND status = ?", userID.Int64, models.StatusPending)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		removed = rowsAffected > 0
+	}
+
+	if removed {
+		if err := recordUserEvent(tx, models.UserDeleted, orgID, int(userID.Int64), now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"database/sql"
+	"myapp/models"
+	"sync"
+	"time"
+)
+
+// Login Attempt Repository: Stores failed login counters for throttling
+// Backed by SQLite, with an in-memory alternative for single-process deployments
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Find the counter for a key; unknown keys have no failures
+func (r *LoginAttemptRepository) Get(key string) (*models.LoginAttempt, error) {
+	query := "SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = ?"
+	var attempt models.LoginAttempt
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRow(query, key).Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return &attempt, nil
+}
+
+// Count a failure, restarting the count if the previous one is older than window
+func (r *LoginAttemptRepository) RecordFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	query := `INSERT INTO login_attempts (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE
+				WHEN last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?) THEN 1
+				ELSE failures + 1
+			END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures, locked_until`
+	cutoff := at.Add(-window)
+
+	attempt := models.LoginAttempt{Key: key, LastFailureAt: at}
+	var lockedUntil sql.NullTime
+	if err := r.db.QueryRow(query, key, at, cutoff, cutoff).Scan(&attempt.Failures, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return &attempt, nil
+}
+
+// Lock a key until the given time
+func (r *LoginAttemptRepository) Lock(key string, until time.Time) error {
+	_, err := r.db.Exec("UPDATE login_attempts SET locked_until = ? WHERE key = ?", until, key)
+	return err
+}
+
+// Clear the counter and any lock for a key
+func (r *LoginAttemptRepository) Reset(key string) error {
+	_, err := r.db.Exec("DELETE FROM login_attempts WHERE key = ?", key)
+	return err
+}
+
+// In-memory login attempt store with the same behaviour as LoginAttemptRepository
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (m *MemoryLoginAttemptStore) Get(key string) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	return &attempt, nil
+}
+
+func (m *MemoryLoginAttemptStore) RecordFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := at.Add(-window)
+	attempt, ok := m.attempts[key]
+	if !ok || (attempt.LastFailureAt.Before(cutoff) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(cutoff))) {
+		attempt = models.LoginAttempt{Key: key, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (m *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if attempt, ok := m.attempts[key]; ok {
+		attempt.LockedUntil = &until
+		m.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
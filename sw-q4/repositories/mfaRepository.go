@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// MFA Repository: Persists TOTP secrets and hashed recovery codes
+// Enrollment state lives alongside users and is removed with them
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// Find the enrollment for a user
+func (r *MFARepository) Get(userID int) (*models.MFA, error) {
+	query := "SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_mfa WHERE user_id = ?"
+	row := r.db.QueryRow(query, userID)
+
+	var mfa models.MFA
+	var enabledAt sql.NullTime
+	if err := row.Scan(&mfa.UserID, &mfa.Secret, &enabledAt, &mfa.LastUsedStep, &mfa.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("mfa enrollment not found")
+		}
+		return nil, err
+	}
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+
+	return &mfa, nil
+}
+
+// Start or restart a pending enrollment with a new secret
+func (r *MFARepository) SavePending(userID int, secret string, at time.Time) error {
+	query := `INSERT INTO user_mfa (user_id, secret, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at,
+		enabled_at = NULL, last_used_step = 0`
+	_, err := r.db.Exec(query, userID, secret, at)
+	return err
+}
+
+// Activate an enrollment and replace its recovery codes
+func (r *MFARepository) Enable(userID int, step int64, at time.Time, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE user_mfa SET enabled_at = ?, last_used_step = ? WHERE user_id = ? AND enabled_at IS NULL"
+	result, err := tx.Exec(query, at, step, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("mfa enrollment not found")
+	}
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Record an accepted time step, reporting false if it was not newer than the last one
+func (r *MFARepository) AdvanceStep(userID int, step int64) (bool, error) {
+	query := "UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+	result, err := r.db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Consume an unused recovery code, reporting false if none matched
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string, at time.Time) (bool, error) {
+	query := "UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	result, err := r.db.Exec(query, at, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Remove the enrollment and all recovery codes for a user
+func (r *MFARepository) Delete(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Organization Repository: Handles database operations for tenants
+
+var ErrSlugTaken = errors.New("organization slug already in use")
+
+type OrganizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// Retrieve all organizations
+func (r *OrganizationRepository) List() ([]models.Organization, error) {
+	rows, err := r.db.Query("SELECT id, name, slug, created_at FROM organizations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Find an organization by ID
+func (r *OrganizationRepository) GetByID(id int) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.QueryRow("SELECT id, name, slug, created_at FROM organizations WHERE id = ?", id).
+		Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// Insert a new organization
+func (r *OrganizationRepository) Create(org *models.Organization) error {
+	result, err := r.db.Exec("INSERT INTO organizations (name, slug, created_at) VALUES (?, ?, ?)",
+		org.Name, org.Slug, org.CreatedAt)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrSlugTaken
+		}
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	org.ID = int(id)
+
+	return nil
+}
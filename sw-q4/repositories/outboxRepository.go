@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"myapp/models"
+	"time"
+)
+
+// Outbox Repository: Handles database operations for the transactional outbox of user events
+// Events are inserted in the transaction of the write they describe, so neither exists without the other
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Record an event in the outbox as part of tx, giving it a new dedup ID
+func insertOutboxEvent(tx *sql.Tx, event *models.UserEvent) error {
+	var payload sql.NullString
+	if event.User != nil {
+		b, err := json.Marshal(event.User)
+		if err != nil {
+			return err
+		}
+		payload = sql.NullString{String: string(b), Valid: true}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	event.DedupID = "evt_" + hex.EncodeToString(id)
+
+	result, err := tx.Exec(`INSERT INTO outbox (dedup_id, event_type, org_id, user_id, payload, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, event.DedupID, event.Type, event.OrgID, event.UserID, payload, event.OccurredAt)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// Events not yet published, oldest first
+func (r *OutboxRepository) Unpublished(limit int) ([]models.UserEvent, error) {
+	return r.queryEvents(`SELECT id, dedup_id, event_type, org_id, user_id, payload, created_at
+		FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT ?`, limit)
+}
+
+// Events recorded after the given event ID, oldest first
+func (r *OutboxRepository) After(id int64, limit int) ([]models.UserEvent, error) {
+	return r.queryEvents(`SELECT id, dedup_id, event_type, org_id, user_id, payload, created_at
+		FROM outbox WHERE id > ? ORDER BY id LIMIT ?`, id, limit)
+}
+
+func (r *OutboxRepository) queryEvents(query string, args ...any) ([]models.UserEvent, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.UserEvent
+	for rows.Next() {
+		var event models.UserEvent
+		var payload sql.NullString
+		if err := rows.Scan(&event.ID, &event.DedupID, &event.Type, &event.OrgID, &event.UserID, &payload, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		if payload.Valid {
+			if err := json.Unmarshal([]byte(payload.String), &event.User); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ID of the last event a publisher accepted
+// A publisher without a cursor, such as one added since, starts after the last event every publisher had
+func (r *OutboxRepository) Cursor(publisher string) (int64, error) {
+	var id int64
+	err := r.db.QueryRow("SELECT last_event_id FROM outbox_cursors WHERE publisher = ?", publisher).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = r.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM outbox WHERE published_at IS NOT NULL").Scan(&id)
+	}
+	return id, err
+}
+
+// Record that a publisher accepted every event up to the given ID
+func (r *OutboxRepository) SaveCursor(publisher string, id int64, at time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO outbox_cursors (publisher, last_event_id, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(publisher) DO UPDATE SET last_event_id = excluded.last_event_id, updated_at = excluded.updated_at`,
+		publisher, id, at)
+	return err
+}
+
+// Mark events up to the given ID as handed to every publisher, returning how many were newly marked
+func (r *OutboxRepository) MarkPublished(through int64, at time.Time) (int64, error) {
+	result, err := r.db.Exec("UPDATE outbox SET published_at = ? WHERE id <= ? AND published_at IS NULL", at, through)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Delete events published before the given time, returning how many were removed
+func (r *OutboxRepository) DeletePublished(before time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM outbox WHERE published_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// Refresh Token Repository: Persists hashed refresh tokens
+// Supports rotation, reuse detection and revocation by family
+
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+// Store a newly issued refresh token
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at, mfa)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt, token.MFA)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = int(id)
+	return nil
+}
+
+// Find a refresh token by the hash of its value
+func (r *RefreshTokenRepository) GetByHash(hash string) (*models.RefreshToken, error) {
+	query := `SELECT t.id, t.user_id, u.org_id, t.family_id, t.token_hash, t.expires_at, t.revoked_at, t.replaced_by, t.created_at, t.mfa
+		FROM refresh_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = ?`
+	row := r.db.QueryRow(query, hash)
+
+	var token models.RefreshToken
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	err := row.Scan(&token.ID, &token.UserID, &token.OrgID, &token.FamilyID, &token.TokenHash,
+		&token.ExpiresAt, &revokedAt, &replacedBy, &token.CreatedAt, &token.MFA)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("refresh token not found")
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if replacedBy.Valid {
+		id := int(replacedBy.Int64)
+		token.ReplacedBy = &id
+	}
+
+	return &token, nil
+}
+
+// Revoke a single token, reporting false if it was already revoked
+func (r *RefreshTokenRepository) Revoke(id int, at time.Time) (bool, error) {
+	query := "UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"
+	result, err := r.db.Exec(query, at, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Atomically revoke a token and store its replacement
+// Reports false without changes if the old token was already revoked
+func (r *RefreshTokenRepository) Rotate(old, next *models.RefreshToken) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", next.CreatedAt, old.ID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at, mfa)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	result, err = tx.Exec(query, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt, next.CreatedAt, next.MFA)
+	if err != nil {
+		return false, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	next.ID = int(id)
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET replaced_by = ? WHERE id = ?", next.ID, old.ID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Revoke every token issued from the same login
+func (r *RefreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+	query := "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"
+	_, err := r.db.Exec(query, at, familyID)
+	return err
+}
+
+// Revoke every active token belonging to a user
+func (r *RefreshTokenRepository) RevokeAllForUser(userID int, at time.Time) error {
+	query := "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+	_, err := r.db.Exec(query, at, userID)
+	return err
+}
@@ -0,0 +1,372 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Database Schema: Versioned migrations for the SQLite database
+// Each migration runs once, in order, and is recorded in schema_migrations
+
+var migrations = []string{
+	// 1: users table
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		email TEXT
+	);`,
+
+	// 2: password credentials and refresh tokens
+	`ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(email);
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		family_id TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		replaced_by INTEGER,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);`,
+
+	// 3: cookie sessions
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash TEXT NOT NULL UNIQUE,
+		csrf_token TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+
+	// 4: roles and TOTP multi-factor authentication
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+	ALTER TABLE refresh_tokens ADD COLUMN mfa INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE sessions ADD COLUMN mfa INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret TEXT NOT NULL,
+		enabled_at DATETIME,
+		last_used_step INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);`,
+
+	// 5: login throttling and audit log
+	`CREATE TABLE IF NOT EXISTS login_attempts (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		actor_id INTEGER,
+		subject TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events(type, created_at);`,
+
+	// 6: email verification and single-use user tokens
+	`ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id, purpose);`,
+
+	// 7: user status and invitations
+	`ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+	CREATE TABLE IF NOT EXISTS invitations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		email TEXT NOT NULL,
+		role TEXT NOT NULL,
+		invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		accepted_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_invitations_user ON invitations(user_id);`,
+
+	// 8: status change reasons
+	`ALTER TABLE users ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN status_changed_at DATETIME;
+	CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);`,
+
+	// 9: groups and their members
+	`CREATE TABLE IF NOT EXISTS groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS group_members (
+		group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role TEXT NOT NULL DEFAULT 'member',
+		joined_at DATETIME NOT NULL,
+		PRIMARY KEY (group_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);`,
+
+	// 10: organizations; users, invitations, audit events and groups belong to one
+	// SQLite cannot add a REFERENCES column with a non-NULL default, so org_id on
+	// existing tables is kept consistent by the application
+	`CREATE TABLE IF NOT EXISTS organizations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL
+	);
+	INSERT INTO organizations (id, name, slug, created_at) VALUES (1, 'Default', 'default', CURRENT_TIMESTAMP);
+	ALTER TABLE users ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1;
+	DROP INDEX IF EXISTS idx_users_email;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_org_email ON users(org_id, email);
+	ALTER TABLE invitations ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE audit_events ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1;
+	CREATE INDEX IF NOT EXISTS idx_audit_events_org ON audit_events(org_id, type, created_at);
+	CREATE TABLE groups_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		UNIQUE (org_id, name)
+	);
+	INSERT INTO groups_new (id, org_id, name, description, created_at)
+		SELECT id, 1, name, description, created_at FROM groups;
+	CREATE TABLE group_members_new (
+		group_id INTEGER NOT NULL REFERENCES groups_new(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role TEXT NOT NULL DEFAULT 'member',
+		joined_at DATETIME NOT NULL,
+		PRIMARY KEY (group_id, user_id)
+	);
+	INSERT INTO group_members_new SELECT group_id, user_id, role, joined_at FROM group_members;
+	DROP TABLE group_members;
+	DROP TABLE groups;
+	ALTER TABLE groups_new RENAME TO groups;
+	ALTER TABLE group_members_new RENAME TO group_members;
+	CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);`,
+
+	// 11: custom user attributes and their deployment-wide schema
+	`ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+	CREATE TABLE IF NOT EXISTS user_attributes (
+		name TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		required INTEGER NOT NULL DEFAULT 0,
+		enum TEXT NOT NULL DEFAULT '[]',
+		pattern TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT ''
+	);`,
+
+	// 12: user tags
+	`CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		UNIQUE (org_id, name)
+	);
+	CREATE TABLE IF NOT EXISTS user_tags (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_tags_tag ON user_tags(tag_id, user_id);`,
+
+	// 13: user creation and modification times; existing users get the migration time
+	`ALTER TABLE users ADD COLUMN created_at DATETIME;
+	ALTER TABLE users ADD COLUMN updated_at DATETIME;
+	UPDATE users SET created_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'), updated_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+	CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(org_id, created_at);`,
+
+	// 14: outgoing webhooks and their delivery queue
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '[]',
+		secret TEXT NOT NULL,
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_org ON webhooks(org_id);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event_id INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME,
+		response_status INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		completed_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);`,
+	// 15: transactional outbox of user events; relayed events stay until the retention period ends
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		dedup_id TEXT NOT NULL UNIQUE,
+		event_type TEXT NOT NULL,
+		org_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		payload TEXT,
+		created_at DATETIME NOT NULL,
+		published_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_outbox_published ON outbox(published_at, id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(webhook_id, event_id);`,
+	// 16: append-only user event store and snapshots, used when users are event-sourced
+	`CREATE TABLE IF NOT EXISTS user_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		org_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		data TEXT NOT NULL DEFAULT '{}',
+		occurred_at DATETIME NOT NULL,
+		UNIQUE (user_id, version)
+	);
+	CREATE TRIGGER IF NOT EXISTS user_events_no_update BEFORE UPDATE ON user_events
+	BEGIN SELECT RAISE(ABORT, 'user_events is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS user_events_no_delete BEFORE DELETE ON user_events
+	BEGIN SELECT RAISE(ABORT, 'user_events is append-only'); END;
+	CREATE TABLE IF NOT EXISTS user_snapshots (
+		user_id INTEGER PRIMARY KEY,
+		version INTEGER NOT NULL,
+		state TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);`,
+	// 17: how far each outbox publisher got, so a failing one does not hold up the others
+	`CREATE TABLE IF NOT EXISTS outbox_cursors (
+		publisher TEXT PRIMARY KEY,
+		last_event_id INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`,
+	// 18: take the password hashes that earlier versions stored out of user events and snapshots
+	`DROP TRIGGER IF EXISTS user_events_no_update;
+	UPDATE user_events SET data = json_remove(data, '$.password_hash') WHERE json_extract(data, '$.password_hash') IS NOT NULL;
+	CREATE TRIGGER user_events_no_update BEFORE UPDATE ON user_events
+	BEGIN SELECT RAISE(ABORT, 'user_events is append-only'); END;
+	UPDATE user_snapshots SET state = json_remove(state, '$.password_hash') WHERE json_extract(state, '$.password_hash') IS NOT NULL;`,
+}
+
+// Data fixes run in a migration's transaction before its SQL, keyed by version
+var migrationSteps = map[int]func(tx *sql.Tx) error{
+	2: renameDuplicateEmails,
+}
+
+// Give every user but the first of each duplicated email a unique address so the unique email index
+// can be created; databases from before migrations, like the shipped one, may hold duplicates
+func renameDuplicateEmails(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT u.id, u.email FROM users u
+		WHERE EXISTS (SELECT 1 FROM users o WHERE o.email = u.email AND o.id < u.id)
+		ORDER BY u.id`)
+	if err != nil {
+		return err
+	}
+	type duplicate struct {
+		id    int
+		email string
+	}
+	var duplicates []duplicate
+	for rows.Next() {
+		var d duplicate
+		if err := rows.Scan(&d.id, &d.email); err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range duplicates {
+		renamed := duplicateEmail(d.email, d.id)
+		if _, err := tx.Exec("UPDATE users SET email = ? WHERE id = ?", renamed, d.id); err != nil {
+			return err
+		}
+		log.Printf("migration 2: user %d shares email %q with an earlier user; renamed to %q", d.id, d.email, renamed)
+	}
+	return nil
+}
+
+// Tag an email with the user ID, e.g. john@example.com becomes john+duplicate-7@example.com
+func duplicateEmail(email string, id int) string {
+	tag := fmt.Sprintf("+duplicate-%d", id)
+	if local, domain, ok := strings.Cut(email, "@"); ok {
+		return local + tag + "@" + domain
+	}
+	return email + tag
+}
+
+// Apply all pending migrations inside their own transactions
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	);`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if step, ok := migrationSteps[version]; ok {
+			if err := step(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
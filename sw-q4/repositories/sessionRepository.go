@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// Session Repository: Persists cookie sessions in SQLite
+// Sessions are looked up by the hash of the cookie value
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Store a new session
+func (r *SessionRepository) Create(session *models.Session) error {
+	query := `INSERT INTO sessions (user_id, token_hash, csrf_token, created_at, last_seen_at, expires_at, mfa)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query, session.UserID, session.TokenHash, session.CSRFToken,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.MFA)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	session.ID = int(id)
+	return nil
+}
+
+// Find a session by the hash of its cookie value
+func (r *SessionRepository) GetByHash(hash string) (*models.Session, error) {
+	query := `SELECT s.id, s.user_id, u.org_id, s.token_hash, s.csrf_token, s.created_at, s.last_seen_at, s.expires_at, s.mfa
+		FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.token_hash = ?`
+	row := r.db.QueryRow(query, hash)
+
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.OrgID, &session.TokenHash, &session.CSRFToken,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.MFA)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("session not found")
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Record activity on a session
+func (r *SessionRepository) Touch(id int, at time.Time) error {
+	_, err := r.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// Remove a session
+func (r *SessionRepository) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+// Remove every session belonging to a user
+func (r *SessionRepository) DeleteAllForUser(userID int) error {
+	_, err := r.db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+// Remove sessions past their absolute expiry
+func (r *SessionRepository) DeleteExpired(now time.Time) error {
+	_, err := r.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now)
+	return err
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// Tag Repository: Handles database operations for user tags
+// Tags are created on first use and removed once no user has them
+// Changing a user's tags counts as an update of the user, recorded in the outbox with the change
+
+type TagRepository struct {
+	db     *sql.DB
+	events *UserEventStore // Records tag changes when users are event-sourced; nil otherwise
+}
+
+func NewTagRepository(db *sql.DB, events *UserEventStore) *TagRepository {
+	return &TagRepository{db: db, events: events}
+}
+
+// List an organization's tags with the number of users carrying each, most used first
+func (r *TagRepository) List(orgID int) ([]models.Tag, error) {
+	query := `SELECT t.name, COUNT(ut.user_id) FROM tags t LEFT JOIN user_tags ut ON ut.tag_id = t.id
+		WHERE t.org_id = ? GROUP BY t.id ORDER BY COUNT(ut.user_id) DESC, t.name`
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// Attach tags to a user, creating any that do not exist yet
+func (r *TagRepository) AddToUser(orgID, userID int, names []string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	added := false
+	for _, name := range names {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (org_id, name) VALUES (?, ?)", orgID, name); err != nil {
+			return err
+		}
+		query := `INSERT OR IGNORE INTO user_tags (user_id, tag_id)
+			SELECT ?, id FROM tags WHERE org_id = ? AND name = ?`
+		result, err := tx.Exec(query, userID, orgID, name)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added = true
+		}
+	}
+
+	// Tags the user already had change nothing
+	if added {
+		if err := r.userUpdated(tx, orgID, userID, at); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Detach a tag from a user, deleting the tag once nobody has it
+func (r *TagRepository) RemoveFromUser(orgID, userID int, name string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM user_tags WHERE user_id = ?
+		AND tag_id = (SELECT id FROM tags WHERE org_id = ? AND name = ?)`
+	result, err := tx.Exec(query, userID, orgID, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("tag not found")
+	}
+
+	query = `DELETE FROM tags WHERE org_id = ? AND name = ?
+		AND NOT EXISTS (SELECT 1 FROM user_tags WHERE tag_id = tags.id)`
+	if _, err := tx.Exec(query, orgID, name); err != nil {
+		return err
+	}
+
+	if err := r.userUpdated(tx, orgID, userID, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Bump the user's update time and record a user.updated event as part of tx
+func (r *TagRepository) userUpdated(tx *sql.Tx, orgID, userID int, at time.Time) error {
+	if r.events != nil {
+		tags, err := userTags(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := r.events.tagsChanged(tx, orgID, userID, tags, at); err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.Exec("UPDATE users SET updated_at = ? WHERE id = ? AND org_id = ?", at, userID, orgID)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errors.New("user not found")
+		}
+	}
+	return recordUserEvent(tx, models.UserUpdated, orgID, userID, at)
+}
+
+// Names of a user's tags in alphabetical order
+func userTags(tx *sql.Tx, userID int) ([]string, error) {
+	rows, err := tx.Query("SELECT t.name FROM user_tags ut JOIN tags t ON t.id = ut.tag_id WHERE ut.user_id = ? ORDER BY t.name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
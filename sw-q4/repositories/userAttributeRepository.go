@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"myapp/models"
+)
+
+// User Attribute Repository: Persists the custom user attribute schema
+
+type UserAttributeRepository struct {
+	db *sql.DB
+}
+
+func NewUserAttributeRepository(db *sql.DB) *UserAttributeRepository {
+	return &UserAttributeRepository{db: db}
+}
+
+// Retrieve all attribute definitions ordered by name
+func (r *UserAttributeRepository) List() ([]models.AttributeDefinition, error) {
+	rows, err := r.db.Query("SELECT name, type, required, enum, pattern, description FROM user_attributes ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []models.AttributeDefinition{}
+	for rows.Next() {
+		var def models.AttributeDefinition
+		var enum string
+		if err := rows.Scan(&def.Name, &def.Type, &def.Required, &enum, &def.Pattern, &def.Description); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(enum), &def.Enum); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+
+	return defs, rows.Err()
+}
+
+// Create or replace an attribute definition
+func (r *UserAttributeRepository) Save(def *models.AttributeDefinition) error {
+	enum, err := json.Marshal(def.Enum)
+	if err != nil {
+		return err
+	}
+	if def.Enum == nil {
+		enum = []byte("[]")
+	}
+
+	query := `INSERT INTO user_attributes (name, type, required, enum, pattern, description) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET type = excluded.type, required = excluded.required,
+		enum = excluded.enum, pattern = excluded.pattern, description = excluded.description`
+	_, err = r.db.Exec(query, def.Name, def.Type, def.Required, string(enum), def.Pattern, def.Description)
+	return err
+}
+
+// Remove an attribute definition; values already stored on users are left in place
+func (r *UserAttributeRepository) Delete(name string) error {
+	result, err := r.db.Exec("DELETE FROM user_attributes WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("attribute not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,447 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/models"
+	"time"
+)
+
+// User Event Store: Keeps each user as an append-only stream of events when users are event-sourced
+// Writes append events and project the resulting state into the users table, which RebuildProjections
+// can recreate from the streams; snapshots spare replaying a whole stream on every write
+
+const DefaultSnapshotInterval = 100 // Events between snapshots of a user
+
+// Same message as the users table reports, which callers match on
+var errUserNotFound = errors.New("user not found")
+
+type UserEventStore struct {
+	db            *sql.DB
+	snapshotEvery int
+}
+
+func NewUserEventStore(db *sql.DB, snapshotEvery int) *UserEventStore {
+	return &UserEventStore{db: db, snapshotEvery: snapshotEvery}
+}
+
+// Either *sql.DB or *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Payload of a stored event; each type sets only its own fields, and UserCreated sets all of them
+// The password hash is never stored: it lives only in the users table, and PasswordChanged carries no data
+type userEventData struct {
+	Name            string         `json:"name,omitempty"`
+	Email           string         `json:"email,omitempty"`
+	Role            string         `json:"role,omitempty"`
+	Status          string         `json:"status,omitempty"`
+	StatusReason    string         `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time     `json:"status_changed_at,omitempty"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	Attributes      map[string]any `json:"attributes,omitempty"`
+	Tags            []string       `json:"tags,omitempty"`
+	UpdatedAt       *time.Time     `json:"updated_at,omitempty"` // Only set when an existing user is imported
+}
+
+// A user's state folded from its stream
+type userAggregate struct {
+	user    models.User // Without the password hash
+	version int         // Version of the last applied event, 0 for an empty stream
+	deleted bool
+}
+
+// Stored form of an aggregate; models.User leaves out the password hash
+type userSnapshot struct {
+	User    models.User `json:"user"`
+	Deleted bool        `json:"deleted"`
+}
+
+// A change to record, found by comparing a user before and after a write
+type userChange struct {
+	eventType string
+	data      userEventData
+}
+
+// Fold one event into the aggregate
+func (a *userAggregate) apply(event models.UserHistoryEvent) error {
+	var data userEventData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return err
+	}
+	u, at := &a.user, event.OccurredAt
+	switch event.Type {
+	case models.EventUserCreated:
+		*u = models.User{ID: event.UserID, OrgID: event.OrgID, Name: data.Name, Email: data.Email, Role: data.Role,
+			Status: data.Status, StatusReason: data.StatusReason, StatusChangedAt: data.StatusChangedAt,
+			EmailVerifiedAt: data.EmailVerifiedAt, Attributes: data.Attributes, CreatedAt: at, UpdatedAt: at}
+		if data.UpdatedAt != nil {
+			u.UpdatedAt = *data.UpdatedAt
+		}
+	case models.EventNameChanged:
+		u.Name, u.UpdatedAt = data.Name, at
+	case models.EventEmailChanged:
+		u.Email, u.EmailVerifiedAt, u.UpdatedAt = data.Email, nil, at
+	case models.EventRoleChanged:
+		u.Role, u.UpdatedAt = data.Role, at
+	case models.EventAttributesChanged:
+		u.Attributes, u.UpdatedAt = data.Attributes, at
+	case models.EventPasswordChanged:
+	case models.EventStatusChanged:
+		u.Status, u.StatusReason, u.StatusChangedAt, u.UpdatedAt = data.Status, data.StatusReason, &at, at
+	case models.EventEmailVerified:
+		u.EmailVerifiedAt = &at
+	case models.EventTagsChanged:
+		u.UpdatedAt = at
+	case models.EventUserDeleted:
+		a.deleted = true
+	default:
+		return fmt.Errorf("unknown user event type %q", event.Type)
+	}
+	a.version = event.Version
+	return nil
+}
+
+// Data of the UserCreated event recording a user's full state
+func createdEventData(u models.User) userEventData {
+	return userEventData{Name: u.Name, Email: u.Email, Role: u.Role, Status: u.Status, StatusReason: u.StatusReason,
+		StatusChangedAt: u.StatusChangedAt, EmailVerifiedAt: u.EmailVerifiedAt, Attributes: u.Attributes}
+}
+
+// Events turning before into after, in a fixed order
+func userChanges(before, after models.User) ([]userChange, error) {
+	var changes []userChange
+	if after.Name != before.Name {
+		changes = append(changes, userChange{models.EventNameChanged, userEventData{Name: after.Name}})
+	}
+	if after.Email != before.Email {
+		changes = append(changes, userChange{models.EventEmailChanged, userEventData{Email: after.Email}})
+	}
+	if after.Role != before.Role {
+		changes = append(changes, userChange{models.EventRoleChanged, userEventData{Role: after.Role}})
+	}
+	beforeAttributes, err := encodeAttributes(before.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	afterAttributes, err := encodeAttributes(after.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	if afterAttributes != beforeAttributes {
+		changes = append(changes, userChange{models.EventAttributesChanged, userEventData{Attributes: after.Attributes}})
+	}
+	if after.PasswordHash != before.PasswordHash {
+		changes = append(changes, userChange{eventType: models.EventPasswordChanged})
+	}
+	if after.Status != before.Status || after.StatusReason != before.StatusReason {
+		changes = append(changes, userChange{models.EventStatusChanged, userEventData{Status: after.Status, StatusReason: after.StatusReason}})
+	}
+	if after.EmailVerifiedAt != nil && (before.EmailVerifiedAt == nil || !after.EmailVerifiedAt.Equal(*before.EmailVerifiedAt)) {
+		changes = append(changes, userChange{eventType: models.EventEmailVerified})
+	}
+	return changes, nil
+}
+
+const userHistoryColumns = "id, user_id, org_id, version, type, data, occurred_at"
+
+func scanUserHistoryEvent(row interface{ Scan(...any) error }) (models.UserHistoryEvent, error) {
+	var event models.UserHistoryEvent
+	var data string
+	err := row.Scan(&event.ID, &event.UserID, &event.OrgID, &event.Version, &event.Type, &data, &event.OccurredAt)
+	event.Data = json.RawMessage(data)
+	return event, err
+}
+
+// Load a user's aggregate from its latest snapshot and the events after it
+func (s *UserEventStore) load(q queryer, id int) (*userAggregate, error) {
+	a := &userAggregate{}
+	var state string
+	err := q.QueryRow("SELECT version, state FROM user_snapshots WHERE user_id = ?", id).Scan(&a.version, &state)
+	switch {
+	case err == nil:
+		var snapshot userSnapshot
+		if err := json.Unmarshal([]byte(state), &snapshot); err != nil {
+			return nil, err
+		}
+		a.user, a.deleted = snapshot.User, snapshot.Deleted
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	return a, replayUser(q, a, id)
+}
+
+// Fold the user's events after the aggregate's version into it
+func replayUser(q queryer, a *userAggregate, id int) error {
+	rows, err := q.Query("SELECT "+userHistoryColumns+" FROM user_events WHERE user_id = ? AND version > ? ORDER BY version", id, a.version)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanUserHistoryEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := a.apply(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Append an event to the aggregate's stream and apply it, taking a snapshot every snapshotEvery versions
+// The unique (user_id, version) key rejects a concurrent append to the same stream
+func (s *UserEventStore) append(tx *sql.Tx, a *userAggregate, eventType string, data userEventData, at time.Time) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := models.UserHistoryEvent{UserID: a.user.ID, OrgID: a.user.OrgID, Version: a.version + 1, Type: eventType, Data: b, OccurredAt: at}
+	_, err = tx.Exec("INSERT INTO user_events (user_id, org_id, version, type, data, occurred_at) VALUES (?, ?, ?, ?, ?, ?)",
+		event.UserID, event.OrgID, event.Version, event.Type, string(event.Data), event.OccurredAt)
+	if err != nil {
+		return err
+	}
+	if err := a.apply(event); err != nil {
+		return err
+	}
+	if s.snapshotEvery > 0 && a.version%s.snapshotEvery == 0 {
+		return saveUserSnapshot(tx, a, at)
+	}
+	return nil
+}
+
+func saveUserSnapshot(tx *sql.Tx, a *userAggregate, at time.Time) error {
+	state, err := json.Marshal(userSnapshot{User: a.user, Deleted: a.deleted})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO user_snapshots (user_id, version, state, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET version = excluded.version, state = excluded.state, created_at = excluded.created_at`,
+		a.user.ID, a.version, string(state), at)
+	return err
+}
+
+// Write the aggregate's state to the users table, or remove the row of a deleted user
+// An existing row keeps its password hash, which the events do not hold
+func projectUser(tx *sql.Tx, a *userAggregate) error {
+	if a.deleted {
+		_, err := tx.Exec("DELETE FROM users WHERE id = ?", a.user.ID)
+		return err
+	}
+
+	u := a.user
+	attributes, err := encodeAttributes(u.Attributes)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO users (id, org_id, name, email, role, status, status_reason, status_changed_at, email_verified_at,
+			attributes, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET org_id = excluded.org_id, name = excluded.name, email = excluded.email,
+			role = excluded.role, status = excluded.status, status_reason = excluded.status_reason,
+			status_changed_at = excluded.status_changed_at, email_verified_at = excluded.email_verified_at,
+			attributes = excluded.attributes, created_at = excluded.created_at, updated_at = excluded.updated_at`
+	_, err = tx.Exec(query, u.ID, u.OrgID, u.Name, u.Email, u.Role, u.Status, u.StatusReason, u.StatusChangedAt, u.EmailVerifiedAt,
+		attributes, u.PasswordHash, nullTime(u.CreatedAt), nullTime(u.UpdatedAt))
+	return translateUserError(err)
+}
+
+// NULL for the zero time, which users created before timestamps were recorded have
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Start a user's stream with UserCreated; the row is inserted first to allocate the ID and check the email address
+func (s *UserEventStore) create(tx *sql.Tx, user *models.User) error {
+	attributes, err := encodeAttributes(user.Attributes)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`INSERT INTO users (org_id, name, email, role, status, attributes, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, user.OrgID, user.Name, user.Email, user.Role, user.Status, attributes, user.PasswordHash,
+		user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return translateUserError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	a := &userAggregate{user: models.User{ID: int(id), OrgID: user.OrgID}}
+	if err := s.append(tx, a, models.EventUserCreated, createdEventData(*user), user.CreatedAt); err != nil {
+		return err
+	}
+	user.ID = int(id)
+	return projectUser(tx, a)
+}
+
+// Load a live user of the organization
+func (s *UserEventStore) loadLive(tx *sql.Tx, orgID, id int) (*userAggregate, error) {
+	a, err := s.load(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a.version == 0 || a.deleted || a.user.OrgID != orgID {
+		return nil, errUserNotFound
+	}
+	return a, nil
+}
+
+// Apply change to a copy of the user, record the differences as events and project the result
+// Reports false without recording anything when change returns false
+func (s *UserEventStore) change(tx *sql.Tx, orgID, id int, at time.Time, change func(*models.User) bool) (bool, error) {
+	a, err := s.loadLive(tx, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	after := a.user
+	if !change(&after) {
+		return false, nil
+	}
+
+	changes, err := userChanges(a.user, after)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range changes {
+		if err := s.append(tx, a, c.eventType, c.data, at); err != nil {
+			return false, err
+		}
+	}
+	if err := projectUser(tx, a); err != nil {
+		return false, err
+	}
+	if after.PasswordHash != "" {
+		if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", after.PasswordHash, id); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Record that the user's tags changed and project the new update time
+func (s *UserEventStore) tagsChanged(tx *sql.Tx, orgID, id int, tags []string, at time.Time) error {
+	a, err := s.loadLive(tx, orgID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.append(tx, a, models.EventTagsChanged, userEventData{Tags: tags}, at); err != nil {
+		return err
+	}
+	return projectUser(tx, a)
+}
+
+// End a user's stream with UserDeleted and remove the row
+// Reports false without recording anything when allow returns false
+func (s *UserEventStore) remove(tx *sql.Tx, orgID, id int, at time.Time, allow func(models.User) bool) (bool, error) {
+	a, err := s.loadLive(tx, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	if allow != nil && !allow(a.user) {
+		return false, nil
+	}
+	if err := s.append(tx, a, models.EventUserDeleted, userEventData{}, at); err != nil {
+		return false, err
+	}
+	return true, projectUser(tx, a)
+}
+
+// Record a UserCreated event for every user without a stream, adopting the users table as their initial state
+// Run when event sourcing is turned on, so users created before are kept by RebuildProjections
+func (s *UserEventStore) ImportUsers() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT " + userColumns + " FROM users WHERE id NOT IN (SELECT user_id FROM user_events) ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		a := &userAggregate{user: models.User{ID: user.ID, OrgID: user.OrgID}}
+		data := createdEventData(user)
+		data.UpdatedAt = &user.UpdatedAt
+		if err := s.append(tx, a, models.EventUserCreated, data, user.CreatedAt); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(users), tx.Commit()
+}
+
+// Recreate the users table from the event store in one transaction, returning how many users were
+// written and how many deleted users were removed
+// Every stream is replayed from its first event, ignoring snapshots, which are then rewritten;
+// rows without a stream are left alone, and a user whose row is restored has no password until it is reset
+func (s *UserEventStore) RebuildProjections(now time.Time) (projected, removed int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT DISTINCT user_id FROM user_events ORDER BY user_id")
+	if err != nil {
+		return 0, 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, id := range ids {
+		a := &userAggregate{}
+		if err := replayUser(tx, a, id); err != nil {
+			return 0, 0, err
+		}
+		if err := projectUser(tx, a); err != nil {
+			return 0, 0, fmt.Errorf("project user %d: %w", id, err)
+		}
+		if a.deleted {
+			removed++
+		} else {
+			projected++
+		}
+		if s.snapshotEvery > 0 && a.version >= s.snapshotEvery {
+			if err := saveUserSnapshot(tx, a, now); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	return projected, removed, tx.Commit()
+}
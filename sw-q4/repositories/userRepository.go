@@ -2,25 +2,200 @@ package repositories
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"myapp/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 // User Repository: Handles database operations for user data
-// Implements CRUD operations using SQL
+// Implements CRUD operations using SQL, always scoped to one organization
+// Every visible change records a user event in the outbox within the same transaction
+// When event-sourced, reads use the users table as a projection and writes go through UserEventStore
+
+var ErrEmailTaken = errors.New("email already in use")
+
+// Column holding each field a client can select, keyed by JSON name (see models.UserFields)
+var userFieldColumns = map[string]string{
+	"id":                "id",
+	"org_id":            "org_id",
+	"name":              "name",
+	"email":             "email",
+	"role":              "role",
+	"status":            "status",
+	"status_reason":     "status_reason",
+	"status_changed_at": "status_changed_at",
+	"email_verified_at": "email_verified_at",
+	"attributes":        "attributes",
+	"tags":              "(SELECT group_concat(t.name, ',') FROM user_tags ut JOIN tags t ON t.id = ut.tag_id WHERE ut.user_id = users.id)",
+	"created_at":        "created_at",
+	"updated_at":        "updated_at",
+}
+
+// Every field in models.UserFields order, followed by the password hash
+var userColumns = userSelectList(models.UserFields) + ", password_hash"
 
 type UserRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	events *UserEventStore // Source of truth when users are event-sourced; nil when the users table is
 }
 
 func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// Retrieve all users from database
-func (r *UserRepository) GetAllUsers() ([]models.User, error) {
-	query := "SELECT id, name, email FROM users"
-	rows, err := r.db.Query(query)
+// Create a repository whose writes are recorded in events and projected into the users table
+func NewEventSourcedUserRepository(db *sql.DB, events *UserEventStore) *UserRepository {
+	return &UserRepository{db: db, events: events}
+}
+
+// Build the SELECT list for the given fields
+func userSelectList(fields []string) string {
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		column, ok := userFieldColumns[field]
+		if !ok {
+			panic("no column for user field " + field)
+		}
+		columns[i] = column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Intermediate values for user columns that need converting after the scan
+type userRow struct {
+	statusChangedAt, verifiedAt, createdAt, updatedAt sql.NullTime
+	attributes, tags                                  sql.NullString
+	hasAttributes, hasTags                            bool
+}
+
+// Scan destination for one field
+func (u *userRow) target(field string, user *models.User) any {
+	switch field {
+	case "id":
+		return &user.ID
+	case "org_id":
+		return &user.OrgID
+	case "name":
+		return &user.Name
+	case "email":
+		return &user.Email
+	case "role":
+		return &user.Role
+	case "status":
+		return &user.Status
+	case "status_reason":
+		return &user.StatusReason
+	case "status_changed_at":
+		return &u.statusChangedAt
+	case "email_verified_at":
+		return &u.verifiedAt
+	case "attributes":
+		u.hasAttributes = true
+		return &u.attributes
+	case "tags":
+		u.hasTags = true
+		return &u.tags
+	case "created_at":
+		return &u.createdAt
+	case "updated_at":
+		return &u.updatedAt
+	}
+	panic("no scan target for user field " + field)
+}
+
+// Copy converted values into user
+func (u *userRow) apply(user *models.User) error {
+	if u.hasTags {
+		user.Tags = []string{}
+		if u.tags.Valid {
+			user.Tags = strings.Split(u.tags.String, ",")
+			sort.Strings(user.Tags)
+		}
+	}
+	if u.hasAttributes {
+		if err := json.Unmarshal([]byte(u.attributes.String), &user.Attributes); err != nil {
+			return err
+		}
+	}
+	user.CreatedAt, user.UpdatedAt = u.createdAt.Time, u.updatedAt.Time
+	if u.statusChangedAt.Valid {
+		user.StatusChangedAt = &u.statusChangedAt.Time
+	}
+	if u.verifiedAt.Valid {
+		user.EmailVerifiedAt = &u.verifiedAt.Time
+	}
+	return nil
+}
+
+// Scan a single user row selected with userColumns, followed by any extra columns
+func scanUser(row interface{ Scan(...any) error }, user *models.User, extra ...any) error {
+	return scanUserFields(row, user, models.UserFields, append([]any{&user.PasswordHash}, extra...)...)
+}
+
+// Scan a row selected with userSelectList(fields), followed by any extra columns
+func scanUserFields(row interface{ Scan(...any) error }, user *models.User, fields []string, extra ...any) error {
+	var u userRow
+	dest := make([]any, 0, len(fields)+len(extra))
+	for _, field := range fields {
+		dest = append(dest, u.target(field, user))
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	return u.apply(user)
+}
+
+// Encode custom attributes for storage, using an empty object when there are none
+func encodeAttributes(attributes map[string]any) (string, error) {
+	if len(attributes) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(attributes)
+	return string(b), err
+}
+
+// Translate unique constraint violations into domain errors
+func translateUserError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// Retrieve all users of an organization matching the filter from database
+func (r *UserRepository) GetAllUsers(orgID int, filter models.UserFilter) ([]models.User, error) {
+	columns, scan := userColumns, scanUser
+	if len(filter.Fields) > 0 {
+		columns = userSelectList(filter.Fields)
+		scan = func(row interface{ Scan(...any) error }, user *models.User, _ ...any) error {
+			return scanUserFields(row, user, filter.Fields)
+		}
+	}
+	where, args, err := userConditions(orgID, filter)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT " + columns + " FROM users WHERE " + where + " ORDER BY id"
+	switch {
+	case filter.Limit > 0:
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	case filter.Offset > 0:
+		// SQLite only takes an offset after a limit; -1 means none
+		query += " LIMIT -1"
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +204,7 @@ func (r *UserRepository) GetAllUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+		if err := scan(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -42,13 +217,66 @@ func (r *UserRepository) GetAllUsers() ([]models.User, error) {
 	return users, nil
 }
 
-// Find user by ID
-func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
-	query := "SELECT id, name, email FROM users WHERE id = ?"
-	row := r.db.QueryRow(query, id)
+// Count the users of an organization matching the filter, ignoring its Limit and Offset
+func (r *UserRepository) CountUsers(orgID int, filter models.UserFilter) (int, error) {
+	where, args, err := userConditions(orgID, filter)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = r.db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// WHERE clause and arguments selecting the users of an organization that match the filter
+func userConditions(orgID int, filter models.UserFilter) (string, []any, error) {
+	conditions := []string{"org_id = ?"}
+	args := []any{orgID}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	// Attribute names are validated against the schema before reaching here
+	for name, value := range filter.Attributes {
+		conditions = append(conditions, "json_extract(attributes, ?) = ?")
+		args = append(args, "$."+name, value)
+	}
+	if len(filter.Tags) > 0 {
+		// Resolved through the (org_id, name) and (tag_id, user_id) indexes
+		subquery := `id IN (SELECT ut.user_id FROM tags t JOIN user_tags ut ON ut.tag_id = t.id
+			WHERE t.org_id = ? AND t.name IN (?` + strings.Repeat(", ?", len(filter.Tags)-1) + `)`
+		args = append(args, orgID)
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		if filter.TagsMode == models.TagsModeAll {
+			subquery += " GROUP BY ut.user_id HAVING COUNT(*) = ?"
+			args = append(args, len(filter.Tags))
+		}
+		conditions = append(conditions, subquery+")")
+	}
+	if filter.Expression != nil {
+		condition, exprArgs, err := compileFilter(filter.Expression, userFilterFields)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, exprArgs...)
+	}
+	if filter.AfterID > 0 {
+		conditions = append(conditions, "id > ?")
+		args = append(args, filter.AfterID)
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// Find user by ID within an organization
+func (r *UserRepository) GetUserByID(orgID, id int) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ? AND org_id = ?"
+	row := r.db.QueryRow(query, id, orgID)
 
 	var user models.User
-	if err := row.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+	if err := scanUser(row, &user); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("user not found")
 		}
@@ -58,32 +286,175 @@ func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
 	return &user, nil
 }
 
-// Insert new user record
+// Find user by ID within an organization, loading only the given fields
+func (r *UserRepository) GetUserFields(orgID, id int, fields []string) (*models.User, error) {
+	query := "SELECT " + userSelectList(fields) + " FROM users WHERE id = ? AND org_id = ?"
+	row := r.db.QueryRow(query, id, orgID)
+
+	var user models.User
+	if err := scanUserFields(row, &user, fields); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Find user by email address within an organization
+func (r *UserRepository) GetUserByEmail(orgID int, email string) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE email = ? AND org_id = ?"
+	row := r.db.QueryRow(query, email, orgID)
+
+	var user models.User
+	if err := scanUser(row, &user); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Insert new user record into the user's organization
 func (r *UserRepository) CreateUser(user *models.User) error {
-	query := "INSERT INTO users (name, email) VALUES (?, ?)"
-	result, err := r.db.Exec(query, user.Name, user.Email)
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
+	if r.events != nil {
+		if err := r.events.create(tx, user); err != nil {
+			return err
+		}
+	} else {
+		attributes, err := encodeAttributes(user.Attributes)
+		if err != nil {
+			return err
+		}
+
+		query := `INSERT INTO users (org_id, name, email, role, status, status_reason, status_changed_at, attributes, password_hash,
+				created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.Exec(query, user.OrgID, user.Name, user.Email, user.Role, user.Status, user.StatusReason, user.StatusChangedAt,
+			attributes, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
+		if err != nil {
+			return translateUserError(err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		user.ID = int(id)
 	}
 
-	user.ID = int(id)
-	return nil
+	if err := recordUserEvent(tx, models.UserCreated, user.OrgID, user.ID, user.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Update existing user record
+// Update existing user record, replacing the password hash in the same transaction when one is set
+// The status and its reason are changed as well when user.Status is set
 func (r *UserRepository) UpdateUser(user *models.User) error {
 	// First check if user exists
-	if _, err := r.GetUserByID(user.ID); err != nil {
+	existing, err := r.GetUserByID(user.OrgID, user.ID)
+	if err != nil {
 		return errors.New("user not found")
 	}
 
-	query := "UPDATE users SET name = ?, email = ? WHERE id = ?"
-	result, err := r.db.Exec(query, user.Name, user.Email, user.ID)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if r.events != nil {
+		// EmailChanged clears the verification
+		_, err := r.events.change(tx, user.OrgID, user.ID, user.UpdatedAt, func(u *models.User) bool {
+			u.Name, u.Email, u.Role, u.Attributes = user.Name, user.Email, user.Role, user.Attributes
+			if user.PasswordHash != "" {
+				u.PasswordHash = user.PasswordHash
+			}
+			if user.Status != "" && user.Status != u.Status {
+				u.Status, u.StatusReason = user.Status, user.StatusReason
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		attributes, err := encodeAttributes(user.Attributes)
+		if err != nil {
+			return err
+		}
+
+		// Changing the email address invalidates its verification
+		query := `UPDATE users SET name = ?, role = ?, attributes = ?, updated_at = ?,
+			email_verified_at = CASE WHEN email = ? THEN email_verified_at ELSE NULL END,
+			email = ?,
+			password_hash = CASE WHEN ? = '' THEN password_hash ELSE ? END,
+			status_reason = CASE WHEN ? IN ('', status) THEN status_reason ELSE ? END,
+			status_changed_at = CASE WHEN ? IN ('', status) THEN status_changed_at ELSE ? END,
+			status = CASE WHEN ? = '' THEN status ELSE ? END
+			WHERE id = ? AND org_id = ?`
+		result, err := tx.Exec(query, user.Name, user.Role, attributes, user.UpdatedAt, user.Email, user.Email,
+			user.PasswordHash, user.PasswordHash, user.Status, user.StatusReason, user.Status, user.UpdatedAt,
+			user.Status, user.Status, user.ID, user.OrgID)
+		if err != nil {
+			return translateUserError(err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return errors.New("user not found")
+		}
+	}
+
+	// Verification links sent to the old address must not verify the new one
+	if existing.Email != user.Email {
+		query := "UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL"
+		if _, err := tx.Exec(query, user.UpdatedAt, user.ID, models.TokenPurposeVerifyEmail); err != nil {
+			return err
+		}
+	}
+
+	if err := recordUserEvent(tx, models.UserUpdated, user.OrgID, user.ID, user.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replace the stored password hash for a user at the given time
+// The hash is never published, so no outbox event is recorded
+func (r *UserRepository) UpdatePasswordHash(orgID, id int, hash string, at time.Time) error {
+	if r.events != nil {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = r.events.change(tx, orgID, id, at, func(u *models.User) bool {
+			u.PasswordHash = hash
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	result, err := r.db.Exec("UPDATE users SET password_hash = ? WHERE id = ? AND org_id = ?", hash, id, orgID)
 	if err != nil {
 		return err
 	}
@@ -100,27 +471,139 @@ func (r *UserRepository) UpdateUser(user *models.User) error {
 	return nil
 }
 
+// Move a user from one status to another, reporting false if the user was no longer in the expected status
+func (r *UserRepository) UpdateStatus(orgID, id int, from, to, reason string, at time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var changed bool
+	if r.events != nil {
+		changed, err = r.events.change(tx, orgID, id, at, func(u *models.User) bool {
+			if u.Status != from {
+				return false
+			}
+			u.Status, u.StatusReason = to, reason
+			return true
+		})
+		if err != nil {
+			return false, err
+		}
+	} else {
+		query := `UPDATE users SET status = ?, status_reason = ?, status_changed_at = ?, updated_at = ?
+			WHERE id = ? AND org_id = ? AND status = ?`
+		result, err := tx.Exec(query, to, reason, at, at, id, orgID, from)
+		if err != nil {
+			return false, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		changed = rowsAffected == 1
+	}
+
+	if !changed {
+		return false, nil
+	}
+	if err := recordUserEvent(tx, models.UserUpdated, orgID, id, at); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Mark a user's email address as verified
+func (r *UserRepository) SetEmailVerified(orgID, id int, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if r.events != nil {
+		_, err := r.events.change(tx, orgID, id, at, func(u *models.User) bool {
+			u.EmailVerifiedAt = &at
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.Exec("UPDATE users SET email_verified_at = ? WHERE id = ? AND org_id = ?", at, id, orgID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return errors.New("user not found")
+		}
+	}
+
+	if err := recordUserEvent(tx, models.UserUpdated, orgID, id, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Remove user record
-func (r *UserRepository) DeleteUser(id int) error {
+func (r *UserRepository) DeleteUser(orgID, id int, at time.Time) error {
 	// First check if user exists
-	if _, err := r.GetUserByID(id); err != nil {
+	if _, err := r.GetUserByID(orgID, id); err != nil {
 		return errors.New("user not found")
 	}
 
-	query := "DELETE FROM users WHERE id = ?"
-	result, err := r.db.Exec(query, id)
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	if r.events != nil {
+		if _, err := r.events.remove(tx, orgID, id, at, nil); err != nil {
+			return err
+		}
+	} else {
+		query := "DELETE FROM users WHERE id = ? AND org_id = ?"
+		result, err := tx.Exec(query, id, orgID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return errors.New("user not found")
+		}
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("user not found")
+	if err := recordUserEvent(tx, models.UserDeleted, orgID, id, at); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	return nil
+// Record a change event for a user in the outbox as part of tx
+// The event carries the user as stored after the change, except on delete
+func recordUserEvent(tx *sql.Tx, eventType string, orgID, id int, at time.Time) error {
+	event := models.UserEvent{Type: eventType, OrgID: orgID, UserID: id, OccurredAt: at}
+	if eventType != models.UserDeleted {
+		var user models.User
+		row := tx.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ? AND org_id = ?", id, orgID)
+		if err := scanUser(row, &user); err != nil {
+			return err
+		}
+		event.User = &user
+	}
+	return insertOutboxEvent(tx, &event)
 }
@@ -0,0 +1,285 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"myapp/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// User Search Repository: Full-text search over user names and emails
+// Uses an SQLite FTS5 index when the driver is built with the sqlite_fts5 tag,
+// with an in-memory alternative that scans the organization's users
+
+var ErrFTS5Unavailable = errors.New("sqlite was built without FTS5")
+
+// FTS5 wraps matches in these private-use characters instead of tags, so the
+// text can be HTML-escaped before the tags are put in
+const (
+	markOpen  = "\ue000"
+	markClose = "\ue001"
+)
+
+// Search index statements; kept out of the versioned migrations because they
+// depend on how the SQLite driver was built
+const userSearchIndexSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+		name, email, content='users', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+		INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+	END;
+	CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+		INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+	END;
+	CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF name, email ON users BEGIN
+		INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+		INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+	END;`
+
+const userSearchTriggers = `DROP TRIGGER IF EXISTS users_fts_insert;
+	DROP TRIGGER IF EXISTS users_fts_delete;
+	DROP TRIGGER IF EXISTS users_fts_update;`
+
+// Create the FTS5 index and its sync triggers, rebuilding the index if any trigger was missing
+// Without FTS5 the triggers are dropped so writes to users keep working, and ErrFTS5Unavailable is returned
+func EnableUserSearchIndex(db *sql.DB) error {
+	var available bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return err
+	}
+	if !available {
+		if _, err := db.Exec(userSearchTriggers); err != nil {
+			return err
+		}
+		return ErrFTS5Unavailable
+	}
+
+	var triggers int
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'users_fts_%'"
+	if err := db.QueryRow(query).Scan(&triggers); err != nil {
+		return err
+	}
+	if _, err := db.Exec(userSearchIndexSchema); err != nil {
+		return err
+	}
+	if triggers < 3 {
+		// Users written while the index was not maintained are picked up here
+		_, err := db.Exec("INSERT INTO users_fts (users_fts) VALUES ('rebuild')")
+		return err
+	}
+	return nil
+}
+
+type UserSearchRepository struct {
+	db *sql.DB
+}
+
+func NewUserSearchRepository(db *sql.DB) *UserSearchRepository {
+	return &UserSearchRepository{db: db}
+}
+
+// Find users whose name or email has words starting with every term, best matches first
+func (r *UserSearchRepository) Search(orgID int, terms []string, limit, offset int) (*models.UserSearchPage, error) {
+	// Terms only contain letters and digits, so quoting them is enough to keep
+	// FTS5 query syntax out of user input
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+	match := strings.Join(phrases, " ")
+
+	page := &models.UserSearchPage{Results: []models.UserSearchResult{}, Limit: limit, Offset: offset}
+	query := `SELECT COUNT(*) FROM users_fts JOIN users ON users.id = users_fts.rowid
+		WHERE users_fts MATCH ? AND users.org_id = ?`
+	if err := r.db.QueryRow(query, match, orgID).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// Name matches weigh twice as much as email matches
+	query = `SELECT ` + userColumns + `, m.score, m.name_hl, m.email_hl FROM users JOIN (
+			SELECT rowid AS user_id, -bm25(users_fts, 10.0, 5.0) AS score,
+				highlight(users_fts, 0, ?, ?) AS name_hl,
+				highlight(users_fts, 1, ?, ?) AS email_hl
+			FROM users_fts WHERE users_fts MATCH ?
+		) m ON m.user_id = users.id
+		WHERE users.org_id = ? ORDER BY m.score DESC, users.id LIMIT ? OFFSET ?`
+	rows, err := r.db.Query(query, markOpen, markClose, markOpen, markClose, match, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.UserSearchResult
+		var name, email sql.NullString
+		if err := scanUser(rows, &result.User, &result.Score, &name, &email); err != nil {
+			return nil, err
+		}
+		result.Highlights = highlights(markHighlight(name.String), markHighlight(email.String))
+		page.Results = append(page.Results, result)
+	}
+
+	return page, rows.Err()
+}
+
+// Escape FTS5 highlight output for HTML and turn its match markers into <mark> tags
+func markHighlight(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, markOpen, "<mark>")
+	return strings.ReplaceAll(text, markClose, "</mark>")
+}
+
+// Keep only the highlights that contain a match
+func highlights(name, email string) map[string]string {
+	marked := map[string]string{}
+	if strings.Contains(name, "<mark>") {
+		marked["name"] = name
+	}
+	if strings.Contains(email, "<mark>") {
+		marked["email"] = email
+	}
+	return marked
+}
+
+// In-memory search with the same matching rules as UserSearchRepository
+// Users are read from the database on every search, so it suits small organizations
+type MemoryUserSearch struct {
+	userRepo *UserRepository
+}
+
+func NewMemoryUserSearch(userRepo *UserRepository) *MemoryUserSearch {
+	return &MemoryUserSearch{userRepo: userRepo}
+}
+
+// Find users whose name or email has words starting with every term, best matches first
+func (m *MemoryUserSearch) Search(orgID int, terms []string, limit, offset int) (*models.UserSearchPage, error) {
+	users, err := m.userRepo.GetAllUsers(orgID, models.UserFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []models.UserSearchResult{}
+	for _, user := range users {
+		nameScore, name := matchText(user.Name, terms)
+		emailScore, email := matchText(user.Email, terms)
+		if !allMatched(nameScore, emailScore) {
+			continue
+		}
+		var score float64
+		for i := range terms {
+			score += 2*nameScore[i] + emailScore[i]
+		}
+		matches = append(matches, models.UserSearchResult{User: user, Score: score, Highlights: highlights(name, email)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	page := &models.UserSearchPage{Results: []models.UserSearchResult{}, Total: len(matches), Limit: limit, Offset: offset}
+	if offset < len(matches) {
+		page.Results = matches[offset:min(offset+limit, len(matches))]
+	}
+	return page, nil
+}
+
+// Score each term against the words of text and mark the matching words
+// A whole-word match scores 2, a prefix match 1; the marked text is HTML-escaped
+func matchText(text string, terms []string) ([]float64, string) {
+	scores := make([]float64, len(terms))
+	var marked strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			marked.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := FoldSearchText(string(runes[i:end]))
+		hit := false
+		for t, term := range terms {
+			if word == term {
+				scores[t] += 2
+				hit = true
+			} else if strings.HasPrefix(word, term) {
+				scores[t]++
+				hit = true
+			}
+		}
+		if hit {
+			marked.WriteString("<mark>" + string(runes[i:end]) + "</mark>")
+		} else {
+			marked.WriteString(string(runes[i:end]))
+		}
+		i = end
+	}
+	return scores, marked.String()
+}
+
+// Report whether every term matched at least one field
+func allMatched(nameScore, emailScore []float64) bool {
+	for i := range nameScore {
+		if nameScore[i] == 0 && emailScore[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Split a search query into lowercase, diacritic-free words
+func SearchTerms(q string) []string {
+	return strings.FieldsFunc(FoldSearchText(q), func(r rune) bool { return !isWordRune(r) })
+}
+
+// Lowercase text and strip diacritics from Latin letters, e.g. "Zoë Ångström" -> "zoe angstrom"
+func FoldSearchText(text string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if base, ok := foldedRunes[r]; ok {
+			return base
+		}
+		return r
+	}, text)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Accented Latin letters and their base letters
+var foldedRunes = func() map[rune]rune {
+	table := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşš",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	folded := map[rune]rune{}
+	for base, accented := range table {
+		for _, r := range accented {
+			folded[r] = base
+		}
+	}
+	return folded
+}()
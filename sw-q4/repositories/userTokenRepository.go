@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"time"
+)
+
+// User Token Repository: Persists hashed single-use tokens
+// Tokens are consumed atomically so each can be used exactly once
+
+var ErrTokenInvalid = errors.New("invalid or expired token")
+
+type UserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// Store a new token, superseding unused tokens with the same purpose
+func (r *UserTokenRepository) Create(token *models.UserToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL"
+	if _, err := tx.Exec(query, token.CreatedAt, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+
+	return tx.Commit()
+}
+
+// Mark an unused, unexpired token as used and return the user and organization it belongs to
+func (r *UserTokenRepository) Consume(hash, purpose string, now time.Time) (userID, orgID int, err error) {
+	query := `UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id, (SELECT org_id FROM users WHERE users.id = user_tokens.user_id)`
+
+	if err := r.db.QueryRow(query, now, hash, purpose, now).Scan(&userID, &orgID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, 0, ErrTokenInvalid
+		}
+		return 0, 0, err
+	}
+
+	return userID, orgID, nil
+}
+
+// Mark an unused, unexpired token of the given user as used and return the user's organization
+func (r *UserTokenRepository) ConsumeForUser(userID int, hash, purpose string, now time.Time) (orgID int, err error) {
+	query := `UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING (SELECT org_id FROM users WHERE users.id = user_tokens.user_id)`
+
+	if err := r.db.QueryRow(query, now, hash, purpose, userID, now).Scan(&orgID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrTokenInvalid
+		}
+		return 0, err
+	}
+
+	return orgID, nil
+}
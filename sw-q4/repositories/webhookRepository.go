@@ -0,0 +1,236 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"myapp/models"
+	"slices"
+	"time"
+)
+
+// Webhook Repository: Handles database operations for webhooks and their delivery queue
+// Deliveries are the persistent queue and, once finished, the delivery log
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookColumns = "id, org_id, url, events, active, created_at, updated_at"
+
+func scanWebhook(row interface{ Scan(...any) error }) (*models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.OrgID, &w.URL, &events, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Retrieve all webhooks of an organization, without their secrets
+func (r *WebhookRepository) List(orgID int) ([]models.Webhook, error) {
+	rows, err := r.db.Query("SELECT "+webhookColumns+" FROM webhooks WHERE org_id = ? ORDER BY id", orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Find a webhook by ID within an organization, without its secret
+func (r *WebhookRepository) GetByID(orgID, id int) (*models.Webhook, error) {
+	row := r.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ? AND org_id = ?", id, orgID)
+	w, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	return w, err
+}
+
+// Insert a new webhook, including its secret
+func (r *WebhookRepository) Create(w *models.Webhook) error {
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`INSERT INTO webhooks (org_id, url, events, secret, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, w.OrgID, w.URL, string(events), w.Secret, w.Active, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	w.ID = int(id)
+
+	return nil
+}
+
+// Update a webhook's URL, events and active flag; the secret is kept
+func (r *WebhookRepository) Update(w *models.Webhook) error {
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec("UPDATE webhooks SET url = ?, events = ?, active = ?, updated_at = ? WHERE id = ? AND org_id = ?",
+		w.URL, string(events), w.Active, w.UpdatedAt, w.ID, w.OrgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// Delete a webhook and, through the cascade, its deliveries
+func (r *WebhookRepository) Delete(orgID, id int) error {
+	result, err := r.db.Exec("DELETE FROM webhooks WHERE id = ? AND org_id = ?", id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// Queue a delivery of event to every active webhook of its organization subscribed to the event type
+// Queuing an event again is ignored, as the outbox may relay it more than once
+func (r *WebhookRepository) Enqueue(event models.UserEvent, payload []byte, now time.Time) error {
+	webhooks, err := r.List(event.OrgID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, w := range webhooks {
+		if !w.Active || (len(w.Events) > 0 && !slices.Contains(w.Events, event.Type)) {
+			continue
+		}
+		_, err := tx.Exec(`INSERT OR IGNORE INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, w.ID, event.ID, event.Type, string(payload), models.DeliveryPending, now, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.response_status, d.last_error, d.created_at, d.completed_at`
+
+func scanDelivery(row interface{ Scan(...any) error }, extra ...any) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	var next, completed sql.NullTime
+	dest := append([]any{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &next,
+		&d.ResponseStatus, &d.LastError, &d.CreatedAt, &completed}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	if completed.Valid {
+		d.CompletedAt = &completed.Time
+	}
+	return &d, nil
+}
+
+// Pending deliveries whose next attempt is due, oldest first, with their webhook's URL and secret
+func (r *WebhookRepository) DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + `, w.url, w.secret FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ?`
+	rows, err := r.db.Query(query, models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, *d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Store the outcome of an attempt: its status, attempt count, schedule and last response
+func (r *WebhookRepository) RecordAttempt(d *models.WebhookDelivery) error {
+	_, err := r.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?,
+		last_error = ?, completed_at = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt, d.ResponseStatus, d.LastError, d.CompletedAt, d.ID)
+	return err
+}
+
+// List a webhook's deliveries, newest first
+func (r *WebhookRepository) ListDeliveries(orgID, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = ? AND w.org_id = ? ORDER BY d.id DESC LIMIT ?`
+	rows, err := r.db.Query(query, webhookID, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Find one delivery of a webhook within an organization
+func (r *WebhookRepository) GetDelivery(orgID, webhookID, id int) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id = ? AND d.webhook_id = ? AND w.org_id = ?`
+	d, err := scanDelivery(r.db.QueryRow(query, id, webhookID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	}
+	return d, err
+}
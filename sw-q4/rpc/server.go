@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"myapp/handlers"
+	"myapp/rpc/userpb"
+	"myapp/services"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RPC Server: gRPC server exposing the user service
+// Calls authenticate like REST requests, with "authorization" and "x-org-id" metadata
+
+// Create a gRPC server with authentication and the UserService registered
+func NewServer(authenticator *handlers.Authenticator, userService *services.UserService) *grpc.Server {
+	auth := &authInterceptor{authenticator: authenticator}
+	server := grpc.NewServer(grpc.UnaryInterceptor(auth.unary), grpc.StreamInterceptor(auth.stream))
+	userpb.RegisterUserServiceServer(server, NewUserServer(userService))
+	return server
+}
+
+type authInterceptor struct {
+	authenticator *handlers.Authenticator
+}
+
+// Attach the caller's principal and organization to ctx
+func (a *authInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, err := a.authenticator.Authenticate(ctx, first(md, "authorization"), first(md, "x-org-id"))
+	if err != nil {
+		var authErr *handlers.AuthError
+		if errors.As(err, &authErr) {
+			if code, ok := statusCodes[authErr.Status]; ok {
+				return nil, status.Error(code, authErr.Msg)
+			}
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return ctx, nil
+}
+
+func (a *authInterceptor) unary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authInterceptor) stream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// Server stream carrying the authenticated context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
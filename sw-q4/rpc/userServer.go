@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"myapp/filter"
+	"myapp/handlers"
+	"myapp/models"
+	"myapp/repositories"
+	"myapp/rpc/userpb"
+	"myapp/services"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// User RPC Server: Implements the gRPC UserService on top of the user service
+// Shares authorization rules with the REST handlers and maps domain errors to status codes
+
+// Users loaded per query while streaming ListUsers
+const listBatchSize = 100
+
+type UserServer struct {
+	userpb.UnimplementedUserServiceServer
+	userService *services.UserService
+}
+
+func NewUserServer(userService *services.UserService) *UserServer {
+	return &UserServer{userService: userService}
+}
+
+func (s *UserServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.User, error) {
+	user, err := s.userService.GetUserByID(handlers.OrgFromContext(ctx), int(req.Id))
+	if err != nil {
+		return nil, userError(err)
+	}
+	return toProto(user)
+}
+
+func (s *UserServer) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.User, error) {
+	if req.Role != "" && req.Role != models.RoleUser && !handlers.PrincipalFromContext(ctx).IsAdmin() {
+		return nil, status.Error(codes.PermissionDenied, "only administrators can assign roles")
+	}
+
+	orgID := handlers.OrgFromContext(ctx)
+	user := &models.User{OrgID: orgID, Name: req.Name, Email: req.Email, Password: req.Password, Role: req.Role}
+	if req.Attributes != nil {
+		user.Attributes = req.Attributes.AsMap()
+	}
+	if err := s.userService.CreateUser(user); err != nil {
+		return nil, userError(err)
+	}
+
+	created, err := s.userService.GetUserByID(orgID, user.ID)
+	if err != nil {
+		return nil, userError(err)
+	}
+	return toProto(created)
+}
+
+func (s *UserServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.User, error) {
+	orgID := handlers.OrgFromContext(ctx)
+	id := int(req.Id)
+	if err := authorizeUserWrite(ctx, id); err != nil {
+		return nil, err
+	}
+	if req.Password != "" {
+		return nil, status.Error(codes.InvalidArgument, "passwords are changed with POST /users/{id}/password")
+	}
+	if req.Role != "" && !handlers.PrincipalFromContext(ctx).IsAdmin() {
+		existing, err := s.userService.GetUserByID(orgID, id)
+		if err != nil {
+			return nil, userError(err)
+		}
+		if existing.Role != req.Role {
+			return nil, status.Error(codes.PermissionDenied, "only administrators can assign roles")
+		}
+	}
+
+	user := &models.User{ID: id, OrgID: orgID, Name: req.Name, Email: req.Email, Role: req.Role}
+	if req.Attributes != nil {
+		user.Attributes = req.Attributes.AsMap()
+	}
+	if err := s.userService.UpdateUser(user); err != nil {
+		return nil, userError(err)
+	}
+
+	updated, err := s.userService.GetUserByID(orgID, id)
+	if err != nil {
+		return nil, userError(err)
+	}
+	return toProto(updated)
+}
+
+func (s *UserServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := authorizeUserWrite(ctx, int(req.Id)); err != nil {
+		return nil, err
+	}
+	if err := s.userService.DeleteUser(handlers.OrgFromContext(ctx), int(req.Id)); err != nil {
+		return nil, userError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Check that the caller is the user or an administrator before changing a user
+func authorizeUserWrite(ctx context.Context, id int) error {
+	principal := handlers.PrincipalFromContext(ctx)
+	if principal == nil {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if !principal.CanManageUser(id) {
+		return status.Error(codes.PermissionDenied, "cannot modify another user")
+	}
+	return nil
+}
+
+// Stream matching users in ID order, loading them in batches so large organizations are not held in memory
+func (s *UserServer) ListUsers(req *userpb.ListUsersRequest, stream userpb.UserService_ListUsersServer) error {
+	ctx := stream.Context()
+	criteria := models.UserFilter{Status: req.Status, Limit: listBatchSize}
+	if req.Filter != "" {
+		parsed, err := filter.Parse(req.Filter)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		criteria.Expression = parsed
+	}
+
+	for {
+		users, err := s.userService.GetAllUsers(handlers.OrgFromContext(ctx), criteria)
+		if err != nil {
+			return userError(err)
+		}
+		for i := range users {
+			user, err := toProto(&users[i])
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(user); err != nil {
+				return err
+			}
+		}
+		if len(users) < listBatchSize {
+			return nil
+		}
+		criteria.AfterID = users[len(users)-1].ID
+	}
+}
+
+// Convert a stored user to its protobuf representation
+func toProto(u *models.User) (*userpb.User, error) {
+	attributes, err := structpb.NewStruct(u.Attributes)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	user := &userpb.User{
+		Id:            int64(u.ID),
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Role:          u.Role,
+		Status:        &userpb.UserStatus{State: u.Status, Reason: u.StatusReason},
+		Tags:          u.Tags,
+		Attributes:    attributes,
+		CreatedAt:     timestamppb.New(u.CreatedAt),
+		UpdatedAt:     timestamppb.New(u.UpdatedAt),
+	}
+	if u.StatusChangedAt != nil {
+		user.Status.ChangedAt = timestamppb.New(*u.StatusChangedAt)
+	}
+	return user, nil
+}
+
+// HTTP statuses used by the REST API and the matching gRPC codes
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:   codes.InvalidArgument,
+	http.StatusUnauthorized: codes.Unauthenticated,
+	http.StatusForbidden:    codes.PermissionDenied,
+	http.StatusNotFound:     codes.NotFound,
+	http.StatusConflict:     codes.FailedPrecondition,
+}
+
+// Map user service errors onto gRPC status errors
+func userError(err error) error {
+	if errors.Is(err, repositories.ErrEmailTaken) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	code, ok := statusCodes[handlers.UserErrorStatus(err)]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
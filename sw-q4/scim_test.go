@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"myapp/handlers/scim"
+	"myapp/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// SCIM compliance tests: exercise /scim/v2 over HTTP the way identity providers do,
+// including the request shapes of providers that send capitalized ops and string booleans
+
+type scimClient struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+type scimList[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+// Start a server with an administrator's token for SCIM requests
+func newSCIMClient(t *testing.T) *scimClient {
+	t.Helper()
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	token := setupAdmin(t, router, clock)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &scimClient{t: t, server: server, token: token}
+}
+
+// Send a request and decode the response into out, returning the response
+func (c *scimClient) do(method, path string, body, out any) *http.Response {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.server.URL+scim.BasePath+path, &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", scim.ContentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.Header.Get("Content-Type") != scim.ContentType {
+		c.t.Errorf("%s %s: Content-Type %q", method, path, resp.Header.Get("Content-Type"))
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// Send a request expected to fail and check the SCIM error body
+func (c *scimClient) expectError(method, path string, body any, status int, scimType string) {
+	c.t.Helper()
+	var e scim.Error
+	resp := c.do(method, path, body, &e)
+	if resp.StatusCode != status || e.Status != strconv.Itoa(status) || e.ScimType != scimType ||
+		len(e.Schemas) != 1 || e.Schemas[0] != scim.ErrorSchema {
+		c.t.Errorf("%s %s: got %v %+v, want %v %q", method, path, resp.StatusCode, e, status, scimType)
+	}
+}
+
+func filterQuery(expr string) string {
+	return "?filter=" + url.QueryEscape(expr)
+}
+
+func patchOp(ops ...map[string]any) map[string]any {
+	return map[string]any{"schemas": []string{scim.PatchOpSchema}, "Operations": ops}
+}
+
+// Test the discovery endpoints, which need no authentication
+func TestSCIMDiscovery(t *testing.T) {
+	c := newSCIMClient(t)
+	c.token = ""
+
+	var config scim.ServiceProviderConfig
+	if resp := c.do("GET", "/ServiceProviderConfig", nil, &config); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ServiceProviderConfig: got %v", resp.StatusCode)
+	}
+	if !config.Patch.Supported || !config.Filter.Supported || config.Filter.MaxResults != scim.MaxResults || config.Bulk.Supported ||
+		len(config.AuthenticationSchemes) != 1 || config.Schemas[0] != scim.ServiceConfigSchema {
+		t.Errorf("ServiceProviderConfig: got %+v", config)
+	}
+
+	var types scimList[scim.ResourceType]
+	c.do("GET", "/ResourceTypes", nil, &types)
+	if types.TotalResults != 2 || types.Resources[0].Endpoint != "/Users" || types.Resources[1].Schema != scim.GroupSchema {
+		t.Errorf("ResourceTypes: got %+v", types)
+	}
+	var userType scim.ResourceType
+	if resp := c.do("GET", "/ResourceTypes/User", nil, &userType); resp.StatusCode != http.StatusOK || userType.Schema != scim.UserSchema {
+		t.Errorf("ResourceTypes/User: got %v %+v", resp.StatusCode, userType)
+	}
+
+	var schemas scimList[scim.Schema]
+	c.do("GET", "/Schemas", nil, &schemas)
+	if schemas.TotalResults != 2 || schemas.Resources[0].ID != scim.UserSchema || schemas.Resources[0].Attributes[0].Name != "userName" {
+		t.Errorf("Schemas: got %+v", schemas)
+	}
+	var group scim.Schema
+	if resp := c.do("GET", "/Schemas/"+scim.GroupSchema, nil, &group); resp.StatusCode != http.StatusOK || group.Name != "Group" {
+		t.Errorf("Group schema: got %v %+v", resp.StatusCode, group)
+	}
+	c.expectError("GET", "/Schemas/urn:unknown", nil, http.StatusNotFound, "")
+}
+
+// Test provisioning a user through its whole lifecycle
+func TestSCIMUsers(t *testing.T) {
+	c := newSCIMClient(t)
+	admin := c.token
+
+	// Only administrators may provision
+	c.token = ""
+	c.expectError("GET", "/Users", nil, http.StatusUnauthorized, "")
+	c.token = loginTestUser(t, c.server.Config.Handler).AccessToken
+	c.expectError("GET", "/Users", nil, http.StatusForbidden, "")
+	c.token = admin
+
+	newUser := map[string]any{
+		"schemas":  []string{scim.UserSchema},
+		"userName": "jdoe@example.com",
+		"name":     map[string]string{"givenName": "John", "familyName": "Doe"},
+		"emails":   []map[string]any{{"value": "jdoe@example.com", "type": "work", "primary": true}},
+		"active":   true,
+		"password": "provisioned password",
+	}
+	var user scim.User
+	resp := c.do("POST", "/Users", newUser, &user)
+	if resp.StatusCode != http.StatusCreated || user.ID == "" || user.DisplayName != "John Doe" || !*user.Active ||
+		user.Meta.ResourceType != "User" || resp.Header.Get("Location") != user.Meta.Location || user.Password != "" {
+		t.Fatalf("Create: got %v %+v", resp.StatusCode, user)
+	}
+	path := "/Users/" + user.ID
+	c.expectError("POST", "/Users", newUser, http.StatusConflict, scim.ErrUniqueness)
+	c.expectError("POST", "/Users", map[string]any{"schemas": []string{scim.UserSchema}}, http.StatusBadRequest, scim.ErrInvalidValue)
+
+	// The password is usable for login
+	if rr := doJSON(t, c.server.Config.Handler, "POST", "/auth/login", models.Credentials{Email: "jdoe@example.com", Password: "provisioned password"}); rr.Code != http.StatusOK {
+		t.Errorf("Login with provisioned password: got %v", rr.Code)
+	}
+
+	// Filtering and pagination
+	var list scimList[scim.User]
+	c.do("GET", "/Users"+filterQuery(`userName eq "jdoe@example.com"`), nil, &list)
+	if list.TotalResults != 1 || list.Resources[0].ID != user.ID || list.Schemas[0] != scim.ListResponseSchema {
+		t.Errorf("Filter by userName: got %+v", list)
+	}
+	list = scimList[scim.User]{}
+	c.do("GET", "/Users"+filterQuery(`USERNAME eq "nobody@example.com"`), nil, &list)
+	if list.TotalResults != 0 || list.Resources == nil {
+		t.Errorf("Filter without matches: got %+v", list)
+	}
+	c.do("GET", "/Users"+filterQuery(`name.formatted sw "John" and active eq true`), nil, &list)
+	if list.TotalResults != 1 {
+		t.Errorf("Filter by name and active: got %+v", list)
+	}
+	c.expectError("GET", "/Users"+filterQuery(`userName zz "x"`), nil, http.StatusBadRequest, scim.ErrInvalidFilter)
+	c.expectError("GET", "/Users"+filterQuery(`externalId eq "x"`), nil, http.StatusBadRequest, scim.ErrInvalidFilter)
+	c.do("GET", "/Users?startIndex=2&count=2", nil, &list)
+	if list.TotalResults != 4 || list.StartIndex != 2 || list.ItemsPerPage != 2 || list.Resources[0].UserName != "admin@example.com" {
+		t.Errorf("Page: got %+v", list)
+	}
+	c.do("GET", "/Users?count=0", nil, &list)
+	if list.TotalResults != 4 || len(list.Resources) != 0 {
+		t.Errorf("Count 0: got %+v", list)
+	}
+	list = scimList[scim.User]{}
+	c.do("GET", "/Users?startIndex=4&count=10", nil, &list)
+	if list.TotalResults != 4 || list.ItemsPerPage != 1 || list.Resources[0].ID != user.ID {
+		t.Errorf("Last page: got %+v", list)
+	}
+	c.do("GET", "/Users?startIndex=9", nil, &list)
+	if list.TotalResults != 4 || len(list.Resources) != 0 {
+		t.Errorf("Past the end: got %+v", list)
+	}
+
+	c.expectError("GET", "/Users/999", nil, http.StatusNotFound, "")
+	c.expectError("GET", "/Users/abc", nil, http.StatusNotFound, "")
+
+	// Replace, then patch individual attributes
+	replaced := map[string]any{"schemas": []string{scim.UserSchema}, "userName": "john@example.com", "displayName": "John Doe"}
+	if resp := c.do("PUT", path, replaced, &user); resp.StatusCode != http.StatusOK || user.UserName != "john@example.com" || user.Emails[0].Value != "john@example.com" {
+		t.Errorf("Replace: got %v %+v", resp.StatusCode, user)
+	}
+	c.do("PATCH", path, patchOp(map[string]any{"op": "Replace", "path": "name.givenName", "value": "Johnny"}), &user)
+	if user.DisplayName != "Johnny Doe" || user.Name.FamilyName != "Doe" {
+		t.Errorf("Patch givenName: got %+v", user)
+	}
+	c.do("PATCH", path, patchOp(map[string]any{"op": "replace", "path": `emails[type eq "work"].value`, "value": "johnny@example.com"}), &user)
+	if user.UserName != "johnny@example.com" {
+		t.Errorf("Patch email: got %+v", user)
+	}
+
+	// A password is only stored together with the rest of the change, and ends earlier logins
+	router := c.server.Config.Handler
+	rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "johnny@example.com", Password: "provisioned password"})
+	var tokens models.TokenPair
+	decodeBody(t, rr.Body, &tokens)
+	c.expectError("PATCH", path, patchOp(
+		map[string]any{"op": "replace", "path": "password", "value": "rotated password"},
+		map[string]any{"op": "replace", "path": "userName", "value": "admin@example.com"},
+	), http.StatusConflict, scim.ErrUniqueness)
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "johnny@example.com", Password: "provisioned password"}); rr.Code != http.StatusOK {
+		t.Errorf("Password after failed update: got %v want %v", rr.Code, http.StatusOK)
+	}
+	c.do("PATCH", path, patchOp(map[string]any{"op": "replace", "path": "password", "value": "rotated password"}), &user)
+	if rr := doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "johnny@example.com", Password: "rotated password"}); rr.Code != http.StatusOK {
+		t.Errorf("Login with new password: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh token from before the change: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Deactivate and reactivate; a change of active is stored with the rest of the update as one event
+	pending := len(unpublishedEvents(t))
+	c.do("PATCH", path, patchOp(map[string]any{"op": "replace", "value": map[string]any{"active": false, "displayName": "J. Doe"}}), &user)
+	var status string
+	db.QueryRow("SELECT status FROM users WHERE email = 'johnny@example.com'").Scan(&status)
+	if *user.Active || status != models.StatusDeactivated || user.DisplayName != "J. Doe" {
+		t.Errorf("Deactivate: got %+v, status %q", user, status)
+	}
+	if events := unpublishedEvents(t); len(events) != pending+1 || events[pending].User.Status != models.StatusDeactivated {
+		t.Errorf("Deactivate: got events %+v", events[pending:])
+	}
+	c.do("GET", "/Users"+filterQuery(`active eq false`), nil, &list)
+	if list.TotalResults != 1 || list.Resources[0].ID != user.ID {
+		t.Errorf("Filter inactive: got %+v", list)
+	}
+	c.do("PATCH", path, patchOp(map[string]any{"op": "Replace", "path": "active", "value": "True"}), &user)
+	if !*user.Active {
+		t.Errorf("Reactivate: got %+v", user)
+	}
+
+	c.expectError("PATCH", path, patchOp(map[string]any{"op": "replace", "path": "nickName", "value": "JD"}), http.StatusBadRequest, scim.ErrInvalidPath)
+	c.expectError("PATCH", path, patchOp(map[string]any{"op": "remove", "path": "userName"}), http.StatusBadRequest, scim.ErrMutability)
+	c.expectError("PATCH", path, patchOp(map[string]any{"op": "move", "path": "userName"}), http.StatusBadRequest, scim.ErrInvalidSyntax)
+	c.expectError("PATCH", path, patchOp(map[string]any{"op": "replace", "path": "userName", "value": "admin@example.com"}), http.StatusConflict, scim.ErrUniqueness)
+
+	if resp := c.do("DELETE", path, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Delete: got %v", resp.StatusCode)
+	}
+	c.expectError("GET", path, nil, http.StatusNotFound, "")
+	c.expectError("DELETE", path, nil, http.StatusNotFound, "")
+
+	// A user provisioned inactive is created deactivated, never active
+	pending = len(unpublishedEvents(t))
+	resp = c.do("POST", "/Users", map[string]any{"userName": "inactive@example.com", "displayName": "Ina Active", "active": false}, &user)
+	db.QueryRow("SELECT status FROM users WHERE email = 'inactive@example.com'").Scan(&status)
+	if resp.StatusCode != http.StatusCreated || *user.Active || status != models.StatusDeactivated {
+		t.Errorf("Create inactive: got %v %+v, status %q", resp.StatusCode, user, status)
+	}
+	if events := unpublishedEvents(t); len(events) != pending+1 || events[pending].Type != models.UserCreated || events[pending].User.Status != models.StatusDeactivated {
+		t.Errorf("Create inactive: got events %+v", events[pending:])
+	}
+}
+
+// Test groups and their memberships
+func TestSCIMGroups(t *testing.T) {
+	c := newSCIMClient(t)
+
+	var user scim.User
+	c.do("POST", "/Users", map[string]any{"userName": "jdoe@example.com", "displayName": "John Doe"}, &user)
+
+	var group scim.Group
+	resp := c.do("POST", "/Groups", map[string]any{
+		"schemas":     []string{scim.GroupSchema},
+		"displayName": "Engineering",
+		"members":     []map[string]string{{"value": user.ID}},
+	}, &group)
+	if resp.StatusCode != http.StatusCreated || len(group.Members) != 1 || group.Members[0].Display != "John Doe" || resp.Header.Get("Location") != group.Meta.Location {
+		t.Fatalf("Create: got %v %+v", resp.StatusCode, group)
+	}
+	path := "/Groups/" + group.ID
+	c.expectError("POST", "/Groups", map[string]any{"displayName": "Engineering"}, http.StatusConflict, scim.ErrUniqueness)
+	c.expectError("POST", "/Groups", map[string]any{"displayName": "Ops", "members": []map[string]string{{"value": "x"}}}, http.StatusBadRequest, scim.ErrInvalidValue)
+
+	c.do("GET", "/Users/"+user.ID, nil, &user)
+	if len(user.Groups) != 1 || user.Groups[0].Display != "Engineering" {
+		t.Errorf("User groups: got %+v", user.Groups)
+	}
+
+	var list scimList[scim.Group]
+	c.do("GET", "/Groups"+filterQuery(`displayName eq "Engineering"`), nil, &list)
+	if list.TotalResults != 1 || list.Resources[0].ID != group.ID || len(list.Resources[0].Members) != 1 {
+		t.Errorf("Filter by displayName: got %+v", list)
+	}
+	list = scimList[scim.Group]{}
+	c.do("GET", "/Groups?excludedAttributes=members", nil, &list)
+	if list.TotalResults != 1 || list.Resources[0].Members != nil {
+		t.Errorf("Excluded members: got %+v", list)
+	}
+
+	// Add, remove and rename with PATCH
+	c.do("PATCH", path, patchOp(map[string]any{"op": "Add", "path": "members", "value": []map[string]string{{"value": "1"}, {"value": user.ID}}}), &group)
+	if len(group.Members) != 2 {
+		t.Errorf("Add member: got %+v", group.Members)
+	}
+	c.do("PATCH", path, patchOp(
+		map[string]any{"op": "Remove", "path": `members[value eq "1"]`},
+		map[string]any{"op": "Replace", "path": "displayName", "value": "Platform"},
+	), &group)
+	if len(group.Members) != 1 || group.Members[0].Value != user.ID || group.DisplayName != "Platform" {
+		t.Errorf("Remove member and rename: got %+v", group)
+	}
+	group = scim.Group{}
+	c.do("PATCH", path, patchOp(map[string]any{"op": "remove", "path": "members", "value": []map[string]string{{"value": user.ID}}}), &group)
+	if len(group.Members) != 0 {
+		t.Errorf("Remove listed member: got %+v", group.Members)
+	}
+	c.expectError("PATCH", path, patchOp(map[string]any{"op": "add", "path": "members", "value": []map[string]string{{"value": "999"}}}), http.StatusBadRequest, scim.ErrInvalidValue)
+
+	// An unknown member fails the whole write: no group is created and a replace keeps the name
+	c.expectError("POST", "/Groups", map[string]any{"displayName": "Ops", "members": []map[string]string{{"value": "999"}}}, http.StatusBadRequest, scim.ErrInvalidValue)
+	list = scimList[scim.Group]{}
+	c.do("GET", "/Groups"+filterQuery(`displayName eq "Ops"`), nil, &list)
+	if list.TotalResults != 0 {
+		t.Errorf("Group with an unknown member: got %+v", list)
+	}
+	c.expectError("PUT", path, map[string]any{"displayName": "Infra", "members": []map[string]string{{"value": user.ID}, {"value": "999"}}}, http.StatusBadRequest, scim.ErrInvalidValue)
+	c.do("GET", path, nil, &group)
+	if group.DisplayName != "Platform" || len(group.Members) != 0 {
+		t.Errorf("Replace with an unknown member: got %+v", group)
+	}
+
+	// Existing members keep their role when the group is replaced
+	if _, err := db.Exec("INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, 1, 'owner', ?)", group.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	replaced := map[string]any{"displayName": "Platform", "members": []map[string]string{{"value": "1"}, {"value": user.ID}}}
+	if resp := c.do("PUT", path, replaced, &group); resp.StatusCode != http.StatusOK || len(group.Members) != 2 {
+		t.Errorf("Replace: got %v %+v", resp.StatusCode, group)
+	}
+	var role string
+	db.QueryRow("SELECT role FROM group_members WHERE user_id = 1").Scan(&role)
+	if role != models.GroupRoleOwner {
+		t.Errorf("Owner role after replace: got %q", role)
+	}
+
+	if resp := c.do("DELETE", path, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Delete: got %v", resp.StatusCode)
+	}
+	c.expectError("GET", path, nil, http.StatusNotFound, "")
+}
@@ -0,0 +1,21 @@
+//go:build sqlite_fts5
+
+package main
+
+import (
+	"myapp/repositories"
+	"testing"
+)
+
+// With FTS5 compiled in, the search tests also run against the index
+func init() {
+	searchBackends = append(searchBackends, "fts")
+}
+
+// Test that the index is created rather than falling back to in-memory search
+func TestSearchIndexEnabled(t *testing.T) {
+	setupTestDatabase(t)
+	if err := repositories.EnableUserSearchIndex(db); err != nil {
+		t.Fatalf("EnableUserSearchIndex: %v", err)
+	}
+}
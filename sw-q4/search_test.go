@@ -0,0 +1,132 @@
+package main
+
+import (
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// Search users through the API and return the page of results
+func searchUsers(t *testing.T, router http.Handler, q, extra string) models.UserSearchPage {
+	t.Helper()
+	rr := doJSON(t, router, "GET", "/users/search?q="+url.QueryEscape(q)+extra, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Search %q: got %v want %v", q, rr.Code, http.StatusOK)
+	}
+	var page models.UserSearchPage
+	decodeBody(t, rr.Body, &page)
+	return page
+}
+
+// Search backends to test; the sqlite_fts5 build tag adds "fts"
+var searchBackends = []string{"", "memory"}
+
+func resultNames(page models.UserSearchPage) []string {
+	names := []string{}
+	for _, result := range page.Results {
+		names = append(names, result.User.Name)
+	}
+	return names
+}
+
+// Test prefix matching, diacritics, ranking, highlights, pagination and index sync
+// against both the configured backend and the in-memory fallback
+func TestSearchUsers(t *testing.T) {
+	for _, backend := range searchBackends {
+		t.Run("backend="+backend, func(t *testing.T) {
+			setupTestDatabase(t)
+			cfg := testConfig()
+			cfg.SearchBackend = backend
+			router := newRouter(db, cfg)
+
+			people := []models.User{
+				{Name: "Ann Lee", Email: "ann.lee@acme.com"},
+				{Name: "Annika Ångström", Email: "a.angstrom@example.com"},
+				{Name: "Zoë Müller", Email: "zoe@acme.com"},
+				{Name: "Joanna Smith", Email: "joanna@example.com"},
+			}
+			for _, user := range people {
+				if rr := doJSON(t, router, "POST", "/users", user); rr.Code != http.StatusCreated {
+					t.Fatalf("create %s: got %v want %v", user.Name, rr.Code, http.StatusCreated)
+				}
+			}
+
+			page := searchUsers(t, router, "ann", "")
+			if names := resultNames(page); page.Total != 2 || len(names) != 2 || names[0] != "Ann Lee" || names[1] != "Annika Ångström" {
+				t.Errorf("Prefix search: got %v (total %d)", names, page.Total)
+			}
+			if hl := page.Results[0].Highlights; hl["name"] != "<mark>Ann</mark> Lee" || hl["email"] != "<mark>ann</mark>.lee@acme.com" {
+				t.Errorf("Unexpected highlights %v", hl)
+			}
+
+			cases := map[string][]string{
+				"alice":     {"Alice"}, // created before the index
+				"angstrom":  {"Annika Ångström"},
+				"ZOE":       {"Zoë Müller"},
+				"müller":    {"Zoë Müller"},
+				"ann acme":  {"Ann Lee"},
+				"anna":      {},
+				"zoe acme.": {"Zoë Müller"},
+			}
+			for q, expected := range cases {
+				if names := resultNames(searchUsers(t, router, q, "")); len(names) != len(expected) || (len(names) > 0 && names[0] != expected[0]) {
+					t.Errorf("Search %q: got %v want %v", q, names, expected)
+				}
+			}
+
+			page = searchUsers(t, router, "ann", "&limit=1&offset=1")
+			if names := resultNames(page); page.Total != 2 || len(names) != 1 || names[0] != "Annika Ångström" {
+				t.Errorf("Second page: got %v (total %d)", names, page.Total)
+			}
+
+			for _, q := range []string{"", "?!"} {
+				if rr := doJSON(t, router, "GET", "/users/search?q="+url.QueryEscape(q), nil); rr.Code != http.StatusBadRequest {
+					t.Errorf("Query %q: got %v want %v", q, rr.Code, http.StatusBadRequest)
+				}
+			}
+
+			// Updates and deletes are reflected in the results
+			doJSONWithToken(t, router, "PUT", "/users/4", models.User{Name: "Zoey Miller", Email: "zoe@acme.com"}, accessToken(t, cfg, 4, false))
+			doJSONWithToken(t, router, "DELETE", "/users/5", nil, accessToken(t, cfg, 5, false))
+			if names := resultNames(searchUsers(t, router, "muller", "")); len(names) != 0 {
+				t.Errorf("Renamed user still found: %v", names)
+			}
+			if names := resultNames(searchUsers(t, router, "miller", "")); len(names) != 1 {
+				t.Errorf("Renamed user not found: %v", names)
+			}
+			if names := resultNames(searchUsers(t, router, "joanna", "")); len(names) != 0 {
+				t.Errorf("Deleted user still found: %v", names)
+			}
+		})
+	}
+}
+
+// Test that names and emails are HTML-escaped in highlights
+func TestSearchHighlightsEscaped(t *testing.T) {
+	for _, backend := range searchBackends {
+		t.Run("backend="+backend, func(t *testing.T) {
+			setupTestDatabase(t)
+			cfg := testConfig()
+			cfg.SearchBackend = backend
+			router := newRouter(db, cfg)
+
+			user := models.User{Name: `Mallory <script>alert("x")</script>`, Email: "mallory&co@example.com"}
+			if rr := doJSON(t, router, "POST", "/users", user); rr.Code != http.StatusCreated {
+				t.Fatalf("Create user: got %v want %v", rr.Code, http.StatusCreated)
+			}
+
+			page := searchUsers(t, router, "mallory script", "")
+			if len(page.Results) != 1 {
+				t.Fatalf("Expected one result, got %v", resultNames(page))
+			}
+			hl := page.Results[0].Highlights
+			if want := `<mark>Mallory</mark> &lt;<mark>script</mark>&gt;alert(&#34;x&#34;)&lt;/<mark>script</mark>&gt;`; hl["name"] != want {
+				t.Errorf("Name highlight: got %q want %q", hl["name"], want)
+			}
+			if want := "<mark>mallory</mark>&amp;co@example.com"; hl["email"] != want {
+				t.Errorf("Email highlight: got %q want %q", hl["email"], want)
+			}
+		})
+	}
+}
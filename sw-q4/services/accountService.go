@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"myapp/mailer"
+	"myapp/models"
+	"myapp/repositories"
+	"net/url"
+	"time"
+)
+
+// Account Service: Business logic for email verification and password resets
+// Tokens are delivered by email, expire, and can be used only once
+
+var ErrEmailAlreadyVerified = errors.New("email address is already verified")
+
+type AccountConfig struct {
+	BaseURL          string        // Frontend URL used to build links in emails
+	VerificationTTL  time.Duration // Lifetime of email verification tokens
+	PasswordResetTTL time.Duration // Lifetime of password reset tokens
+}
+
+type AccountService struct {
+	userRepo    *repositories.UserRepository
+	tokenRepo   *repositories.UserTokenRepository
+	refreshRepo *repositories.RefreshTokenRepository
+	sessionRepo *repositories.SessionRepository
+	hasher      *PasswordHasher
+	mailer      mailer.Mailer
+	config      AccountConfig
+	clock       Clock
+}
+
+// Create new service instance with repository and mailer dependencies
+func NewAccountService(userRepo *repositories.UserRepository, tokenRepo *repositories.UserTokenRepository, refreshRepo *repositories.RefreshTokenRepository, sessionRepo *repositories.SessionRepository, hasher *PasswordHasher, mailer mailer.Mailer, config AccountConfig, clock Clock) *AccountService {
+	return &AccountService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		refreshRepo: refreshRepo,
+		sessionRepo: sessionRepo,
+		hasher:      hasher,
+		mailer:      mailer,
+		config:      config,
+		clock:       clock,
+	}
+}
+
+// Email a verification link to a user
+func (s *AccountService) SendVerification(orgID, userID int) error {
+	user, err := s.userRepo.GetUserByID(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issueToken(user.ID, models.TokenPurposeVerifyEmail, s.config.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?user=%d&token=%s", s.config.BaseURL, user.ID, url.QueryEscape(token))
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, link, s.config.VerificationTTL),
+	})
+}
+
+// Mark a user's email as verified using a token from the verification email
+func (s *AccountService) ConfirmVerification(userID int, token string) error {
+	// A token issued to another user does not match
+	orgID, err := s.tokenRepo.ConsumeForUser(userID, hashToken(token), models.TokenPurposeVerifyEmail, s.clock.Now())
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return s.userRepo.SetEmailVerified(orgID, userID, s.clock.Now())
+}
+
+// Email a password reset link if the address belongs to a user of the organization
+// Unknown addresses are ignored so the response does not reveal which emails exist
+func (s *AccountService) RequestPasswordReset(orgID int, email string) error {
+	user, err := s.userRepo.GetUserByEmail(orgID, email)
+	if err != nil || user.Status != models.StatusActive {
+		return nil
+	}
+
+	token, err := s.issueToken(user.ID, models.TokenPurposePasswordReset, s.config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.config.BaseURL, url.QueryEscape(token))
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.\n",
+			user.Name, link, s.config.PasswordResetTTL),
+	})
+}
+
+// Set a new password using a token from the reset email
+// Existing refresh tokens and sessions are revoked
+func (s *AccountService) ResetPassword(token, password string) error {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	userID, orgID, err := s.tokenRepo.Consume(hashToken(token), models.TokenPurposePasswordReset, now)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	user, err := s.userRepo.GetUserByID(orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePasswordHash(orgID, userID, hash, now); err != nil {
+		return err
+	}
+	if err := s.refreshRepo.RevokeAllForUser(userID, now); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.DeleteAllForUser(userID); err != nil {
+		return err
+	}
+
+	// Receiving the reset email proves control of the address
+	if user.EmailVerifiedAt == nil {
+		return s.userRepo.SetEmailVerified(orgID, userID, now)
+	}
+	return nil
+}
+
+// Generate and store a single-use token, returning its plain-text value
+func (s *AccountService) issueToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	now := s.clock.Now()
+	value := randomToken(32)
+	err := s.tokenRepo.Create(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(value),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"myapp/models"
+	"myapp/repositories"
+)
+
+// Audit Service: Records and lists security-relevant events
+
+type AuditService struct {
+	auditRepo *repositories.AuditRepository
+	clock     Clock
+}
+
+// Create new service instance with repository dependency
+func NewAuditService(auditRepo *repositories.AuditRepository, clock Clock) *AuditService {
+	return &AuditService{auditRepo: auditRepo, clock: clock}
+}
+
+// Append an event to an organization's log; actorID is nil for events not caused by a user
+func (s *AuditService) Record(orgID int, eventType string, actorID *int, subject, details string) error {
+	return s.auditRepo.Record(&models.AuditEvent{
+		OrgID:     orgID,
+		Type:      eventType,
+		ActorID:   actorID,
+		Subject:   subject,
+		Details:   details,
+		CreatedAt: s.clock.Now(),
+	})
+}
+
+// List an organization's most recent events, optionally filtered by type
+func (s *AuditService) List(orgID int, eventType string, limit int) ([]models.AuditEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return s.auditRepo.List(orgID, eventType, limit)
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"time"
+)
+
+// Auth Service: Business logic for logins and token lifecycle
+// Issues access tokens and rotates refresh tokens with reuse detection
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrWrongPassword      = errors.New("current password is incorrect")
+	ErrAccountInactive    = errors.New("account is not active")
+)
+
+// How long a user has to complete the second factor after their password
+const mfaChallengeTTL = 5 * time.Minute
+
+type AuthConfig struct {
+	Secret     []byte        // HMAC key for access tokens
+	AccessTTL  time.Duration // Access token lifetime
+	RefreshTTL time.Duration // Refresh token lifetime
+}
+
+type AuthService struct {
+	userRepo  *repositories.UserRepository
+	tokenRepo *repositories.RefreshTokenRepository
+	hasher    *PasswordHasher
+	signer    *TokenSigner
+	config    AuthConfig
+	clock     Clock
+
+	// Compared against when the email is unknown so failures take constant time
+	dummyHash string
+}
+
+// Create new service instance with repository dependencies
+func NewAuthService(userRepo *repositories.UserRepository, tokenRepo *repositories.RefreshTokenRepository, hasher *PasswordHasher, config AuthConfig, clock Clock) *AuthService {
+	dummyHash, _ := hasher.Hash(randomToken(16))
+	return &AuthService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		hasher:    hasher,
+		signer:    NewTokenSigner(config.Secret),
+		config:    config,
+		clock:     clock,
+		dummyHash: dummyHash,
+	}
+}
+
+// Check an email and password within an organization, returning the matching user
+func (s *AuthService) VerifyCredentials(orgID int, email, password string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByEmail(orgID, email)
+	if err != nil || user.PasswordHash == "" {
+		s.hasher.Verify(s.dummyHash, password)
+		return nil, ErrInvalidCredentials
+	}
+	if !s.hasher.Verify(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Only reveal the account state once the password is known to be correct
+	if user.Status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	// Upgrade hashes created with outdated parameters
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if hash, err := s.hasher.Hash(password); err == nil {
+			s.userRepo.UpdatePasswordHash(orgID, user.ID, hash, s.clock.Now())
+		}
+	}
+
+	return user, nil
+}
+
+// Issue a token pair starting a new refresh token family
+func (s *AuthService) IssueTokens(userID, orgID int, mfa bool) (*models.TokenPair, error) {
+	now := s.clock.Now()
+	value := randomToken(32)
+	token := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  randomToken(16),
+		TokenHash: hashToken(value),
+		ExpiresAt: now.Add(s.config.RefreshTTL),
+		CreatedAt: now,
+		MFA:       mfa,
+	}
+	if err := s.tokenRepo.Create(token); err != nil {
+		return nil, err
+	}
+	return s.tokenPair(userID, orgID, mfa, value, now)
+}
+
+// Exchange a refresh token for a new token pair
+// Presenting an already rotated token revokes the whole token family
+func (s *AuthService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	now := s.clock.Now()
+	old, err := s.tokenRepo.GetByHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if old.RevokedAt != nil {
+		s.tokenRepo.RevokeFamily(old.FamilyID, now)
+		return nil, ErrInvalidToken
+	}
+	if !now.Before(old.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	value := randomToken(32)
+	next := &models.RefreshToken{
+		UserID:    old.UserID,
+		FamilyID:  old.FamilyID,
+		TokenHash: hashToken(value),
+		ExpiresAt: now.Add(s.config.RefreshTTL),
+		CreatedAt: now,
+		MFA:       old.MFA,
+	}
+	rotated, err := s.tokenRepo.Rotate(old, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Lost a race with another refresh using the same token
+		s.tokenRepo.RevokeFamily(old.FamilyID, now)
+		return nil, ErrInvalidToken
+	}
+
+	return s.tokenPair(old.UserID, old.OrgID, old.MFA, value, now)
+}
+
+// Revoke the refresh token family that the given token belongs to
+func (s *AuthService) Logout(refreshToken string) error {
+	token, err := s.tokenRepo.GetByHash(hashToken(refreshToken))
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return s.tokenRepo.RevokeFamily(token.FamilyID, s.clock.Now())
+}
+
+// Change a user's password after checking the current one
+// Existing refresh tokens are revoked, so other devices must log in again
+func (s *AuthService) ChangePassword(orgID, userID int, current, password string) error {
+	user, err := s.userRepo.GetUserByID(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" || !s.hasher.Verify(user.PasswordHash, current) {
+		return ErrWrongPassword
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	if err := s.userRepo.UpdatePasswordHash(orgID, userID, hash, now); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeAllForUser(userID, now)
+}
+
+// Validate an access token and return its claims
+func (s *AuthService) ValidateAccessToken(accessToken string) (*Claims, error) {
+	return s.signer.Parse(accessToken, purposeAccess, s.clock.Now())
+}
+
+// Issue a short-lived token proving the password step of a login
+func (s *AuthService) IssueMFAChallenge(userID, orgID int) (string, error) {
+	now := s.clock.Now()
+	return s.signer.Sign(Claims{
+		Subject:   userID,
+		Org:       orgID,
+		Purpose:   purposeMFAChallenge,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+// Validate an MFA challenge token and return its claims
+func (s *AuthService) ValidateMFAChallenge(token string) (*Claims, error) {
+	return s.signer.Parse(token, purposeMFAChallenge, s.clock.Now())
+}
+
+func (s *AuthService) tokenPair(userID, orgID int, mfa bool, refreshToken string, now time.Time) (*models.TokenPair, error) {
+	accessToken, err := s.signer.Sign(Claims{
+		Subject:   userID,
+		Org:       orgID,
+		Purpose:   purposeAccess,
+		MFA:       mfa,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.config.AccessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.AccessTTL.Seconds()),
+	}, nil
+}
+
+// Generate a URL-safe random token of n bytes
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Hash an opaque token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,17 @@
+package services
+
+import "time"
+
+// Clock: Source of the current time for services
+// Tests substitute a fixed clock to exercise expiry and drift windows
+
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock reads the wall clock in UTC so stored timestamps compare consistently
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now().UTC()
+}
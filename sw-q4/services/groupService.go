@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"myapp/filter"
+	"myapp/models"
+	"myapp/repositories"
+	"strings"
+)
+
+// Group Service: Business logic for groups and team membership
+// Validates names and member roles before they reach the repository
+
+var ErrInvalidGroupRole = errors.New("member role must be \"member\" or \"owner\"")
+
+type GroupService struct {
+	groupRepo *repositories.GroupRepository
+	userRepo  *repositories.UserRepository
+	clock     Clock
+}
+
+// Create new service instance with repository dependencies
+func NewGroupService(groupRepo *repositories.GroupRepository, userRepo *repositories.UserRepository, clock Clock) *GroupService {
+	return &GroupService{groupRepo: groupRepo, userRepo: userRepo, clock: clock}
+}
+
+// Get all groups of an organization
+func (s *GroupService) List(orgID int) ([]models.Group, error) {
+	return s.groupRepo.List(orgID, nil)
+}
+
+// Get the groups of an organization matching a parsed filter expression
+func (s *GroupService) Find(orgID int, expr filter.Expr) ([]models.Group, error) {
+	return s.groupRepo.List(orgID, expr)
+}
+
+// Find a group by ID, including its members
+func (s *GroupService) Get(orgID, id int) (*models.Group, error) {
+	group, err := s.groupRepo.GetByID(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if group.Members, err = s.groupRepo.ListMembers(id); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Create a new group in group.OrgID
+func (s *GroupService) Create(group *models.Group) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return ErrNameRequired
+	}
+	group.CreatedAt = s.clock.Now()
+	return s.groupRepo.Create(group)
+}
+
+// Rename a group or change its description
+func (s *GroupService) Update(group *models.Group) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return ErrNameRequired
+	}
+	return s.groupRepo.Update(group)
+}
+
+// Create a group, or rename an existing one, with exactly the given members in one write
+// Every member must be a user of the group's organization; existing members keep their roles
+func (s *GroupService) Save(group *models.Group, userIDs []int) (*models.Group, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return nil, ErrNameRequired
+	}
+	now := s.clock.Now()
+	if group.ID == 0 {
+		group.CreatedAt = now
+	}
+	if err := s.groupRepo.Save(group, userIDs, now); err != nil {
+		return nil, err
+	}
+	return s.Get(group.OrgID, group.ID)
+}
+
+// Delete a group and its memberships
+func (s *GroupService) Delete(orgID, id int) error {
+	return s.groupRepo.Delete(orgID, id)
+}
+
+// Add a user to a group; an existing member's role is updated instead
+// The user must belong to the same organization as the group
+func (s *GroupService) AddMember(orgID, groupID, userID int, role string) (*models.Group, error) {
+	if role == "" {
+		role = models.GroupRoleMember
+	}
+	if role != models.GroupRoleMember && role != models.GroupRoleOwner {
+		return nil, ErrInvalidGroupRole
+	}
+	if _, err := s.groupRepo.GetByID(orgID, groupID); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetUserByID(orgID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.AddMember(groupID, userID, role, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	return s.Get(orgID, groupID)
+}
+
+// Remove a user from a group
+func (s *GroupService) RemoveMember(orgID, groupID, userID int) error {
+	if _, err := s.groupRepo.GetByID(orgID, groupID); err != nil {
+		return err
+	}
+	return s.groupRepo.RemoveMember(groupID, userID)
+}
+
+// List the groups a user belongs to
+func (s *GroupService) ListForUser(orgID, userID int) ([]models.UserGroup, error) {
+	if _, err := s.userRepo.GetUserByID(orgID, userID); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.ListForUser(userID)
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"myapp/mailer"
+	"myapp/models"
+	"myapp/repositories"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Invitation Service: Business logic for onboarding users by invitation
+// Invitees start as pending users and become active when they accept
+
+var (
+	ErrInvitationClosed = errors.New("invitation is no longer pending")
+	ErrNameRequired     = errors.New("name is required")
+	ErrEmailRequired    = errors.New("email is required")
+)
+
+type InvitationConfig struct {
+	BaseURL string        // Frontend URL used to build the accept link
+	TTL     time.Duration // Lifetime of invite tokens
+}
+
+type InvitationService struct {
+	invitationRepo *repositories.InvitationRepository
+	userRepo       *repositories.UserRepository
+	attributes     *UserAttributeService
+	hasher         *PasswordHasher
+	mailer         mailer.Mailer
+	outbox         *OutboxRelay
+	config         InvitationConfig
+	clock          Clock
+}
+
+// Create new service instance with repository and mailer dependencies
+func NewInvitationService(invitationRepo *repositories.InvitationRepository, userRepo *repositories.UserRepository, attributes *UserAttributeService, hasher *PasswordHasher, mailer mailer.Mailer, outbox *OutboxRelay, config InvitationConfig, clock Clock) *InvitationService {
+	return &InvitationService{
+		invitationRepo: invitationRepo,
+		userRepo:       userRepo,
+		attributes:     attributes,
+		hasher:         hasher,
+		mailer:         mailer,
+		outbox:         outbox,
+		config:         config,
+		clock:          clock,
+	}
+}
+
+// Create a pending user in the organization with the given attributes and email them an invite token
+func (s *InvitationService) Invite(orgID int, email, role string, attributes map[string]any, invitedBy int) (*models.Invitation, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, ErrEmailRequired
+	}
+	if role == "" {
+		role = models.RoleUser
+	}
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if err := s.attributes.Validate(attributes); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	token := randomToken(32)
+	inv := &models.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: &invitedBy,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.config.TTL),
+		CreatedAt: now,
+	}
+	user := &models.User{Email: email, Role: role, Status: models.StatusPending, Attributes: attributes}
+	if err := s.invitationRepo.Create(inv, user); err != nil {
+		return nil, err
+	}
+	s.outbox.Notify()
+	inv.Status = inv.StatusAt(now)
+
+	return inv, s.sendInvite(inv, token)
+}
+
+// Accept an invitation, setting the invitee's name and password
+// The invitee's attributes are checked against the current schema, which may have changed since the invite
+func (s *InvitationService) Accept(token, name, password string) (*models.User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if err := s.checkAttributes(hashToken(token)); err != nil {
+		return nil, err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.invitationRepo.Accept(hashToken(token), s.clock.Now(), name, hash)
+	if err != nil {
+		if errors.Is(err, repositories.ErrTokenInvalid) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	s.outbox.Notify()
+
+	return s.userRepo.GetUserByID(inv.OrgID, *inv.UserID)
+}
+
+// Validate the attributes of an open invitation's pending user against the current schema
+// Unknown and closed tokens are left for the repository to reject
+func (s *InvitationService) checkAttributes(tokenHash string) error {
+	inv, err := s.invitationRepo.GetByTokenHash(tokenHash)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+	if inv.UserID == nil || inv.StatusAt(s.clock.Now()) != models.InvitationPending {
+		return nil
+	}
+	user, err := s.userRepo.GetUserByID(inv.OrgID, *inv.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+	return s.attributes.Validate(user.Attributes)
+}
+
+// List an organization's invitations, optionally only those in the given state
+func (s *InvitationService) List(orgID int, status string) ([]models.Invitation, error) {
+	invitations, err := s.invitationRepo.List(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	filtered := []models.Invitation{}
+	for _, inv := range invitations {
+		inv.Status = inv.StatusAt(now)
+		if status == "" || inv.Status == status {
+			filtered = append(filtered, inv)
+		}
+	}
+	return filtered, nil
+}
+
+// Send a fresh invite token, restarting the expiry period
+// Expired invitations can be resent; accepted and revoked ones cannot
+func (s *InvitationService) Resend(orgID, id int) (*models.Invitation, error) {
+	inv, err := s.invitationRepo.GetByID(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return nil, ErrInvitationClosed
+	}
+
+	now := s.clock.Now()
+	token := randomToken(32)
+	inv.TokenHash = hashToken(token)
+	inv.ExpiresAt = now.Add(s.config.TTL)
+	if err := s.invitationRepo.Renew(inv.ID, inv.TokenHash, inv.ExpiresAt); err != nil {
+		return nil, err
+	}
+	inv.Status = inv.StatusAt(now)
+
+	return inv, s.sendInvite(inv, token)
+}
+
+// Revoke an invitation and remove its pending user
+func (s *InvitationService) Revoke(orgID, id int) error {
+	inv, err := s.invitationRepo.GetByID(orgID, id)
+	if err != nil {
+		return err
+	}
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return ErrInvitationClosed
+	}
+	if err := s.invitationRepo.Revoke(id, s.clock.Now()); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+func (s *InvitationService) sendInvite(inv *models.Invitation, token string) error {
+	link := fmt.Sprintf("%s/accept-invitation?token=%s", s.config.BaseURL, url.QueryEscape(token))
+	return s.mailer.Send(mailer.Message{
+		To:      inv.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hello,\n\nYou have been invited to join. Open the link below to choose your name and password:\n\n%s\n\nThe invitation expires on %s.\n",
+			link, inv.ExpiresAt.Format(time.RFC1123)),
+	})
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"myapp/models"
+	"myapp/repositories"
+	"strings"
+	"time"
+)
+
+// Lockout Service: Throttles failed logins per account and per client IP
+// Repeated failures lock the key for exponentially growing periods
+
+var ErrLocked = errors.New("too many failed login attempts")
+
+// LockedError reports when a locked account or client may retry
+type LockedError struct {
+	Until      time.Time     // End of the lockout
+	RetryAfter time.Duration // Time remaining until Until
+}
+
+func (e *LockedError) Error() string {
+	return ErrLocked.Error()
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Persistence for failure counters; implemented by SQLite and in-memory stores
+type AttemptStore interface {
+	Get(key string) (*models.LoginAttempt, error)
+	RecordFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+type LockoutConfig struct {
+	AccountThreshold int           // Failures per account before locking
+	IPThreshold      int           // Failures per client IP before locking
+	Window           time.Duration // Failures older than this are forgotten
+	BaseLockout      time.Duration // First lockout period, doubled on each further failure
+	MaxLockout       time.Duration // Upper bound for a single lockout period
+}
+
+type LockoutService struct {
+	store        AttemptStore
+	auditService *AuditService
+	userRepo     *repositories.UserRepository
+	config       LockoutConfig
+	clock        Clock
+}
+
+// Create new service instance with store and repository dependencies
+func NewLockoutService(store AttemptStore, auditService *AuditService, userRepo *repositories.UserRepository, config LockoutConfig, clock Clock) *LockoutService {
+	return &LockoutService{store: store, auditService: auditService, userRepo: userRepo, config: config, clock: clock}
+}
+
+// Return a *LockedError if either the account or the client is locked
+func (s *LockoutService) Check(orgID int, email, ip string) error {
+	now := s.clock.Now()
+	var until time.Time
+	for _, key := range []string{accountKey(orgID, email), ipKey(ip)} {
+		attempt, err := s.store.Get(key)
+		if err != nil {
+			return err
+		}
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) && attempt.LockedUntil.After(until) {
+			until = *attempt.LockedUntil
+		}
+	}
+	if !until.IsZero() {
+		return &LockedError{Until: until, RetryAfter: until.Sub(now)}
+	}
+	return nil
+}
+
+// Count a failed password or MFA attempt against both the account and the client
+// Lockout events are logged to the organization the login was attempted in
+func (s *LockoutService) RecordFailure(orgID int, email, ip string) error {
+	if err := s.recordFailure(orgID, accountKey(orgID, email), s.config.AccountThreshold, models.AuditAccountLocked, normalizeEmail(email)); err != nil {
+		return err
+	}
+	return s.recordFailure(orgID, ipKey(ip), s.config.IPThreshold, models.AuditIPLocked, ip)
+}
+
+// Clear the account counter after a completed login
+func (s *LockoutService) RecordSuccess(orgID int, email string) error {
+	return s.store.Reset(accountKey(orgID, email))
+}
+
+// Lift the lock on a user's account (admin action)
+func (s *LockoutService) Unlock(orgID, userID, actorID int) error {
+	user, err := s.userRepo.GetUserByID(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Reset(accountKey(orgID, user.Email)); err != nil {
+		return err
+	}
+	return s.auditService.Record(orgID, models.AuditAccountUnlocked, &actorID, normalizeEmail(user.Email), "")
+}
+
+func (s *LockoutService) recordFailure(orgID int, key string, threshold int, auditType, subject string) error {
+	now := s.clock.Now()
+	attempt, err := s.store.RecordFailure(key, now, s.config.Window)
+	if err != nil {
+		return err
+	}
+	if attempt.Failures < threshold {
+		return nil
+	}
+
+	// Double the lockout for every failure past the threshold
+	lockout := s.config.BaseLockout
+	for i := threshold; i < attempt.Failures && lockout < s.config.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > s.config.MaxLockout {
+		lockout = s.config.MaxLockout
+	}
+	until := now.Add(lockout)
+	if err := s.store.Lock(key, until); err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("%d failed attempts, locked until %s", attempt.Failures, until.Format(time.RFC3339))
+	return s.auditService.Record(orgID, auditType, nil, subject, details)
+}
+
+// Emails are only unique within an organization, so account keys include it
+func accountKey(orgID int, email string) string {
+	return fmt.Sprintf("account:%d:%s", orgID, normalizeEmail(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
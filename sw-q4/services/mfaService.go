@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"strings"
+)
+
+// MFA Service: Business logic for TOTP enrollment and verification
+// Recovery codes are single-use and only their hashes are stored
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("multi-factor authentication is not enrolled")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+)
+
+const recoveryCodeCount = 10
+
+type MFAService struct {
+	mfaRepo  *repositories.MFARepository
+	userRepo *repositories.UserRepository
+	issuer   string
+	clock    Clock
+}
+
+// Create new service instance with repository dependencies
+func NewMFAService(mfaRepo *repositories.MFARepository, userRepo *repositories.UserRepository, issuer string, clock Clock) *MFAService {
+	return &MFAService{mfaRepo: mfaRepo, userRepo: userRepo, issuer: issuer, clock: clock}
+}
+
+// Report whether a user must present a second factor at login
+func (s *MFAService) IsEnabled(userID int) bool {
+	mfa, err := s.mfaRepo.Get(userID)
+	return err == nil && mfa.EnabledAt != nil
+}
+
+// Generate a new secret for a user who has not yet enabled MFA
+func (s *MFAService) Enroll(orgID, userID int) (*models.MFAEnrollment, error) {
+	if s.IsEnabled(userID) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	user, err := s.userRepo.GetUserByID(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := generateTOTPSecret()
+	if err := s.mfaRepo.SavePending(userID, secret, s.clock.Now()); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Activate a pending enrollment with a code from the authenticator app
+// Returns the plain-text recovery codes, which are shown only once
+func (s *MFAService) Confirm(userID int, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.Get(userID)
+	if err != nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(mfa.Secret, code, s.clock.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = generateRecoveryCode()
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := s.mfaRepo.Enable(userID, step, s.clock.Now(), hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Check a TOTP code or an unused recovery code during login
+func (s *MFAService) Verify(userID int, code string) error {
+	mfa, err := s.mfaRepo.Get(userID)
+	if err != nil || mfa.EnabledAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := matchTOTP(mfa.Secret, code, s.clock.Now()); ok {
+		// Each code is accepted once; older steps are rejected as replays
+		advanced, err := s.mfaRepo.AdvanceStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)), s.clock.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Remove a user's enrollment so they can enroll again
+func (s *MFAService) Reset(orgID, userID int) error {
+	if _, err := s.userRepo.GetUserByID(orgID, userID); err != nil {
+		return err
+	}
+	return s.mfaRepo.Delete(userID)
+}
+
+// Generate a recovery code formatted as two groups of five characters
+func generateRecoveryCode() string {
+	code := strings.ToLower(generateTOTPSecret()[:10])
+	return code[:5] + "-" + code[5:]
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"regexp"
+	"strings"
+)
+
+// Organization Service: Business logic for tenants of the deployment
+
+var ErrInvalidSlug = errors.New("slug must be lowercase letters, digits and dashes")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type OrganizationService struct {
+	orgRepo *repositories.OrganizationRepository
+	clock   Clock
+}
+
+// Create new service instance with repository dependency
+func NewOrganizationService(orgRepo *repositories.OrganizationRepository, clock Clock) *OrganizationService {
+	return &OrganizationService{orgRepo: orgRepo, clock: clock}
+}
+
+// Get all organizations
+func (s *OrganizationService) List() ([]models.Organization, error) {
+	return s.orgRepo.List()
+}
+
+// Find an organization by ID
+func (s *OrganizationService) Get(id int) (*models.Organization, error) {
+	return s.orgRepo.GetByID(id)
+}
+
+// Create a new organization
+func (s *OrganizationService) Create(org *models.Organization) error {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return ErrNameRequired
+	}
+	if !slugPattern.MatchString(org.Slug) {
+		return ErrInvalidSlug
+	}
+	org.CreatedAt = s.clock.Now()
+	return s.orgRepo.Create(org)
+}
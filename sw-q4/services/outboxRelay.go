@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/publisher"
+	"myapp/repositories"
+	"sync"
+	"time"
+)
+
+// Outbox Relay: Publishes user events recorded in the outbox, in order, to every publisher
+// Each publisher has its own cursor, the last event it accepted, so delivery is at least once;
+// a failing publisher stops at its event and is retried every PollInterval while the others carry on.
+// An event is marked published once every publisher has it
+
+const outboxBatchSize = 100
+
+type OutboxConfig struct {
+	PollInterval time.Duration // How often Run looks for events and retries a failed publisher
+	Retention    time.Duration // How long published events are kept before they are deleted
+}
+
+// A publisher and the name its cursor is stored under
+type OutboxPublisher struct {
+	Name string
+	publisher.Publisher
+}
+
+type OutboxRelay struct {
+	mu         sync.Mutex
+	repo       *repositories.OutboxRepository
+	publishers []OutboxPublisher
+	config     OutboxConfig
+	clock      Clock
+	wake       chan struct{}
+}
+
+// Create new relay publishing to the given publishers
+func NewOutboxRelay(repo *repositories.OutboxRepository, publishers []OutboxPublisher, config OutboxConfig, clock Clock) *OutboxRelay {
+	return &OutboxRelay{
+		repo:       repo,
+		publishers: publishers,
+		config:     config,
+		clock:      clock,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Wake Run after a write so the event is published right away; a pending wake-up already covers this one
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Publish outbox events until ctx is cancelled, deleting published events past their retention
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Outbox relay failed:", err)
+		}
+		if _, err := r.repo.DeletePublished(r.clock.Now().Add(-r.config.Retention)); err != nil {
+			log.Println("Outbox cleanup failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Bring every publisher up to date and return how many events became published, reached by all of them
+// Errors of failing publishers are joined; the others are still relayed to
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	var through int64 = -1
+	for _, p := range r.publishers {
+		cursor, err := r.relayTo(ctx, p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if through < 0 || cursor < through {
+			through = cursor
+		}
+	}
+	if through <= 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	published, err := r.repo.MarkPublished(through, r.clock.Now())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return int(published), errors.Join(errs...)
+}
+
+// Publish the events after a publisher's cursor in order, returning where its cursor ends up
+func (r *OutboxRelay) relayTo(ctx context.Context, p OutboxPublisher) (int64, error) {
+	cursor, err := r.repo.Cursor(p.Name)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		events, err := r.repo.After(cursor, outboxBatchSize)
+		if err != nil {
+			return cursor, err
+		}
+		start := cursor
+		for _, event := range events {
+			if err = p.Publish(ctx, event); err != nil {
+				err = fmt.Errorf("publish event %s to %s: %w", event.DedupID, p.Name, err)
+				break
+			}
+			cursor = event.ID
+		}
+		if cursor != start {
+			if saveErr := r.repo.SaveCursor(p.Name, cursor, r.clock.Now()); saveErr != nil {
+				return cursor, saveErr
+			}
+		}
+		if err != nil || len(events) < outboxBatchSize {
+			return cursor, err
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password Hasher: Hashes and verifies user passwords with bcrypt
+// Hashes created with a lower cost are flagged for upgrade on next login
+
+var ErrInvalidPassword = errors.New("password must be between 8 and 72 bytes")
+
+type PasswordHasher struct {
+	cost int
+}
+
+// Create new hasher; a zero cost selects bcrypt.DefaultCost
+func NewPasswordHasher(cost int) *PasswordHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &PasswordHasher{cost: cost}
+}
+
+// Hash a plain-text password
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if len(password) < 8 || len(password) > 72 {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Check a plain-text password against a stored hash
+func (h *PasswordHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Report whether a hash was created with outdated parameters
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"myapp/models"
+	"myapp/repositories"
+	"time"
+)
+
+// Session Service: Business logic for server-side cookie sessions
+// Sessions expire after a period of inactivity or at an absolute deadline
+
+type SessionConfig struct {
+	IdleTimeout     time.Duration // Maximum time between requests
+	AbsoluteTimeout time.Duration // Maximum session lifetime regardless of activity
+}
+
+type SessionService struct {
+	sessionRepo *repositories.SessionRepository
+	config      SessionConfig
+	clock       Clock
+}
+
+// Create new service instance with repository dependency
+func NewSessionService(sessionRepo *repositories.SessionRepository, config SessionConfig, clock Clock) *SessionService {
+	return &SessionService{sessionRepo: sessionRepo, config: config, clock: clock}
+}
+
+// Start a session for a user, returning the cookie value and the stored session
+func (s *SessionService) Create(userID int, mfa bool) (string, *models.Session, error) {
+	now := s.clock.Now()
+	value := randomToken(32)
+	session := &models.Session{
+		UserID:     userID,
+		TokenHash:  hashToken(value),
+		CSRFToken:  randomToken(32),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.config.AbsoluteTimeout),
+		MFA:        mfa,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return "", nil, err
+	}
+
+	// Opportunistically clean up sessions nobody will present again
+	s.sessionRepo.DeleteExpired(now)
+
+	return value, session, nil
+}
+
+// Look up a session by cookie value and extend its idle deadline
+func (s *SessionService) Validate(value string) (*models.Session, error) {
+	session, err := s.sessionRepo.GetByHash(hashToken(value))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := s.clock.Now()
+	if !now.Before(session.ExpiresAt) || now.Sub(session.LastSeenAt) > s.config.IdleTimeout {
+		s.sessionRepo.Delete(session.ID)
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.sessionRepo.Touch(session.ID, now); err != nil {
+		return nil, err
+	}
+	session.LastSeenAt = now
+	return session, nil
+}
+
+// Time at which the session expires if left idle
+func (s *SessionService) IdleDeadline(session *models.Session) time.Time {
+	deadline := session.LastSeenAt.Add(s.config.IdleTimeout)
+	if deadline.After(session.ExpiresAt) {
+		return session.ExpiresAt
+	}
+	return deadline
+}
+
+// End a session
+func (s *SessionService) Destroy(session *models.Session) error {
+	return s.sessionRepo.Delete(session.ID)
+}
+
+// End every session belonging to a user
+func (s *SessionService) DestroyAllForUser(userID int) error {
+	return s.sessionRepo.DeleteAllForUser(userID)
+}
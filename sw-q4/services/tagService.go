@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+	"regexp"
+	"strings"
+)
+
+// Tag Service: Business logic for labelling users with tags
+// Tag names are normalized to lowercase before they are stored or queried
+
+var (
+	ErrInvalidTag      = errors.New("tags must be lowercase letters, digits, dashes and underscores")
+	ErrInvalidTagsMode = errors.New("tags_mode must be \"any\" or \"all\"")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+type TagService struct {
+	tagRepo  *repositories.TagRepository
+	userRepo *repositories.UserRepository
+	outbox   *OutboxRelay
+	clock    Clock
+}
+
+// Create new service instance with repository dependencies
+func NewTagService(tagRepo *repositories.TagRepository, userRepo *repositories.UserRepository, outbox *OutboxRelay, clock Clock) *TagService {
+	return &TagService{tagRepo: tagRepo, userRepo: userRepo, outbox: outbox, clock: clock}
+}
+
+// Get an organization's tags with usage counts
+func (s *TagService) List(orgID int) ([]models.Tag, error) {
+	return s.tagRepo.List(orgID)
+}
+
+// Add tags to a user and return the updated user
+func (s *TagService) AddToUser(orgID, userID int, names []string) (*models.User, error) {
+	tags, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetUserByID(orgID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.tagRepo.AddToUser(orgID, userID, tags, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	s.outbox.Notify()
+	return s.userRepo.GetUserByID(orgID, userID)
+}
+
+// Remove a tag from a user
+func (s *TagService) RemoveFromUser(orgID, userID int, name string) error {
+	if _, err := s.userRepo.GetUserByID(orgID, userID); err != nil {
+		return err
+	}
+	if err := s.tagRepo.RemoveFromUser(orgID, userID, strings.ToLower(strings.TrimSpace(name)), s.clock.Now()); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// Lowercase, validate and de-duplicate tag names
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !tagPattern.MatchString(name) {
+			return nil, ErrInvalidTag
+		}
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags, nil
+}
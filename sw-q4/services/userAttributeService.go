@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"myapp/models"
+	"myapp/repositories"
+	"regexp"
+	"strconv"
+)
+
+// User Attribute Service: Manages the custom attribute schema and validates values against it
+// The schema is shared by every organization in the deployment
+
+var (
+	ErrInvalidAttributeDefinition = errors.New("invalid attribute definition")
+	ErrInvalidAttribute           = errors.New("invalid attribute")
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+type UserAttributeService struct {
+	attributeRepo *repositories.UserAttributeRepository
+}
+
+// Create new service instance with repository dependency
+func NewUserAttributeService(attributeRepo *repositories.UserAttributeRepository) *UserAttributeService {
+	return &UserAttributeService{attributeRepo: attributeRepo}
+}
+
+// Get the attribute schema
+func (s *UserAttributeService) List() ([]models.AttributeDefinition, error) {
+	return s.attributeRepo.List()
+}
+
+// Create or replace an attribute definition
+func (s *UserAttributeService) Save(def *models.AttributeDefinition) error {
+	if !attributeNamePattern.MatchString(def.Name) {
+		return fmt.Errorf("%w: name must be lowercase letters, digits and underscores", ErrInvalidAttributeDefinition)
+	}
+	switch def.Type {
+	case models.AttributeString:
+		if def.Pattern != "" {
+			if _, err := compileAttributePattern(def.Pattern); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidAttributeDefinition, err)
+			}
+		}
+	case models.AttributeNumber, models.AttributeBoolean:
+		if len(def.Enum) > 0 || def.Pattern != "" {
+			return fmt.Errorf("%w: enum and pattern only apply to string attributes", ErrInvalidAttributeDefinition)
+		}
+	default:
+		return fmt.Errorf("%w: type must be string, number or boolean", ErrInvalidAttributeDefinition)
+	}
+	return s.attributeRepo.Save(def)
+}
+
+// Remove an attribute definition
+func (s *UserAttributeService) Delete(name string) error {
+	return s.attributeRepo.Delete(name)
+}
+
+// Check attribute values against the schema
+func (s *UserAttributeService) Validate(attributes map[string]any) error {
+	defs, err := s.definitions()
+	if err != nil {
+		return err
+	}
+
+	for name, value := range attributes {
+		def, ok := defs[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown attribute %q", ErrInvalidAttribute, name)
+		}
+		if err := validateAttribute(def, value); err != nil {
+			return err
+		}
+	}
+	for name, def := range defs {
+		if _, ok := attributes[name]; def.Required && !ok {
+			return fmt.Errorf("%w: %q is required", ErrInvalidAttribute, name)
+		}
+	}
+	return nil
+}
+
+// Convert query string filter values to the types of their attributes
+func (s *UserAttributeService) ParseFilter(raw map[string]any) (map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	defs, err := s.definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make(map[string]any, len(raw))
+	for name, value := range raw {
+		def, ok := defs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown attribute %q", ErrInvalidAttribute, name)
+		}
+		text := fmt.Sprint(value)
+		switch def.Type {
+		case models.AttributeNumber:
+			n, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q must be a number", ErrInvalidAttribute, name)
+			}
+			parsed[name] = n
+		case models.AttributeBoolean:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q must be true or false", ErrInvalidAttribute, name)
+			}
+			parsed[name] = b
+		default:
+			parsed[name] = text
+		}
+	}
+	return parsed, nil
+}
+
+func (s *UserAttributeService) definitions() (map[string]models.AttributeDefinition, error) {
+	list, err := s.attributeRepo.List()
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]models.AttributeDefinition, len(list))
+	for _, def := range list {
+		defs[def.Name] = def
+	}
+	return defs, nil
+}
+
+func validateAttribute(def models.AttributeDefinition, value any) error {
+	switch def.Type {
+	case models.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: %q must be a number", ErrInvalidAttribute, def.Name)
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: %q must be true or false", ErrInvalidAttribute, def.Name)
+		}
+	case models.AttributeString:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %q must be a string", ErrInvalidAttribute, def.Name)
+		}
+		if len(def.Enum) > 0 && !containsString(def.Enum, text) {
+			return fmt.Errorf("%w: %q must be one of %v", ErrInvalidAttribute, def.Name, def.Enum)
+		}
+		if def.Pattern != "" {
+			re, err := compileAttributePattern(def.Pattern)
+			if err != nil {
+				return err
+			}
+			if !re.MatchString(text) {
+				return fmt.Errorf("%w: %q does not match %s", ErrInvalidAttribute, def.Name, def.Pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Patterns must match the whole value, not just part of it
+func compileAttributePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
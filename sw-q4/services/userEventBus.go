@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"myapp/models"
+	"sync"
+)
+
+// User Event Bus: Fans out user changes to in-process subscribers such as the change feed
+// Recent events are kept in a bounded buffer so reconnecting subscribers can resume;
+// publishing never blocks, and a subscriber that falls behind is disconnected
+
+var (
+	ErrSubscriberTooSlow = errors.New("subscriber fell too far behind")
+	ErrEventBusClosed    = errors.New("event bus closed")
+)
+
+const (
+	DefaultEventReplaySize = 1000 // Events kept for resuming subscribers
+	subscriberBufferSize   = 1024 // Events queued per subscriber before it is dropped; well above the WebSocket ack window
+)
+
+type UserEventBus struct {
+	mu          sync.Mutex
+	clock       Clock
+	lastID      int64
+	replay      []models.UserEvent // Ring buffer of the most recent events
+	head        int                // Index of the oldest event once replay is full
+	subscribers map[*UserSubscription]struct{}
+	closed      bool
+}
+
+// A live subscription to one organization's events
+// C is closed when the subscription is closed, falls too far behind or the bus shuts down
+type UserSubscription struct {
+	C     <-chan models.UserEvent
+	ch    chan models.UserEvent
+	orgID int
+	bus   *UserEventBus
+	err   error
+}
+
+// Create a bus keeping the last replaySize events
+// Event IDs start from the current time in microseconds so they keep increasing across restarts
+func NewUserEventBus(replaySize int, clock Clock) *UserEventBus {
+	return &UserEventBus{
+		clock:       clock,
+		lastID:      clock.Now().UnixMicro(),
+		replay:      make([]models.UserEvent, 0, replaySize),
+		subscribers: make(map[*UserSubscription]struct{}),
+	}
+}
+
+// Assign the event its feed ID, and a timestamp if it has none, buffer it and deliver it to subscribers of its organization
+// Returns the event as published
+func (b *UserEventBus) Publish(event models.UserEvent) models.UserEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = b.clock.Now()
+	}
+	if len(b.replay) < cap(b.replay) {
+		b.replay = append(b.replay, event)
+	} else if cap(b.replay) > 0 {
+		b.replay[b.head] = event
+		b.head = (b.head + 1) % cap(b.replay)
+	}
+
+	for sub := range b.subscribers {
+		if sub.orgID != event.OrgID {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Too slow to keep up; the subscriber can resume from its last event
+			b.remove(sub, ErrSubscriberTooSlow)
+		}
+	}
+	return event
+}
+
+// Subscribe to an organization's events published after lastID, or only new events when lastID is 0
+// Returns the buffered events to replay before reading from the subscription;
+// complete is false when events after lastID are no longer buffered
+func (b *UserEventBus) Subscribe(orgID int, lastID int64) (replay []models.UserEvent, complete bool, sub *UserSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID > 0 {
+		oldest := b.lastID + 1
+		if len(b.replay) > 0 {
+			oldest = b.replay[b.head].ID
+		}
+		complete = lastID+1 >= oldest && lastID <= b.lastID
+		for i := range b.replay {
+			event := b.replay[(b.head+i)%len(b.replay)]
+			if event.ID > lastID && event.OrgID == orgID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan models.UserEvent, subscriberBufferSize)
+	sub = &UserSubscription{C: ch, ch: ch, orgID: orgID, bus: b}
+	if b.closed {
+		sub.err = ErrEventBusClosed
+		close(ch)
+		return replay, complete, sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return replay, complete, sub
+}
+
+// End every subscription with ErrEventBusClosed and refuse new ones, for server shutdown
+func (b *UserEventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub, ErrEventBusClosed)
+	}
+}
+
+// Stop receiving events and close C
+func (s *UserSubscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s, nil)
+}
+
+// Why C was closed: ErrSubscriberTooSlow, ErrEventBusClosed, or nil after Close
+// Only valid once C is closed
+func (s *UserSubscription) Err() error {
+	return s.err
+}
+
+// Must be called with b.mu held
+func (b *UserEventBus) remove(sub *UserSubscription, err error) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		sub.err = err
+		close(sub.ch)
+	}
+}
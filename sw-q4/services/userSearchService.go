@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"myapp/models"
+	"myapp/repositories"
+)
+
+// User Search Service: Business logic for full-text user search
+// Queries are split into words; results must contain every word as a prefix
+
+var ErrEmptySearchQuery = errors.New("search query must contain at least one letter or digit")
+
+// Full-text index over users; implemented by the FTS5 and in-memory searches
+type UserSearchIndex interface {
+	Search(orgID int, terms []string, limit, offset int) (*models.UserSearchPage, error)
+}
+
+type UserSearchService struct {
+	index UserSearchIndex
+}
+
+// Create new service instance with the selected search index
+func NewUserSearchService(index UserSearchIndex) *UserSearchService {
+	return &UserSearchService{index: index}
+}
+
+// Search an organization's users by name and email, one page at a time
+func (s *UserSearchService) Search(orgID int, q string, limit, offset int) (*models.UserSearchPage, error) {
+	terms := repositories.SearchTerms(q)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.index.Search(orgID, terms, limit, offset)
+}
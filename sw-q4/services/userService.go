@@ -1,43 +1,316 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"myapp/models"
 	"myapp/repositories"
+	"slices"
 )
 
 // User Service: Business logic layer for user operations
 // Handles communication between handlers and repository
 
+var (
+	ErrInvalidRole       = errors.New("role must be \"user\" or \"admin\"")
+	ErrInvalidStatus     = errors.New("status must be pending, active, suspended or deactivated")
+	ErrInvalidTransition = errors.New("status transition not allowed")
+	ErrUnknownField      = errors.New("unknown field")
+)
+
+// Allowed status transitions: current status -> reachable statuses
+var statusTransitions = map[string][]string{
+	models.StatusPending:     {models.StatusActive, models.StatusDeactivated},
+	models.StatusActive:      {models.StatusSuspended, models.StatusDeactivated},
+	models.StatusSuspended:   {models.StatusActive, models.StatusDeactivated},
+	models.StatusDeactivated: {models.StatusActive},
+}
+
+// Audit event recorded when a user enters each status
+var statusAuditEvents = map[string]string{
+	models.StatusActive:      models.AuditUserActivated,
+	models.StatusSuspended:   models.AuditUserSuspended,
+	models.StatusDeactivated: models.AuditUserDeactivated,
+}
+
 type UserService struct {
-	userRepo *repositories.UserRepository
+	userRepo     *repositories.UserRepository
+	refreshRepo  *repositories.RefreshTokenRepository
+	sessionRepo  *repositories.SessionRepository
+	hasher       *PasswordHasher
+	auditService *AuditService
+	attributes   *UserAttributeService
+	outbox       *OutboxRelay
+	clock        Clock
 }
 
 // Create new service instance with repository dependency
-func NewUserService(userRepo *repositories.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(userRepo *repositories.UserRepository, refreshRepo *repositories.RefreshTokenRepository, sessionRepo *repositories.SessionRepository, hasher *PasswordHasher, auditService *AuditService, attributes *UserAttributeService, outbox *OutboxRelay, clock Clock) *UserService {
+	return &UserService{
+		userRepo:     userRepo,
+		refreshRepo:  refreshRepo,
+		sessionRepo:  sessionRepo,
+		hasher:       hasher,
+		auditService: auditService,
+		attributes:   attributes,
+		outbox:       outbox,
+		clock:        clock,
+	}
+}
+
+// Get all users of an organization matching the filter from repository
+func (s *UserService) GetAllUsers(orgID int, filter models.UserFilter) ([]models.User, error) {
+	if err := s.prepareFilter(&filter); err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetAllUsers(orgID, filter)
+}
+
+// Count the users of an organization matching the filter, for paging with Limit and Offset
+func (s *UserService) CountUsers(orgID int, filter models.UserFilter) (int, error) {
+	if err := s.prepareFilter(&filter); err != nil {
+		return 0, err
+	}
+	return s.userRepo.CountUsers(orgID, filter)
+}
+
+// Validate a filter and normalize its attributes, tags and tags mode
+func (s *UserService) prepareFilter(filter *models.UserFilter) error {
+	if err := validateFields(filter.Fields); err != nil {
+		return err
+	}
+	if filter.Status != "" && !validStatus(filter.Status) {
+		return ErrInvalidStatus
+	}
+	attributes, err := s.attributes.ParseFilter(filter.Attributes)
+	if err != nil {
+		return err
+	}
+	filter.Attributes = attributes
+	switch filter.TagsMode {
+	case "":
+		filter.TagsMode = models.TagsModeAny
+	case models.TagsModeAny, models.TagsModeAll:
+	default:
+		return ErrInvalidTagsMode
+	}
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return err
+	}
+	return nil
 }
 
-// Get all users from repository
-func (s *UserService) GetAllUsers() ([]models.User, error) {
-	return s.userRepo.GetAllUsers()
+// Find specific user by their ID within an organization
+func (s *UserService) GetUserByID(orgID, id int) (*models.User, error) {
+	return s.userRepo.GetUserByID(orgID, id)
 }
 
-// Find specific user by their ID
-func (s *UserService) GetUserByID(id int) (*models.User, error) {
-	return s.userRepo.GetUserByID(id)
+// Find a user by ID, loading only the given fields
+func (s *UserService) GetUserFields(orgID, id int, fields []string) (*models.User, error) {
+	if err := validateFields(fields); err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetUserFields(orgID, id, fields)
 }
 
-// Create new user in the system
+// Create new user in user.OrgID
+// A supplied password is hashed and cleared before storage
 func (s *UserService) CreateUser(user *models.User) error {
-	return s.userRepo.CreateUser(user)
+	return s.createUser(user, models.StatusActive, "", 0)
+}
+
+// Create a user that starts in the given status, stored with the user in one write
+// Provisioning uses it for accounts that arrive deactivated; actorID is recorded in the audit log
+func (s *UserService) CreateUserWithStatus(user *models.User, status, reason string, actorID int) error {
+	if !validStatus(status) {
+		return ErrInvalidStatus
+	}
+	if status != models.StatusActive && !canTransition(models.StatusActive, status) {
+		return ErrInvalidTransition
+	}
+	return s.createUser(user, status, reason, actorID)
+}
+
+func (s *UserService) createUser(user *models.User, status, reason string, actorID int) error {
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if !validRole(user.Role) {
+		return ErrInvalidRole
+	}
+	if err := s.attributes.Validate(user.Attributes); err != nil {
+		return err
+	}
+	user.Status, user.StatusReason, user.StatusChangedAt = status, "", nil
+	user.CreatedAt = s.clock.Now()
+	user.UpdatedAt = user.CreatedAt
+	if status != models.StatusActive {
+		user.StatusReason, user.StatusChangedAt = reason, &user.CreatedAt
+	}
+	if user.Password != "" {
+		hash, err := s.hasher.Hash(user.Password)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+		user.Password = ""
+	}
+	if err := s.userRepo.CreateUser(user); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	if status != models.StatusActive {
+		return s.auditService.Record(user.OrgID, statusAuditEvents[status], &actorID, user.Email, reason)
+	}
+	return nil
 }
 
 // Update existing user information
+// The password, role and attributes are only changed when new values are supplied
 func (s *UserService) UpdateUser(user *models.User) error {
-	return s.userRepo.UpdateUser(user)
+	return s.updateUser(user, "", "", 0)
+}
+
+// Update a user and move it to a new status in one write, as provisioning sends both together
+// An empty status, or the current one, leaves the status as it is
+func (s *UserService) UpdateUserWithStatus(user *models.User, status, reason string, actorID int) error {
+	return s.updateUser(user, status, reason, actorID)
+}
+
+func (s *UserService) updateUser(user *models.User, status, reason string, actorID int) error {
+	if user.Attributes != nil {
+		if err := s.attributes.Validate(user.Attributes); err != nil {
+			return err
+		}
+	}
+	existing, err := s.userRepo.GetUserByID(user.OrgID, user.ID)
+	if err != nil {
+		return err
+	}
+	if user.Role == "" {
+		user.Role = existing.Role
+	}
+	if user.Attributes == nil {
+		user.Attributes = existing.Attributes
+	}
+	if !validRole(user.Role) {
+		return ErrInvalidRole
+	}
+	// The status is left alone unless it changes
+	user.Status, user.StatusReason = "", ""
+	if status != "" && status != existing.Status {
+		if !validStatus(status) {
+			return ErrInvalidStatus
+		}
+		if !canTransition(existing.Status, status) {
+			return ErrInvalidTransition
+		}
+		user.Status, user.StatusReason = status, reason
+	}
+
+	user.UpdatedAt = s.clock.Now()
+	user.PasswordHash = ""
+	if user.Password != "" {
+		hash, err := s.hasher.Hash(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = ""
+		user.PasswordHash = hash
+	}
+
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return err
+	}
+	// A new password, or leaving the active state, ends the user's logins
+	if user.PasswordHash != "" || (user.Status != "" && user.Status != models.StatusActive) {
+		if err := s.refreshRepo.RevokeAllForUser(user.ID, user.UpdatedAt); err != nil {
+			return err
+		}
+		if err := s.sessionRepo.DeleteAllForUser(user.ID); err != nil {
+			return err
+		}
+	}
+	s.outbox.Notify()
+	if user.Status != "" {
+		return s.auditService.Record(user.OrgID, statusAuditEvents[user.Status], &actorID, existing.Email, reason)
+	}
+	return nil
+}
+
+// Move a user to a new status if the transition is allowed
+// Leaving the active state ends all of the user's sessions and refresh tokens
+func (s *UserService) ChangeStatus(orgID, id int, status, reason string, actorID int) (*models.User, error) {
+	if !validStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+	user, err := s.userRepo.GetUserByID(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(user.Status, status) {
+		return nil, ErrInvalidTransition
+	}
+
+	now := s.clock.Now()
+	changed, err := s.userRepo.UpdateStatus(orgID, id, user.Status, status, reason, now)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		// Another request changed the status first
+		return nil, ErrInvalidTransition
+	}
+
+	if status != models.StatusActive {
+		if err := s.refreshRepo.RevokeAllForUser(id, now); err != nil {
+			return nil, err
+		}
+		if err := s.sessionRepo.DeleteAllForUser(id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.auditService.Record(orgID, statusAuditEvents[status], &actorID, user.Email, reason); err != nil {
+		return nil, err
+	}
+
+	s.outbox.Notify()
+	return s.userRepo.GetUserByID(orgID, id)
+}
+
+// Remove user from the organization
+func (s *UserService) DeleteUser(orgID, id int) error {
+	if err := s.userRepo.DeleteUser(orgID, id, s.clock.Now()); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
+
+// Check that every requested field is a selectable user field
+func validateFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(models.UserFields, field) {
+			return fmt.Errorf("%w: %q", ErrUnknownField, field)
+		}
+	}
+	return nil
+}
+
+func validRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleAdmin
+}
+
+func validStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
 }
 
-// Remove user from the system
-func (s *UserService) DeleteUser(id int) error {
-	return s.userRepo.DeleteUser(id)
+func canTransition(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"myapp/models"
+	"myapp/repositories"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Webhook Service: Manages webhook subscriptions and delivers user events to them
+// Events are queued in the database and sent by Run with retries and exponential backoff;
+// deliveries that fail every attempt are dead-lettered until retried by hand
+// Receivers must be public: connections to loopback, private and link-local addresses are refused
+
+var (
+	ErrInvalidWebhookURL   = errors.New("url must be an absolute http or https URL")
+	ErrInvalidWebhookEvent = errors.New("events must be user.created, user.updated or user.deleted")
+	ErrDeliveryNotDead     = errors.New("only dead deliveries can be retried")
+	ErrWebhookDestination  = errors.New("url must not point to a loopback, private or link-local address")
+)
+
+// User event types a webhook can subscribe to
+var webhookEvents = []string{models.UserCreated, models.UserUpdated, models.UserDeleted}
+
+const (
+	deliveryBatchSize = 50
+	deliveryLogLimit  = 100
+)
+
+// Ranges outside the ones netip reports as private or local that still do not reach the public internet
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which can map to any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+}
+
+type WebhookConfig struct {
+	MaxAttempts  int           // Attempts before a delivery is dead-lettered
+	BaseBackoff  time.Duration // Delay before the first retry, doubled for each further one
+	MaxBackoff   time.Duration // Upper bound on the delay between attempts
+	Timeout      time.Duration // Time allowed for the receiver to respond
+	PollInterval time.Duration // How often Run looks for due retries
+	Workers      int           // Webhooks sent to at the same time; each webhook gets one request at a time
+	AllowPrivate bool          // Permit receivers on loopback and private addresses, for local development
+}
+
+type WebhookService struct {
+	repo   *repositories.WebhookRepository
+	client *http.Client
+	config WebhookConfig
+	clock  Clock
+	wake   chan struct{}
+}
+
+// Create new service instance with repository dependency
+func NewWebhookService(repo *repositories.WebhookRepository, config WebhookConfig, clock Clock) *WebhookService {
+	config.Workers = max(config.Workers, 1)
+
+	// The destination is checked on every connection, after DNS resolution, so a receiver's
+	// name cannot later be pointed at an internal address; a proxy would hide the destination
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivate {
+		dialer.Control = refuseInternal
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookService{
+		repo: repo,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			// A redirect is a failed delivery; the signature covers only the configured URL
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		config: config,
+		clock:  clock,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Get all webhooks of an organization
+func (s *WebhookService) List(orgID int) ([]models.Webhook, error) {
+	return s.repo.List(orgID)
+}
+
+// Find a webhook by ID
+func (s *WebhookService) Get(orgID, id int) (*models.Webhook, error) {
+	return s.repo.GetByID(orgID, id)
+}
+
+// Create a webhook with a new signing secret, which is returned only here
+func (s *WebhookService) Create(webhook *models.Webhook) error {
+	if err := s.validate(webhook); err != nil {
+		return err
+	}
+	webhook.Secret = "whsec_" + randomToken(32)
+	webhook.CreatedAt = s.clock.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	return s.repo.Create(webhook)
+}
+
+// Change a webhook's URL, events or active flag
+func (s *WebhookService) Update(webhook *models.Webhook) error {
+	if err := s.validate(webhook); err != nil {
+		return err
+	}
+	webhook.UpdatedAt = s.clock.Now()
+	if err := s.repo.Update(webhook); err != nil {
+		return err
+	}
+	updated, err := s.repo.GetByID(webhook.OrgID, webhook.ID)
+	if err != nil {
+		return err
+	}
+	*webhook = *updated
+	return nil
+}
+
+// Delete a webhook and its deliveries
+func (s *WebhookService) Delete(orgID, id int) error {
+	return s.repo.Delete(orgID, id)
+}
+
+// List a webhook's most recent deliveries, newest first
+func (s *WebhookService) Deliveries(orgID, webhookID int) ([]models.WebhookDelivery, error) {
+	if _, err := s.repo.GetByID(orgID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(orgID, webhookID, deliveryLogLimit)
+}
+
+// Queue a dead delivery again with a fresh set of attempts
+func (s *WebhookService) RetryDelivery(orgID, webhookID, id int) (*models.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(orgID, webhookID, id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != models.DeliveryDead {
+		return nil, ErrDeliveryNotDead
+	}
+
+	now := s.clock.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.CompletedAt = nil
+	if err := s.repo.RecordAttempt(delivery); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return delivery, nil
+}
+
+// Queue an event for every webhook of its organization that subscribes to it
+func (s *WebhookService) Enqueue(event models.UserEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Enqueue(event, payload, s.clock.Now()); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Deliver queued events until ctx is cancelled
+// Newly queued events are sent right away; retries are picked up every PollInterval
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Webhook delivery failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Attempt every delivery that is due and return how many were attempted
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		deliveries, err := s.repo.DueDeliveries(s.clock.Now(), deliveryBatchSize)
+		if err != nil {
+			return attempted, err
+		}
+		n, err := s.deliverBatch(ctx, deliveries)
+		attempted += n
+		if err != nil {
+			return attempted, err
+		}
+		if len(deliveries) < deliveryBatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// Attempt a batch of deliveries, sending to up to Workers webhooks in parallel
+// Each webhook's deliveries go one after another in queue order, so a slow receiver only delays its own
+func (s *WebhookService) deliverBatch(ctx context.Context, deliveries []models.WebhookDelivery) (int, error) {
+	var queues [][]*models.WebhookDelivery
+	queueOf := map[int]int{}
+	for i := range deliveries {
+		d := &deliveries[i]
+		q, ok := queueOf[d.WebhookID]
+		if !ok {
+			q = len(queues)
+			queueOf[d.WebhookID] = q
+			queues = append(queues, nil)
+		}
+		queues[q] = append(queues[q], d)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		attempted int
+		firstErr  error
+	)
+	workers := make(chan struct{}, s.config.Workers)
+	for _, queue := range queues {
+		wg.Add(1)
+		go func(queue []*models.WebhookDelivery) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			for _, d := range queue {
+				err := ctx.Err()
+				if err == nil {
+					err = s.attempt(ctx, d)
+				}
+				mu.Lock()
+				if err == nil {
+					attempted++
+				} else if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+	return attempted, firstErr
+}
+
+// Send one delivery and record the outcome, scheduling a retry or dead-lettering it on failure
+func (s *WebhookService) attempt(ctx context.Context, d *models.WebhookDelivery) error {
+	d.Attempts++
+	d.ResponseStatus, d.LastError = s.send(ctx, d)
+
+	now := s.clock.Now()
+	switch {
+	case d.LastError == "":
+		d.Status = models.DeliverySucceeded
+		d.NextAttemptAt = nil
+		d.CompletedAt = &now
+	case d.Attempts >= s.config.MaxAttempts:
+		d.Status = models.DeliveryDead
+		d.NextAttemptAt = nil
+		d.CompletedAt = &now
+	default:
+		next := now.Add(s.backoff(d.Attempts))
+		d.NextAttemptAt = &next
+	}
+	return s.repo.RecordAttempt(d)
+}
+
+// POST the payload, returning the response status and an error message if it failed
+func (s *WebhookService) send(ctx context.Context, d *models.WebhookDelivery) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := strconv.FormatInt(s.clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myapp-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(d.ID))
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhook(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	// The body is not kept: the delivery log is readable through the API and must not relay what the receiver sent
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("receiver responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, ""
+}
+
+// Delay after the given number of failed attempts: BaseBackoff doubled per attempt, capped at MaxBackoff
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := s.config.BaseBackoff
+	for i := 1; i < attempts && delay < s.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.config.MaxBackoff)
+}
+
+// Wake Run without blocking; a pending wake-up already covers this one
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Signature sent in X-Webhook-Signature: "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>"
+// Receivers recompute it with their secret and should reject stale timestamps to prevent replays
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) validate(webhook *models.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	// Names are checked when connecting, as they may resolve differently later
+	if !s.config.AllowPrivate {
+		host := u.Hostname()
+		if ip, err := netip.ParseAddr(host); (err == nil && !isPublic(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return ErrWebhookDestination
+		}
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	for _, event := range webhook.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return ErrInvalidWebhookEvent
+		}
+	}
+	return nil
+}
+
+// Dialer control refusing connections to addresses that are not on the public internet
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !isPublic(ip) {
+		return ErrWebhookDestination
+	}
+	return nil
+}
+
+// Whether an address is public unicast: not loopback, private, link-local, multicast or unspecified
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
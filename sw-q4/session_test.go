@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"myapp/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Log in the test user and return the cookies set by the response
+func loginWithCookies(t *testing.T, router http.Handler) []*http.Cookie {
+	t.Helper()
+	rr := doJSON(t, router, "POST", "/users", models.User{Name: "Bob", Email: "bob@example.com", Password: "correct horse"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	rr = doJSON(t, router, "POST", "/auth/login", models.Credentials{Email: "bob@example.com", Password: "correct horse"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: got %v want %v", rr.Code, http.StatusOK)
+	}
+	return rr.Result().Cookies()
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Send a request carrying cookies and an optional CSRF header
+func doWithCookies(router http.Handler, method, path string, body any, cookies []*http.Cookie, csrfToken string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Test that login sets a HttpOnly session cookie and GET /auth/session describes it
+func TestSessionLogin(t *testing.T) {
+	router := setupRouter(t)
+	cookies := loginWithCookies(t, router)
+
+	sessionCookie := findCookie(cookies, "session_id")
+	csrfCookie := findCookie(cookies, "csrf_token")
+	if sessionCookie == nil || !sessionCookie.HttpOnly || sessionCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Expected HttpOnly SameSite session cookie, got %+v", sessionCookie)
+	}
+	if csrfCookie == nil || csrfCookie.HttpOnly {
+		t.Fatalf("Expected script-readable CSRF cookie, got %+v", csrfCookie)
+	}
+
+	rr := doWithCookies(router, "GET", "/auth/session", nil, cookies, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var session struct {
+		User      models.User `json:"user"`
+		CSRFToken string      `json:"csrf_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	if session.User.Email != "bob@example.com" || session.CSRFToken != csrfCookie.Value {
+		t.Errorf("Unexpected session response: %+v", session)
+	}
+}
+
+// Test that mutating user routes require the CSRF token with cookie sessions
+func TestSessionCSRF(t *testing.T) {
+	router := setupRouter(t)
+	cookies := loginWithCookies(t, router)
+	csrfToken := findCookie(cookies, "csrf_token").Value
+	newUser := models.User{Name: "John", Email: "john@example.com"}
+
+	rr := doWithCookies(router, "POST", "/users", newUser, cookies, "")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Missing CSRF token: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = doWithCookies(router, "POST", "/users", newUser, cookies, "forged")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Wrong CSRF token: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = doWithCookies(router, "POST", "/users", newUser, cookies, csrfToken)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Valid CSRF token: got %v want %v", rr.Code, http.StatusCreated)
+	}
+}
+
+// Test that logging out ends the cookie session
+func TestSessionLogout(t *testing.T) {
+	router := setupRouter(t)
+	cookies := loginWithCookies(t, router)
+	csrfToken := findCookie(cookies, "csrf_token").Value
+
+	rr := doWithCookies(router, "POST", "/auth/logout", nil, cookies, csrfToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	rr = doWithCookies(router, "GET", "/auth/session", nil, cookies, "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"myapp/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test suspending a user blocks login and existing tokens until reactivated
+func TestSuspendUser(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+	tokens := loginTestUser(t, router)
+
+	rr := doJSONWithToken(t, router, "POST", "/users/3/suspend", map[string]string{"reason": "abuse"}, adminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Suspend: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var user models.User
+	decodeBody(t, rr.Body, &user)
+	if user.Status != models.StatusSuspended || user.StatusReason != "abuse" || user.StatusChangedAt == nil {
+		t.Errorf("Unexpected suspended user: %+v", user)
+	}
+
+	creds := models.Credentials{Email: "bob@example.com", Password: "correct horse"}
+	if rr := doJSON(t, router, "POST", "/auth/login", creds); rr.Code != http.StatusForbidden {
+		t.Errorf("Login while suspended: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONWithToken(t, router, "GET", "/auth/session", nil, tokens.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Access token while suspended: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh while suspended: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	if rr := doJSONWithToken(t, router, "POST", "/users/3/activate", nil, adminToken); rr.Code != http.StatusOK {
+		t.Fatalf("Activate: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSON(t, router, "POST", "/auth/login", creds); rr.Code != http.StatusOK {
+		t.Errorf("Login after reactivation: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var events []models.AuditEvent
+	decodeBody(t, doJSONWithToken(t, router, "GET", "/audit-events?type="+models.AuditUserSuspended, nil, adminToken).Body, &events)
+	if len(events) != 1 || events[0].Details != "abuse" {
+		t.Errorf("Expected one suspension audit event, got %+v", events)
+	}
+}
+
+// Test disallowed transitions and filtering the user list by status
+func TestUserStatusTransitions(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/activate", nil, adminToken); rr.Code != http.StatusConflict {
+		t.Errorf("Activate active user: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/deactivate", nil, adminToken); rr.Code != http.StatusOK {
+		t.Fatalf("Deactivate: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/suspend", nil, adminToken); rr.Code != http.StatusConflict {
+		t.Errorf("Suspend deactivated user: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if rr := doJSON(t, router, "POST", "/users/1/suspend", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous suspend: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	var users []models.User
+	decodeBody(t, doJSON(t, router, "GET", "/users?status=deactivated", nil).Body, &users)
+	if len(users) != 1 || users[0].Email != "alice@example.com" {
+		t.Errorf("Expected only Alice to be deactivated, got %+v", users)
+	}
+	if rr := doJSON(t, router, "GET", "/users?status=bogus", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid status filter: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"myapp/models"
+	"myapp/repositories"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// List user IDs returned for a /users query
+func userIDs(t *testing.T, router http.Handler, path string) []int {
+	t.Helper()
+	rr := doJSON(t, router, "GET", path, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("%s: got %v want %v", path, rr.Code, http.StatusOK)
+	}
+	var users []models.User
+	decodeBody(t, rr.Body, &users)
+	ids := []int{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Test tagging users, filtering by tags and listing tag usage
+func TestUserTags(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Carol", Email: "carol@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("create Carol: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	if rr := doJSON(t, router, "POST", "/users/1/tags", map[string]any{"tags": []string{"beta"}}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous tagging: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/1/tags", map[string]any{"tags": []string{"no spaces"}}, adminToken); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid tag: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/users/99/tags", map[string]any{"tags": []string{"beta"}}, adminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown user: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr := doJSONWithToken(t, router, "POST", "/users/1/tags", map[string]any{"tags": []string{"VIP", "beta", "vip"}}, adminToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Tag Alice: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var alice models.User
+	decodeBody(t, rr.Body, &alice)
+	if len(alice.Tags) != 2 || alice.Tags[0] != "beta" || alice.Tags[1] != "vip" {
+		t.Errorf("Unexpected tags %v", alice.Tags)
+	}
+	doJSONWithToken(t, router, "POST", "/users/3/tags", map[string]any{"tags": []string{"beta"}}, adminToken)
+
+	cases := map[string][]int{
+		"/users?tags=beta":                     {1, 3},
+		"/users?tags=beta,vip":                 {1, 3},
+		"/users?tags=beta,vip&tags_mode=all":   {1},
+		"/users?tags=vip,%20VIP&tags_mode=all": {1},
+		"/users?tags=unknown":                  {},
+	}
+	for path, expected := range cases {
+		if ids := userIDs(t, router, path); !sameIDs(ids, expected) {
+			t.Errorf("%s: got %v want %v", path, ids, expected)
+		}
+	}
+	if rr := doJSON(t, router, "GET", "/users?tags=beta&tags_mode=some", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid tags_mode: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	var tags []models.Tag
+	decodeBody(t, doJSON(t, router, "GET", "/tags", nil).Body, &tags)
+	if len(tags) != 2 || tags[0] != (models.Tag{Name: "beta", Count: 2}) || tags[1] != (models.Tag{Name: "vip", Count: 1}) {
+		t.Errorf("Unexpected tag counts %+v", tags)
+	}
+
+	// Removing the last use of a tag removes the tag
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1/tags/vip", nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Errorf("Remove tag: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1/tags/vip", nil, adminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Remove missing tag: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Deleting a user drops their tags from the counts
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/3", nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete Carol: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	decodeBody(t, doJSON(t, router, "GET", "/tags", nil).Body, &tags)
+	if len(tags) != 1 || tags[0] != (models.Tag{Name: "beta", Count: 1}) {
+		t.Errorf("Unexpected tag counts after removal %+v", tags)
+	}
+}
+
+// Test that tagging and untagging update the user and record a user.updated event, in either user store
+func TestUserTagsUpdateUser(t *testing.T) {
+	for _, store := range []string{"table", "events"} {
+		t.Run("store="+store, func(t *testing.T) {
+			setupTestDatabase(t)
+			clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+			cfg := testConfig()
+			cfg.Clock = clock
+			cfg.UserStore = store
+			// The clock moves by hours; keep the administrator logged in
+			cfg.AccessTokenTTL = 24 * time.Hour
+			router := newRouter(db, cfg)
+			adminToken := setupAdmin(t, router, clock)
+			events := repositories.NewUserEventStore(db, repositories.DefaultSnapshotInterval)
+			if store == "events" {
+				if _, err := events.ImportUsers(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pending := len(unpublishedEvents(t))
+
+			getAlice := func() models.User {
+				t.Helper()
+				var alice models.User
+				decodeBody(t, doJSONWithToken(t, router, "GET", "/users/1", nil, adminToken).Body, &alice)
+				return alice
+			}
+			lastEvent := func() models.UserEvent {
+				t.Helper()
+				events := unpublishedEvents(t)
+				return events[len(events)-1]
+			}
+
+			clock.Advance(time.Hour)
+			if rr := doJSONWithToken(t, router, "POST", "/users/1/tags", map[string]any{"tags": []string{"beta"}}, adminToken); rr.Code != http.StatusOK {
+				t.Fatalf("Tag: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if alice := getAlice(); !alice.UpdatedAt.Equal(clock.Now()) {
+				t.Errorf("After tagging: updated_at %v, want %v", alice.UpdatedAt, clock.Now())
+			}
+			if event := lastEvent(); len(unpublishedEvents(t)) != pending+1 || event.Type != models.UserUpdated || event.UserID != 1 || event.User == nil {
+				t.Errorf("After tagging: got event %+v", event)
+			}
+
+			// Tags the user already has change nothing
+			clock.Advance(time.Hour)
+			doJSONWithToken(t, router, "POST", "/users/1/tags", map[string]any{"tags": []string{"beta"}}, adminToken)
+			if n := len(unpublishedEvents(t)); n != pending+1 {
+				t.Errorf("Tagging again: %d events, want %d", n, pending+1)
+			}
+
+			if rr := doJSONWithToken(t, router, "DELETE", "/users/1/tags/beta", nil, adminToken); rr.Code != http.StatusNoContent {
+				t.Fatalf("Untag: got %v want %v", rr.Code, http.StatusNoContent)
+			}
+			if alice := getAlice(); !alice.UpdatedAt.Equal(clock.Now()) {
+				t.Errorf("After untagging: updated_at %v, want %v", alice.UpdatedAt, clock.Now())
+			}
+			if event := lastEvent(); len(unpublishedEvents(t)) != pending+2 || event.Type != models.UserUpdated || event.UserID != 1 {
+				t.Errorf("After untagging: got event %+v", event)
+			}
+
+			// The update time survives a rebuild of the projection
+			if store == "events" {
+				if _, _, err := events.RebuildProjections(clock.Now()); err != nil {
+					t.Fatal(err)
+				}
+				if alice := getAlice(); !alice.UpdatedAt.Equal(clock.Now()) {
+					t.Errorf("After rebuild: updated_at %v, want %v", alice.UpdatedAt, clock.Now())
+				}
+			}
+		})
+	}
+}
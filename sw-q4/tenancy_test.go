@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"myapp/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Send a JSON request with a Bearer access token acting in the given organization
+func doJSONInOrg(t *testing.T, router http.Handler, method, path string, body any, token string, orgID int) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Org-ID", strconv.Itoa(orgID))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Create a second organization with its own Alice and return an access token for her
+func setupTenant(t *testing.T, router http.Handler, adminToken string) (int, string) {
+	t.Helper()
+	rr := doJSONWithToken(t, router, "POST", "/organizations", models.Organization{Name: "Acme", Slug: "acme"}, adminToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create organization: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var org models.Organization
+	decodeBody(t, rr.Body, &org)
+
+	// Emails are unique per organization, so Alice can exist in both
+	alice := models.User{Name: "Acme Alice", Email: "alice@example.com", Password: "acme password"}
+	if rr := doJSONInOrg(t, router, "POST", "/users", alice, adminToken, org.ID); rr.Code != http.StatusCreated {
+		t.Fatalf("Create tenant user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if rr := doJSONInOrg(t, router, "POST", "/users", alice, adminToken, org.ID); rr.Code != http.StatusConflict {
+		t.Errorf("Duplicate email in tenant: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	rr = doJSON(t, router, "POST", "/auth/login", models.Credentials{OrgID: org.ID, Email: "alice@example.com", Password: "acme password"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Tenant login: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var tokens models.TokenPair
+	decodeBody(t, rr.Body, &tokens)
+	return org.ID, tokens.AccessToken
+}
+
+// Test that users of one organization cannot see or change users of another
+func TestTenantIsolation(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+	orgID, tenantToken := setupTenant(t, router, adminToken)
+
+	var users []models.User
+	decodeBody(t, doJSONWithToken(t, router, "GET", "/users", nil, tenantToken).Body, &users)
+	if len(users) != 1 || users[0].Name != "Acme Alice" || users[0].OrgID != orgID {
+		t.Fatalf("Expected only the tenant's users, got %+v", users)
+	}
+	tenantAlice := strconv.Itoa(users[0].ID)
+
+	// User 1 is Alice of the default organization
+	if rr := doJSONWithToken(t, router, "GET", "/users/1", nil, tenantToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Read across tenants: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	// Even a tenant administrator cannot change another organization's users
+	if _, err := db.Exec("UPDATE users SET role = 'admin' WHERE id = ?", users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	tenantAdmin := accessTokenInOrg(t, cfg, orgID, users[0].ID, true)
+	if rr := doJSONWithToken(t, router, "PUT", "/users/1", models.User{Name: "Hijacked", Email: "alice@example.com"}, tenantAdmin); rr.Code != http.StatusNotFound {
+		t.Errorf("Update across tenants: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, tenantAdmin); rr.Code != http.StatusNotFound {
+		t.Errorf("Delete across tenants: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := doJSONWithToken(t, router, "GET", "/users/1/groups", nil, tenantToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Groups across tenants: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Users created by a tenant stay in the tenant
+	if rr := doJSONWithToken(t, router, "POST", "/users", models.User{Name: "Carol", Email: "carol@example.com"}, tenantToken); rr.Code != http.StatusCreated {
+		t.Fatalf("Create in tenant: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	decodeBody(t, doJSONWithToken(t, router, "GET", "/users", nil, tenantToken).Body, &users)
+	if len(users) != 2 {
+		t.Errorf("Expected two tenant users, got %+v", users)
+	}
+
+	// Anonymous requests only see the default organization
+	if rr := doJSON(t, router, "GET", "/users/"+tenantAlice, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Anonymous read of tenant user: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	decodeBody(t, doJSON(t, router, "GET", "/users", nil).Body, &users)
+	if len(users) != 2 || users[0].Name != "Alice" {
+		t.Errorf("Expected the default organization's users, got %+v", users)
+	}
+	if rr := doJSON(t, router, "PUT", "/users/"+tenantAlice, models.User{Name: "Hijacked", Email: "x@example.com"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous update of tenant user: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSON(t, router, "DELETE", "/users/"+tenantAlice, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous delete of tenant user: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Default organization credentials do not log in to the tenant and vice versa
+	creds := models.Credentials{Email: "alice@example.com", Password: "acme password"}
+	if rr := doJSON(t, router, "POST", "/auth/login", creds); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Tenant password in default organization: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// Test which principals may select an organization with X-Org-ID
+func TestOrgHeader(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+	orgID, tenantToken := setupTenant(t, router, adminToken)
+
+	if rr := doJSONInOrg(t, router, "GET", "/users", nil, tenantToken, models.DefaultOrgID); rr.Code != http.StatusForbidden {
+		t.Errorf("Tenant selecting another organization: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONInOrg(t, router, "GET", "/users", nil, tenantToken, orgID); rr.Code != http.StatusOK {
+		t.Errorf("Tenant selecting its own organization: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := doJSONInOrg(t, router, "GET", "/users", nil, "", orgID); rr.Code != http.StatusForbidden {
+		t.Errorf("Anonymous selecting an organization: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONInOrg(t, router, "GET", "/users", nil, adminToken, 99); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown organization: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := doJSONWithToken(t, router, "GET", "/organizations", nil, tenantToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Tenant listing organizations: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	var users []models.User
+	decodeBody(t, doJSONInOrg(t, router, "GET", "/users", nil, adminToken, orgID).Body, &users)
+	if len(users) != 1 || users[0].OrgID != orgID {
+		t.Errorf("Expected the platform admin to see the tenant's users, got %+v", users)
+	}
+}
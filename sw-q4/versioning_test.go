@@ -0,0 +1,121 @@
+package main
+
+import (
+	"myapp/handlers/v2"
+	"net/http"
+	"testing"
+)
+
+// Test that /v1 and the deprecated root alias serve the same API
+func TestAPIVersions(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+
+	rr := doJSON(t, router, "GET", "/v1/users/1", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("v1 get: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Errorf("v1 should not be deprecated, got %q", rr.Header().Get("Deprecation"))
+	}
+
+	rr = doJSON(t, router, "GET", "/users/1", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Root get: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Deprecation"); got != "@1792368000" {
+		t.Errorf("Deprecation: got %q", got)
+	}
+	if got := rr.Header().Get("Sunset"); got != "Fri, 30 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Sunset: got %q", got)
+	}
+	if got := rr.Header().Get("Link"); got != `</v1/users/1>; rel="successor-version"` {
+		t.Errorf("Link: got %q", got)
+	}
+
+	// Guards apply under every prefix
+	for _, path := range []string{"/v1/users/1/suspend", "/users/1/suspend"} {
+		if rr := doJSON(t, router, "POST", path, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %v want %v", path, rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if rr := doJSON(t, router, "GET", "/v3/users", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Unknown version: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// Test the v2 user representation and error bodies
+func TestV2Users(t *testing.T) {
+	setupTestDatabase(t)
+	router := newRouter(db, testConfig())
+	db.Exec("UPDATE users SET role = 'admin' WHERE id = 1")
+	adminToken := accessToken(t, testConfig(), 1, true)
+
+	// Like v1, anyone may sign up
+	rr := doJSON(t, router, "POST", "/v2/users", v2.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if got := rr.Header().Get("Location"); got != "/v2/users/2" {
+		t.Errorf("Location: got %q", got)
+	}
+	var created struct {
+		Data v2.User `json:"data"`
+	}
+	decodeBody(t, rr.Body, &created)
+	if created.Data.ID != 2 || created.Data.Status.State != "active" || created.Data.EmailVerified || created.Data.Tags == nil {
+		t.Errorf("Unexpected user %+v", created.Data)
+	}
+
+	// Bob may change himself but not others
+	bobToken := accessToken(t, testConfig(), 2, false)
+	rename := v2.UpdateUserRequest{Name: "Robert", Email: "bob@example.com"}
+	if rr := doJSON(t, router, "PUT", "/v2/users/2", rename); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous update: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/v2/users/1", v2.UpdateUserRequest{Name: "Mallory", Email: "alice@example.com"}, bobToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Update of another user: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	rr = doJSONWithToken(t, router, "PUT", "/v2/users/2", rename, bobToken)
+	var updated struct {
+		Data v2.User `json:"data"`
+	}
+	decodeBody(t, rr.Body, &updated)
+	if rr.Code != http.StatusOK || updated.Data.Name != "Robert" || updated.Data.Role != "user" {
+		t.Errorf("Update: got %v %+v", rr.Code, updated.Data)
+	}
+
+	var list struct {
+		Data []v2.User `json:"data"`
+	}
+	decodeBody(t, doJSON(t, router, "GET", `/v2/users?filter=name+eq+"Robert"`, nil).Body, &list)
+	if len(list.Data) != 1 || list.Data[0].ID != 2 {
+		t.Errorf("List: got %+v", list.Data)
+	}
+
+	rr = doJSON(t, router, "GET", "/v2/users/99", nil)
+	var failure v2.ErrorBody
+	decodeBody(t, rr.Body, &failure)
+	if rr.Code != http.StatusNotFound || failure.Error.Status != http.StatusNotFound || failure.Error.Message != "user not found" {
+		t.Errorf("Missing user: got %v %+v", rr.Code, failure)
+	}
+	if rr := doJSON(t, router, "POST", "/v2/users", v2.CreateUserRequest{Name: "Eve", Email: "eve@example.com", Role: "admin"}); rr.Code != http.StatusForbidden {
+		t.Errorf("Role assignment on create: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONWithToken(t, router, "POST", "/v2/users", v2.CreateUserRequest{Name: "Eve", Email: "eve@example.com", Role: "admin"}, adminToken); rr.Code != http.StatusCreated {
+		t.Errorf("Role assignment by an admin: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/v2/users/2", v2.UpdateUserRequest{Name: "Robert", Email: "bob@example.com", Role: "admin"}, bobToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Role assignment: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	if rr := doJSON(t, router, "DELETE", "/v2/users/2", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous delete: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/v2/users/1", nil, bobToken); rr.Code != http.StatusForbidden {
+		t.Errorf("Delete of another user: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if rr := doJSONWithToken(t, router, "DELETE", "/v2/users/2", nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Errorf("Delete: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"myapp/models"
+	"myapp/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receiver that records webhook requests and answers with a configurable status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+	if rc.status >= 300 {
+		w.Write([]byte("internal error details"))
+	}
+}
+
+func (rc *webhookReceiver) setStatus(status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.status = status
+}
+
+func (rc *webhookReceiver) request(i int) (*http.Request, []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests[i], rc.bodies[i]
+}
+
+func (rc *webhookReceiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+func webhookDeliveries(t *testing.T, router http.Handler, token string, id int) []models.WebhookDelivery {
+	t.Helper()
+	rr := doJSONWithToken(t, router, "GET", "/webhooks/"+strconv.Itoa(id)+"/deliveries", nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("List deliveries: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var deliveries []models.WebhookDelivery
+	decodeBody(t, rr.Body, &deliveries)
+	return deliveries
+}
+
+// Test signed delivery, retries with backoff, dead-lettering and manual retry
+func TestWebhookDelivery(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	// The clock moves through the retry schedule; keep the administrator logged in
+	cfg.AccessTokenTTL = 24 * time.Hour
+	app := newServers(db, cfg)
+	router := app.router
+	adminToken := setupAdmin(t, router, clock)
+	ctx := context.Background()
+	// Events relayed before the webhook exists are not delivered to it
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rr := doJSONWithToken(t, router, "POST", "/webhooks", map[string]any{"url": server.URL, "events": []string{"user.created"}}, adminToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create webhook: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var webhook models.Webhook
+	decodeBody(t, rr.Body, &webhook)
+	if webhook.Secret == "" || !webhook.Active {
+		t.Fatalf("Unexpected webhook %+v", webhook)
+	}
+	rr = doJSONWithToken(t, router, "GET", "/webhooks/"+strconv.Itoa(webhook.ID), nil, adminToken)
+	var fetched models.Webhook
+	decodeBody(t, rr.Body, &fetched)
+	if rr.Code != http.StatusOK || fetched.Secret != "" {
+		t.Errorf("Get webhook: got %v %+v, want no secret", rr.Code, fetched)
+	}
+
+	// Only subscribed event types are queued
+	if rr := doJSON(t, router, "POST", "/users", models.User{Name: "Carol", Email: "carol@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	alice := accessToken(t, cfg, 1, false)
+	if rr := doJSONWithToken(t, router, "PUT", "/users/1", models.User{Name: "Alicia", Email: "alice@example.com"}, alice); rr.Code != http.StatusOK {
+		t.Fatalf("Update user: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The first attempt fails and is retried after the backoff
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := app.webhooks.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("First attempt: delivered %d, %v", n, err)
+	}
+	if n, _ := app.webhooks.DeliverDue(ctx); n != 0 {
+		t.Errorf("Retry before backoff: attempted %d", n)
+	}
+	receiver.setStatus(http.StatusNoContent)
+	clock.Advance(time.Minute)
+	if n, err := app.webhooks.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("Retry: delivered %d, %v", n, err)
+	}
+
+	first, _ := receiver.request(0)
+	req, body := receiver.request(1)
+	timestamp := req.Header.Get("X-Webhook-Timestamp")
+	if got := req.Header.Get("X-Webhook-Signature"); got != services.SignWebhook(webhook.Secret, timestamp, body) {
+		t.Errorf("Signature %q does not verify", got)
+	}
+	if req.Header.Get("X-Webhook-Event") != models.UserCreated || req.Header.Get("X-Webhook-ID") != first.Header.Get("X-Webhook-ID") {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+	var event models.UserEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != models.UserCreated || event.User == nil || event.User.Email != "carol@example.com" {
+		t.Errorf("Unexpected payload %+v", event)
+	}
+
+	deliveries := webhookDeliveries(t, router, adminToken, webhook.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliverySucceeded || deliveries[0].Attempts != 2 || deliveries[0].ResponseStatus != http.StatusNoContent {
+		t.Errorf("Delivery log: got %+v", deliveries)
+	}
+
+	// After the last attempt the delivery is dead until retried by hand
+	receiver.setStatus(http.StatusServiceUnavailable)
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, alice); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete user: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rr := doJSONWithToken(t, router, "PUT", "/webhooks/"+strconv.Itoa(webhook.ID), map[string]any{"url": server.URL}, adminToken); rr.Code != http.StatusOK {
+		t.Fatalf("Update webhook: got %v want %v", rr.Code, http.StatusOK)
+	}
+	// Carol, user 3; the administrator is user 2
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/3", nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete user: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cfg.Webhooks.MaxAttempts; i++ {
+		app.webhooks.DeliverDue(ctx)
+		clock.Advance(cfg.Webhooks.MaxBackoff)
+	}
+	deliveries = webhookDeliveries(t, router, adminToken, webhook.ID)
+	dead := deliveries[0]
+	if len(deliveries) != 2 || dead.EventType != models.UserDeleted || dead.Status != models.DeliveryDead || dead.Attempts != 3 {
+		t.Fatalf("Dead letter: got %+v", deliveries)
+	}
+	// The receiver's response body is not echoed back
+	if dead.LastError != "receiver responded 503" {
+		t.Errorf("Last error: got %q", dead.LastError)
+	}
+
+	retryPath := "/webhooks/" + strconv.Itoa(webhook.ID) + "/deliveries/" + strconv.Itoa(dead.ID) + "/retry"
+	if rr := doJSONWithToken(t, router, "POST", retryPath, nil, adminToken); rr.Code != http.StatusAccepted {
+		t.Fatalf("Retry: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	receiver.setStatus(http.StatusOK)
+	app.webhooks.DeliverDue(ctx)
+	if got := webhookDeliveries(t, router, adminToken, webhook.ID)[0]; got.Status != models.DeliverySucceeded {
+		t.Errorf("After retry: got %+v", got)
+	}
+	if rr := doJSONWithToken(t, router, "POST", retryPath, nil, adminToken); rr.Code != http.StatusConflict {
+		t.Errorf("Retry delivered: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if n := receiver.count(); n != 6 {
+		t.Errorf("Receiver got %d requests, want 6", n)
+	}
+}
+
+// Test webhook validation and access control
+func TestWebhookManagement(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Webhooks.AllowPrivate = false
+	router := newRouter(db, cfg)
+	adminToken := setupAdmin(t, router, clock)
+
+	for _, body := range []map[string]any{
+		{"url": "ftp://example.com/hook"},
+		{"url": "/relative"},
+		{"url": "https://example.com/hook", "events": []string{"user.renamed"}},
+		{"url": "http://127.0.0.1:8080/hook"},
+		{"url": "http://localhost/hook"},
+		{"url": "http://169.254.169.254/latest/meta-data"},
+		{"url": "https://10.0.0.5/hook"},
+		{"url": "http://[::1]/hook"},
+		{"url": "http://[::ffff:192.168.0.1]/hook"},
+	} {
+		if rr := doJSONWithToken(t, router, "POST", "/webhooks", body, adminToken); rr.Code != http.StatusBadRequest {
+			t.Errorf("Create %v: got %v want %v", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr := doJSONWithToken(t, router, "POST", "/webhooks", map[string]any{"url": "https://example.com/hook", "active": false}, adminToken)
+	var webhook models.Webhook
+	decodeBody(t, rr.Body, &webhook)
+	if rr.Code != http.StatusCreated || webhook.Active || len(webhook.Events) != 0 {
+		t.Errorf("Create inactive: got %v %+v", rr.Code, webhook)
+	}
+	var list []models.Webhook
+	decodeBody(t, doJSONWithToken(t, router, "GET", "/webhooks", nil, adminToken).Body, &list)
+	if len(list) != 1 || list[0].Secret != "" {
+		t.Errorf("List: got %+v", list)
+	}
+
+	if rr := doJSON(t, router, "GET", "/webhooks", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	path := "/webhooks/" + strconv.Itoa(webhook.ID)
+	if rr := doJSONWithToken(t, router, "DELETE", path, nil, adminToken); rr.Code != http.StatusNoContent {
+		t.Errorf("Delete: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := doJSONWithToken(t, router, "GET", path, nil, adminToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Deleted: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// Test that deliveries never connect to internal addresses, even when a public name later resolves to one
+func TestWebhookInternalDestination(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	cfg.Webhooks.AllowPrivate = false
+	app := newServers(db, cfg)
+	adminToken := setupAdmin(t, app.router, clock)
+	ctx := context.Background()
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rr := doJSONWithToken(t, app.router, "POST", "/webhooks", map[string]any{"url": "https://hooks.example.com/users"}, adminToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create webhook: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var webhook models.Webhook
+	decodeBody(t, rr.Body, &webhook)
+	// As if the name now resolved to the loopback address
+	if _, err := db.Exec("UPDATE webhooks SET url = ? WHERE id = ?", server.URL, webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := doJSON(t, app.router, "POST", "/users", models.User{Name: "Carol", Email: "carol@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := app.webhooks.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("Deliver: attempted %d, %v", n, err)
+	}
+
+	if n := receiver.count(); n != 0 {
+		t.Errorf("Receiver got %d requests, want 0", n)
+	}
+	deliveries := webhookDeliveries(t, app.router, adminToken, webhook.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliveryPending || !strings.Contains(deliveries[0].LastError, services.ErrWebhookDestination.Error()) {
+		t.Errorf("Delivery log: got %+v", deliveries)
+	}
+}
+
+// Test that a slow receiver does not hold up deliveries to other webhooks
+func TestWebhookParallelDelivery(t *testing.T) {
+	setupTestDatabase(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0).UTC()}
+	cfg := testConfig()
+	cfg.Clock = clock
+	app := newServers(db, cfg)
+	adminToken := setupAdmin(t, app.router, clock)
+	ctx := context.Background()
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow receiver only answers once the other one has been called
+	released := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-released:
+			w.WriteHeader(http.StatusNoContent)
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(released)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer fast.Close()
+
+	var ids []int
+	for _, url := range []string{slow.URL, fast.URL} {
+		rr := doJSONWithToken(t, app.router, "POST", "/webhooks", map[string]any{"url": url, "events": []string{"user.created"}}, adminToken)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Create webhook: got %v want %v", rr.Code, http.StatusCreated)
+		}
+		var webhook models.Webhook
+		decodeBody(t, rr.Body, &webhook)
+		ids = append(ids, webhook.ID)
+	}
+
+	if rr := doJSON(t, app.router, "POST", "/users", models.User{Name: "Carol", Email: "carol@example.com"}); rr.Code != http.StatusCreated {
+		t.Fatalf("Create user: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if _, err := app.outbox.RelayPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := app.webhooks.DeliverDue(ctx); err != nil || n != 2 {
+		t.Fatalf("Deliver: attempted %d, %v", n, err)
+	}
+	for _, id := range ids {
+		if deliveries := webhookDeliveries(t, app.router, adminToken, id); len(deliveries) != 1 || deliveries[0].Status != models.DeliverySucceeded {
+			t.Errorf("Webhook %d: got %+v", id, deliveries)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myapp/handlers"
+	"myapp/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Open a WebSocket to /ws with the given headers
+func dialSocket(t *testing.T, server *httptest.Server, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) handlers.SocketFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame handlers.SocketFrame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Read frame: %v", err)
+	}
+	return frame
+}
+
+func sendFrame(t *testing.T, conn *websocket.Conn, frame handlers.SocketFrame) {
+	t.Helper()
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Update a user as the user themselves
+func renameUser(t *testing.T, router http.Handler, id, name, email string) {
+	t.Helper()
+	userID, _ := strconv.Atoi(id)
+	token := accessToken(t, testConfig(), userID, false)
+	if rr := doJSONWithToken(t, router, "PUT", "/users/"+id, models.User{Name: name, Email: email}, token); rr.Code != http.StatusOK {
+		t.Fatalf("Update user %s: got %v want %v", id, rr.Code, http.StatusOK)
+	}
+}
+
+// Test handshake authentication, topic subscriptions and control frames
+func TestWebSocketSubscriptions(t *testing.T) {
+	setupTestDatabase(t)
+	app := newServers(db, testConfig())
+	startOutbox(t, app)
+	router := app.router
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	tokens := loginTestUser(t, router)
+	auth := http.Header{"Authorization": {"Bearer " + tokens.AccessToken}}
+
+	if _, resp, err := dialSocket(t, server, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Anonymous handshake: got %v, want %v", err, http.StatusUnauthorized)
+	}
+	crossSite := http.Header{"Authorization": auth["Authorization"], "Origin": {"https://evil.example"}}
+	if _, resp, err := dialSocket(t, server, crossSite); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Cross-site handshake: got %v, want %v", err, http.StatusForbidden)
+	}
+
+	conn, _, err := dialSocket(t, server, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"user:2"}})
+	if frame := readFrame(t, conn); frame.Type != "subscribed" || len(frame.Topics) != 1 {
+		t.Fatalf("Subscribe: got %+v", frame)
+	}
+
+	// Only the subscribed user's changes are delivered
+	renameUser(t, router, "1", "Alicia", "alice@example.com")
+	renameUser(t, router, "2", "Robert", "bob@example.com")
+	frame := readFrame(t, conn)
+	if frame.Type != "event" || frame.Event.UserID != 2 || frame.Event.User.Name != "Robert" {
+		t.Errorf("Event: got %+v", frame)
+	}
+
+	sendFrame(t, conn, handlers.SocketFrame{Type: "ping"})
+	if frame := readFrame(t, conn); frame.Type != "pong" {
+		t.Errorf("Ping: got %+v", frame)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"everything"}})
+	if frame := readFrame(t, conn); frame.Type != "error" {
+		t.Errorf("Unknown topic: got %+v", frame)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"group:99"}})
+	if frame := readFrame(t, conn); frame.Type != "error" {
+		t.Errorf("Missing group: got %+v", frame)
+	}
+
+	// Group topics follow membership, including deletion of a member
+	if _, err := db.Exec(`INSERT INTO groups (org_id, name, created_at) VALUES (1, 'Engineering', ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO group_members (group_id, user_id, joined_at) VALUES (1, 1, ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "unsubscribe", Topics: []string{"user:2"}})
+	readFrame(t, conn)
+	sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"group:1"}})
+	if frame := readFrame(t, conn); frame.Type != "subscribed" || len(frame.Topics) != 1 || frame.Topics[0] != "group:1" {
+		t.Fatalf("Subscribe to group: got %+v", frame)
+	}
+	renameUser(t, router, "2", "Bob", "bob@example.com")
+	if rr := doJSONWithToken(t, router, "DELETE", "/users/1", nil, accessToken(t, testConfig(), 1, false)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if frame := readFrame(t, conn); frame.Type != "event" || frame.Event.Type != models.UserDeleted || frame.Event.UserID != 1 {
+		t.Errorf("Group member deleted: got %+v", frame)
+	}
+}
+
+// Test that connections subscribed to the same group all follow its membership
+func TestWebSocketGroupSubscribers(t *testing.T) {
+	setupTestDatabase(t)
+	app := newServers(db, testConfig())
+	startOutbox(t, app)
+	router := app.router
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	tokens := loginTestUser(t, router)
+	auth := http.Header{"Authorization": {"Bearer " + tokens.AccessToken}}
+
+	if _, err := db.Exec(`INSERT INTO groups (org_id, name, created_at) VALUES (1, 'Engineering', ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO group_members (group_id, user_id, joined_at) VALUES (1, 1, ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var conns []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		conn, _, err := dialSocket(t, server, auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"group:1"}})
+		if frame := readFrame(t, conn); frame.Type != "subscribed" {
+			t.Fatalf("Subscribe %d: got %+v", i, frame)
+		}
+		conns = append(conns, conn)
+	}
+
+	// Bob is not a member until he joins, after which every connection sees his changes
+	renameUser(t, router, "2", "Robert", "bob@example.com")
+	renameUser(t, router, "1", "Alicia", "alice@example.com")
+	for i, conn := range conns {
+		if frame := readFrame(t, conn); frame.Type != "event" || frame.Event.UserID != 1 {
+			t.Errorf("Connection %d, member changed: got %+v", i, frame.Event)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO group_members (group_id, user_id, joined_at) VALUES (1, 2, ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	renameUser(t, router, "2", "Bob", "bob@example.com")
+	for i, conn := range conns {
+		if frame := readFrame(t, conn); frame.Type != "event" || frame.Event.UserID != 2 || frame.Event.User.Name != "Bob" {
+			t.Errorf("Connection %d, new member changed: got %+v", i, frame.Event)
+		}
+	}
+}
+
+// Test that unacknowledged events are held back and that shutdown closes connections
+func TestWebSocketBackpressure(t *testing.T) {
+	setupTestDatabase(t)
+	app := newServers(db, testConfig())
+	startOutbox(t, app)
+	router := app.router
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	tokens := loginTestUser(t, router)
+
+	conn, _, err := dialSocket(t, server, http.Header{"Authorization": {"Bearer " + tokens.AccessToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "subscribe", Topics: []string{"users"}})
+	readFrame(t, conn)
+
+	// 100 events may be unacknowledged; the next waits for an ack
+	for i := 0; i < 101; i++ {
+		renameUser(t, router, "2", fmt.Sprintf("Bob %d", i), "bob@example.com")
+	}
+	var last handlers.SocketFrame
+	for i := 0; i < 100; i++ {
+		last = readFrame(t, conn)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "ping"})
+	if frame := readFrame(t, conn); frame.Type != "pong" {
+		t.Fatalf("Expected the 101st event to be held, got %+v", frame)
+	}
+	sendFrame(t, conn, handlers.SocketFrame{Type: "ack", ID: last.Event.ID})
+	if frame := readFrame(t, conn); frame.Type != "event" || frame.Event.ID != last.Event.ID+1 {
+		t.Errorf("After ack: got %+v", frame)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.closeStreams(ctx); err != nil {
+		t.Fatalf("Close streams: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Shutdown: got %v, want going away", err)
+	}
+}